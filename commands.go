@@ -0,0 +1,168 @@
+// commands.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"inventory-app/config"
+	"inventory-app/models"
+	"inventory-app/services"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+)
+
+// runCommand executes a command-line subcommand instead of starting the server.
+func runCommand(name string, args []string) {
+	switch name {
+	case "rebuild-summary":
+		rebuildSummaryCommand(args)
+	case "repair-orphans":
+		repairOrphansCommand(args)
+	case "migrate":
+		migrateCommand(args)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", name)
+		fmt.Fprintln(os.Stderr, "Available commands: rebuild-summary, repair-orphans, migrate")
+		os.Exit(2)
+	}
+}
+
+// rebuildSummaryCommand replays the ledger into inventory_summary, printing every difference found.
+func rebuildSummaryCommand(args []string) {
+	fs := flag.NewFlagSet("rebuild-summary", flag.ExitOnError)
+	productID := fs.Int("product", 0, "only rebuild this product id (default: all products)")
+	dryRun := fs.Bool("dry-run", false, "report the differences without writing them")
+	fs.Parse(args)
+
+	results, err := services.RebuildInventorySummary(config.DB, *productID, *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to rebuild inventory summary: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PRODUCT\tCODE\tSCOPE\tFIELD\tSTORED\tREBUILT")
+	for _, r := range results {
+		printTotalsDiff(w, r.ProductID, r.Code, "company", r.Stored, r.Rebuilt)
+		for _, l := range r.Locations {
+			printTotalsDiff(w, r.ProductID, r.Code, fmt.Sprintf("location %d", l.LocationID), l.Stored, l.Rebuilt)
+		}
+	}
+	w.Flush()
+
+	if *dryRun {
+		fmt.Printf("%d product(s) differ from the ledger (dry run, nothing written)\n", len(results))
+	} else {
+		fmt.Printf("%d product(s) rebuilt from the ledger\n", len(results))
+	}
+}
+
+// repairOrphansCommand deletes (or, for optional references, clears) the rows that reference
+// deleted records, printing how many were found in each table.
+func repairOrphansCommand(args []string) {
+	fs := flag.NewFlagSet("repair-orphans", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report the orphans without repairing them")
+	fs.Parse(args)
+
+	if config.Driver != config.SQLite {
+		fmt.Println("PostgreSQL enforces foreign keys on every write; there are no orphaned rows to repair")
+		return
+	}
+
+	repairs, err := services.RepairOrphans(config.DB, *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to repair orphans: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tCOLUMN\tPARENT\tROWS\tACTION")
+	total := 0
+	for _, r := range repairs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", r.Table, r.Column, r.Parent, r.Rows, r.Action)
+		total += r.Rows
+	}
+	w.Flush()
+
+	if *dryRun {
+		fmt.Printf("%d orphaned row(s) found (dry run, nothing written)\n", total)
+	} else {
+		fmt.Printf("%d orphaned row(s) repaired\n", total)
+	}
+}
+
+// migrateCommand reports the schema migrations ("migrate status") or applies the pending ones
+// ("migrate up"). The database is opened without migrating it, so status shows what is pending.
+// After "up", movements left uncosted by the costing migrations are costed from the ledger.
+func migrateCommand(args []string) {
+	if len(args) == 0 || (args[0] != "status" && args[0] != "up") {
+		fmt.Fprintln(os.Stderr, "Usage: migrate status|up")
+		os.Exit(2)
+	}
+	if args[0] == "up" {
+		if err := config.Migrate(); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+		backfillCosts()
+		fmt.Println("Database schema is up to date")
+		return
+	}
+
+	states, err := config.MigrationStatus()
+	if err != nil {
+		log.Fatalf("Failed to read migration status: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	pending := 0
+	for _, s := range states {
+		status := "applied " + s.AppliedAt
+		switch {
+		case s.Unknown:
+			status = "unknown to this binary (applied " + s.AppliedAt + ")"
+		case s.AppliedAt == "":
+			status = "pending"
+			pending++
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, status)
+	}
+	w.Flush()
+	fmt.Printf("%d migration(s) pending\n", pending)
+}
+
+// printTotalsDiff writes one line per field that differs between the stored and rebuilt totals
+func printTotalsDiff(w io.Writer, productID int, code, scope string, stored *models.InventoryTotals, rebuilt models.InventoryTotals) {
+	if stored == nil {
+		fmt.Fprintf(w, "%d\t%s\t%s\t(missing row)\t-\t-\n", productID, code, scope)
+		return
+	}
+	fields := []struct {
+		name            string
+		stored, rebuilt float64
+	}{
+		{"total_in", stored.TotalIn, rebuilt.TotalIn},
+		{"total_out", stored.TotalOut, rebuilt.TotalOut},
+		{"total_adjustment", stored.TotalAdjustment, rebuilt.TotalAdjustment},
+		{"ending_stock", stored.EndingStock, rebuilt.EndingStock},
+		{"average_price", stored.AveragePrice, rebuilt.AveragePrice},
+		{"stock_value", stored.StockValue, rebuilt.StockValue},
+	}
+	for _, f := range fields {
+		if f.stored != f.rebuilt {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%g\t%g\n", productID, code, scope, f.name, f.stored, f.rebuilt)
+		}
+	}
+}
+
+// backfillCosts costs the stock movements recorded before costing was added by rebuilding the
+// inventory summary from the ledger, which the schema migrations cannot do themselves.
+func backfillCosts() {
+	costed, err := services.BackfillCosts(config.DB)
+	if err != nil {
+		log.Fatalf("Failed to cost existing stock movements: %v", err)
+	}
+	if costed > 0 {
+		log.Printf("Costed %d existing stock movement(s) by rebuilding the inventory summary from the ledger", costed)
+	}
+}
@@ -3,91 +3,102 @@ package config
 import (
 	"database/sql"
 	"log"
+	"os"
 
 	_ "modernc.org/sqlite"
 )
 
 var DB *sql.DB
 
-// InitDB initializes the SQLite database connection and creates necessary tables.
-func InitDB() {
-	var err error
-	DB, err = sql.Open("sqlite", "./inventory.db")
-	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
-	}
+// The databases the application can run against
+const (
+	SQLite   = "sqlite"
+	Postgres = "postgres"
+)
 
-	// Create tables if they do not exist.
-	createTables()
+// Driver is the database DB is open on, set from DB_DRIVER by OpenDB
+var Driver = SQLite
+
+// dbPath is the SQLite database the application runs against
+const dbPath = "./inventory.db"
+
+// openSQLite opens the SQLite database at path with foreign keys enforced on every connection
+// of the pool
+func openSQLite(path string) (*sql.DB, error) {
+	return sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)")
 }
 
-func createTables() {
-	// Begin a transaction for the table creation process
-	tx, err := DB.Begin()
-	if err != nil {
-		log.Fatalf("Failed to begin transaction: %v", err)
+// OpenDB opens the database without touching its schema. DB_DRIVER selects the database:
+// sqlite (the default) uses ./inventory.db, postgres connects to DATABASE_URL so several
+// instances of the application can share one database.
+func OpenDB() {
+	if driver := os.Getenv("DB_DRIVER"); driver != "" {
+		if driver != SQLite && driver != Postgres {
+			log.Fatalf("Invalid DB_DRIVER %q (expected sqlite or postgres)", driver)
+		}
+		Driver = driver
 	}
 
-	// Creating products table
-	productTable := `
-		CREATE TABLE IF NOT EXISTS products (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		code TEXT NOT NULL UNIQUE,
-		name TEXT NOT NULL,
-		description TEXT,        -- Added description
-		unit TEXT NOT NULL,
-		category TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);`
-	_, err = tx.Exec(productTable)
+	var err error
+	if Driver == Postgres {
+		DB, err = openPostgres(os.Getenv("DATABASE_URL"))
+		if err == nil {
+			err = DB.Ping()
+		}
+	} else {
+		DB, err = openSQLite(dbPath)
+	}
 	if err != nil {
-		tx.Rollback() // Rollback in case of error
-		log.Fatalf("Failed to create products table: %v", err)
+		log.Fatalf("Failed to open database: %v", err)
 	}
+}
 
-	// Creating stock_transactions table
-	transactionTable := `
-		CREATE TABLE IF NOT EXISTS stock_transactions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		product_id INTEGER,
-		transaction_type TEXT CHECK(transaction_type IN ('in','out')) NOT NULL,
-		quantity REAL NOT NULL,
-		price_per_unit REAL,                -- New field for price per unit
-		total_value REAL,                   -- New field: could be computed (quantity * price_per_unit)
-		department TEXT,                    -- You may still wish to record this if needed
-		transaction_timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-		notes TEXT,
-		FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE
-	);`
-	_, err = tx.Exec(transactionTable)
+// Open opens the SQLite database at path and brings its schema up to date, leaving DB alone.
+// It lets a test run the stores against a database file of its own.
+func Open(path string) (*sql.DB, error) {
+	db, err := openSQLite(path)
 	if err != nil {
-		tx.Rollback() // Rollback in case of error
-		log.Fatalf("Failed to create transactions table: %v", err)
+		return nil, err
+	}
+	if err := migrate(db, SQLite); err != nil {
+		db.Close()
+		return nil, err
 	}
+	return db, nil
+}
 
-	// Creating inventory_summary table
-	inventorySummaryTable := `
-		CREATE TABLE IF NOT EXISTS inventory_summary (
-			product_id INTEGER PRIMARY KEY,
-			opening_stock REAL DEFAULT 0,
-			total_in REAL DEFAULT 0,
-			total_out REAL DEFAULT 0,
-			ending_stock REAL DEFAULT 0,
-			average_price REAL DEFAULT 0,
-			low_stock_threshold REAL DEFAULT 5,
-			FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE
-		);`
-	_, err = tx.Exec(inventorySummaryTable)
+// OpenPostgres connects to the PostgreSQL database at url and brings its schema up to date,
+// leaving DB alone. It lets a test run the stores against a PostgreSQL database.
+func OpenPostgres(url string) (*sql.DB, error) {
+	db, err := openPostgres(url)
 	if err != nil {
-		tx.Rollback() // Rollback in case of error
-		log.Fatalf("Failed to create inventory_summary table: %v", err)
+		return nil, err
 	}
+	if err := migrate(db, Postgres); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
 
-	// Commit the transaction once all tables are created successfully
-	err = tx.Commit()
-	if err != nil {
-		log.Fatalf("Failed to commit transaction: %v", err)
+// InitDB initializes the database connection and applies pending migrations.
+func InitDB() {
+	OpenDB()
+
+	// Bring the schema up to date; a database written by a newer release is refused
+	if err := Migrate(); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
-	log.Println("Database tables created successfully.")
+	// Rows written before SQLite enforced foreign keys may reference deleted records
+	if Driver != SQLite {
+		return
+	}
+	var orphans int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM pragma_foreign_key_check").Scan(&orphans); err != nil {
+		log.Fatalf("Failed to check foreign keys: %v", err)
+	}
+	if orphans > 0 {
+		log.Printf("%d row(s) reference missing records; run the repair-orphans command to fix them.", orphans)
+	}
 }
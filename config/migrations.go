@@ -0,0 +1,241 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// migration is one versioned change to the schema. Migrations are applied in version order,
+// each in its own transaction, and recorded in schema_migrations. Each is written once per
+// database, as their DDL differs.
+type migration struct {
+	version    int
+	name       string
+	up         func(tx *sql.Tx) error // SQLite
+	upPostgres func(tx *sql.Tx) error // nil when the PostgreSQL baseline already includes the change
+	rebuild    bool                   // SQLite: the migration rebuilds tables, see rebuildPragmas
+}
+
+// migrations lists every schema change, oldest first. Versions are never reused or
+// renumbered; a change to the schema is a new entry at the end. PostgreSQL support arrived
+// with the schema at version 16, so its baseline creates all of it at once; later changes
+// are migrated on both databases, unless they only repair what SQLite stored.
+var migrations = []migration{
+	{version: 1, name: "baseline schema", up: createBaseline, upPostgres: createPostgresTables},
+	{version: 2, name: "periods", up: addPeriods},
+	{version: 3, name: "transaction reversals", up: addReversals},
+	{version: 4, name: "stock adjustments", up: addAdjustments, rebuild: true},
+	{version: 5, name: "count sessions", up: addCountSessions},
+	{version: 6, name: "locations", up: addLocations},
+	{version: 7, name: "transfers", up: addTransfers, rebuild: true},
+	{version: 8, name: "stock documents", up: addStockDocuments},
+	{version: 9, name: "lots", up: addLots},
+	{version: 10, name: "serial numbers", up: addSerialNumbers},
+	{version: 11, name: "costing", up: addCosting},
+	{version: 12, name: "stock checkpoints", up: addStockCheckpoints},
+	{version: 13, name: "transaction listing indexes", up: addTransactionIndexes},
+	{version: 14, name: "product search", up: addProductSearch},
+	{version: 15, name: "categories", up: addCategories},
+	{version: 16, name: "product archiving", up: addArchiving},
+	{version: 17, name: "location cost layers", up: addLocationCostLayers, upPostgres: addLocationCostLayers},
+	{version: 18, name: "UTC ledger timestamps", up: rewriteLedgerTimestamps},
+}
+
+// MigrationState is a migration known to the binary or recorded in the database
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt string // empty while the migration is pending
+	Unknown   bool   // recorded in the database but not known to this binary
+}
+
+// latestVersion is the schema version this binary migrates to
+func latestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// Migrate applies the pending migrations to DB. It refuses a database that has migrations
+// this binary does not know, as it was written by a newer release.
+func Migrate() error {
+	return migrate(DB, Driver)
+}
+
+// migrate applies the pending migrations to db, a database of the given driver
+func migrate(db *sql.DB, driver string) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	appliedAtType := "DATETIME"
+	if driver == Postgres {
+		// Instances starting together against one database migrate it one at a time; the
+		// lock is held by this connection and released with it
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext('schema_migrations'))"); err != nil {
+			return fmt.Errorf("failed to lock schema: %w", err)
+		}
+		defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext('schema_migrations'))")
+		appliedAtType = "TIMESTAMP"
+	}
+
+	// Creating schema_migrations table: one row per applied migration
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at `+appliedAtType+` DEFAULT CURRENT_TIMESTAMP
+		);`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	if current > latestVersion() {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d); upgrade the binary", current, latestVersion())
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		up := m.up
+		rebuild := m.rebuild
+		if driver == Postgres {
+			up = m.upPostgres
+			rebuild = false
+		}
+		if rebuild {
+			if err := rebuildPragmas(ctx, conn, true); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		if err := applyMigration(ctx, conn, m, up, rebuild); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if rebuild {
+			if err := rebuildPragmas(ctx, conn, false); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		log.Printf("Applied migration %d: %s", m.version, m.name)
+	}
+	return nil
+}
+
+// applyMigration runs one migration and records it, in a single transaction. up is nil for a
+// change the PostgreSQL baseline already made, which is only recorded.
+func applyMigration(ctx context.Context, conn *sql.Conn, m migration, up func(tx *sql.Tx) error, rebuild bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Orphaned rows from before foreign keys were enforced are left to repair-orphans
+	var orphans int
+	if rebuild {
+		if err := tx.QueryRow("SELECT COUNT(*) FROM pragma_foreign_key_check").Scan(&orphans); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if up != nil {
+		if err := up(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if rebuild {
+		// With foreign keys off nothing stopped the rebuild from leaving rows without their parent
+		var after int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM pragma_foreign_key_check").Scan(&after); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if after > orphans {
+			tx.Rollback()
+			return fmt.Errorf("%d row(s) would reference missing records", after-orphans)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, CURRENT_TIMESTAMP)`, m.version, m.name); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// rebuildPragmas switches conn to what a SQLite table rebuild needs, or back. Tables are rebuilt
+// by renaming and dropping them, which is only safe with foreign keys off (dropping would
+// cascade) and legacy renames (references in other tables would follow the rename). Neither
+// can change inside a transaction, so they are set around the migration.
+func rebuildPragmas(ctx context.Context, conn *sql.Conn, on bool) error {
+	foreignKeys, legacyAlterTable := "ON", "OFF"
+	if on {
+		foreignKeys, legacyAlterTable = "OFF", "ON"
+	}
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = "+foreignKeys); err != nil {
+		return fmt.Errorf("failed to set foreign keys: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "PRAGMA legacy_alter_table = "+legacyAlterTable); err != nil {
+		return fmt.Errorf("failed to set legacy table renames: %w", err)
+	}
+	return nil
+}
+
+// MigrationStatus lists the migrations known to the binary, with when each was applied, followed
+// by any the database records that the binary does not know. It does not change the database.
+func MigrationStatus() ([]MigrationState, error) {
+	applied := map[int]MigrationState{}
+	tableExistsQuery := `SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`
+	if Driver == Postgres {
+		tableExistsQuery = `SELECT to_regclass('schema_migrations') IS NOT NULL`
+	}
+	var tableExists bool
+	if err := DB.QueryRow(tableExistsQuery).Scan(&tableExists); err != nil {
+		return nil, err
+	}
+	if tableExists {
+		rows, err := DB.Query(`SELECT version, name, COALESCE(CAST(applied_at AS TEXT), '') FROM schema_migrations ORDER BY version`)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var s MigrationState
+			if err := rows.Scan(&s.Version, &s.Name, &s.AppliedAt); err != nil {
+				return nil, err
+			}
+			applied[s.Version] = s
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	states := []MigrationState{}
+	for _, m := range migrations {
+		s := MigrationState{Version: m.version, Name: m.name}
+		if a, ok := applied[m.version]; ok {
+			s.AppliedAt = a.AppliedAt
+			delete(applied, m.version)
+		}
+		states = append(states, s)
+	}
+	unknown := []int{}
+	for version := range applied {
+		unknown = append(unknown, version)
+	}
+	sort.Ints(unknown)
+	for _, version := range unknown {
+		s := applied[version]
+		s.Unknown = true
+		states = append(states, s)
+	}
+	return states, nil
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+// openLegacyDB copies inventory.db, written before the schema was versioned, to a file of the
+// test's own and opens it without migrating it. The pool holds a single connection, so the
+// pragmas a migration leaves behind are the ones the next query sees.
+func openLegacyDB(t *testing.T) *sql.DB {
+	t.Helper()
+	data, err := os.ReadFile("../inventory.db")
+	if err != nil {
+		t.Fatalf("read legacy database: %v", err)
+	}
+	path := t.TempDir() + "/inventory.db"
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("copy legacy database: %v", err)
+	}
+	db, err := openSQLite(path)
+	if err != nil {
+		t.Fatalf("open legacy database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// useDB points DB, which the migrate command works on, at db for the rest of the test
+func useDB(t *testing.T, db *sql.DB, driver string) {
+	previousDB, previousDriver := DB, Driver
+	DB, Driver = db, driver
+	t.Cleanup(func() { DB, Driver = previousDB, previousDriver })
+}
+
+// count returns the single number query selects
+func count(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	db := openLegacyDB(t)
+	useDB(t, db, SQLite)
+
+	// Status reports every migration pending, without creating schema_migrations
+	states, err := MigrationStatus()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if len(states) != len(migrations) {
+		t.Fatalf("status lists %d migrations, want %d", len(states), len(migrations))
+	}
+	for _, s := range states {
+		if s.AppliedAt != "" || s.Unknown {
+			t.Errorf("before migrating: %+v, want pending", s)
+		}
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'`); n != 0 {
+		t.Error("status created schema_migrations")
+	}
+	// The ledger rows of deleted products were never cascaded away
+	orphans := count(t, db, `SELECT COUNT(*) FROM pragma_foreign_key_check`)
+
+	if err := Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	states, err = MigrationStatus()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	applied := map[int]string{}
+	for _, s := range states {
+		if s.AppliedAt == "" || s.Unknown {
+			t.Errorf("after migrating: %+v, want applied", s)
+		}
+		applied[s.Version] = s.AppliedAt
+	}
+
+	// stock_transactions was rebuilt twice (versions 4 and 7) with foreign keys off: every row
+	// survived, orphans included, nothing was left behind under the old name, and both
+	// pragmas were switched back
+	if n := count(t, db, `SELECT COUNT(*) FROM stock_transactions`); n != 19 {
+		t.Errorf("%d ledger rows after migrating, want all 19", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM pragma_foreign_key_check`); n != orphans {
+		t.Errorf("%d orphaned rows after migrating, want the %d from before", n, orphans)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM sqlite_master WHERE name LIKE '%\_old' ESCAPE '\' OR sql LIKE '%\_old%' ESCAPE '\'`); n != 0 {
+		t.Errorf("%d schema objects still name a table replaced by a rebuild", n)
+	}
+	if n := count(t, db, `PRAGMA foreign_keys`); n != 1 {
+		t.Error("foreign keys were left off after the rebuilds")
+	}
+	if n := count(t, db, `PRAGMA legacy_alter_table`); n != 0 {
+		t.Error("legacy table renames were left on after the rebuilds")
+	}
+
+	// The rebuilt table takes the movements added since, and enforces its product
+	if _, err := db.Exec(`INSERT INTO stock_transactions (product_id, transaction_type, quantity) VALUES (9, 'adjustment', 1)`); err != nil {
+		t.Errorf("adjustment after migrating: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO stock_transactions (product_id, transaction_type, quantity) VALUES (999, 'in', 1)`); err == nil {
+		t.Error("a ledger row of a missing product was accepted")
+	}
+
+	// Version 18 rewrote the legacy time.String timestamps (+07:00) in UTC
+	var timestamp string
+	if err := db.QueryRow(`SELECT CAST(transaction_timestamp AS TEXT) FROM stock_transactions WHERE id = 14`).Scan(&timestamp); err != nil {
+		t.Fatal(err)
+	}
+	if timestamp != "2025-04-15 17:34:10.0764591" {
+		t.Errorf("timestamp of entry 14 = %q, want 2025-04-15 17:34:10.0764591 (UTC)", timestamp)
+	}
+
+	// Migrating again applies nothing and leaves the recorded migrations alone
+	if err := Migrate(); err != nil {
+		t.Fatalf("migrate again: %v", err)
+	}
+	states, err = MigrationStatus()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	for _, s := range states {
+		if s.AppliedAt != applied[s.Version] {
+			t.Errorf("migration %d applied at %q after migrating again, want %q", s.Version, s.AppliedAt, applied[s.Version])
+		}
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM schema_migrations`); n != latestVersion() {
+		t.Errorf("%d migrations recorded, want %d", n, latestVersion())
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM stock_transactions`); n != 20 {
+		t.Errorf("%d ledger rows after migrating again, want 20", n)
+	}
+}
+
+func TestMigrateRefusesNewerDatabase(t *testing.T) {
+	db := openLegacyDB(t)
+	useDB(t, db, SQLite)
+	if err := Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	newer := latestVersion() + 1
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, 'from a newer release')`, newer); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(); err == nil {
+		t.Error("migrated a database written by a newer release")
+	}
+	states, err := MigrationStatus()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if last := states[len(states)-1]; last.Version != newer || !last.Unknown {
+		t.Errorf("last status = %+v, want version %d unknown to this binary", last, newer)
+	}
+	if len(states) != len(migrations)+1 {
+		t.Errorf("status lists %d migrations, want %d", len(states), len(migrations)+1)
+	}
+}
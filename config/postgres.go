@@ -0,0 +1,340 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Queries throughout the application are written with SQLite's ? placeholders. PostgreSQL
+// numbers its parameters ($1, $2, ...), so connections to it rewrite every query on its way to
+// the server and the same SQL runs against either database.
+
+// openPostgres opens the PostgreSQL database at url (a postgres:// URL or key=value connection
+// string; empty uses the PG* environment variables)
+func openPostgres(url string) (*sql.DB, error) {
+	connector, err := pq.NewConnector(url)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(postgresConnector{connector}), nil
+}
+
+// postgresConnector hands out connections that rewrite ? placeholders
+type postgresConnector struct {
+	driver.Connector
+}
+
+func (c postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pc, ok := conn.(pqConn)
+	if !ok {
+		conn.Close()
+		return nil, errors.New("postgres connection does not support contexts")
+	}
+	return postgresConn{pc}, nil
+}
+
+// pqConn is what a lib/pq connection implements, and postgresConn passes on
+type pqConn interface {
+	driver.Conn
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+	driver.QueryerContext
+	driver.ExecerContext
+	driver.NamedValueChecker
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+// postgresConn is a lib/pq connection that rewrites the placeholders of every query
+type postgresConn struct {
+	pqConn
+}
+
+func (c postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return c.pqConn.Prepare(rebind(query))
+}
+
+func (c postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.pqConn.PrepareContext(ctx, rebind(query))
+}
+
+func (c postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.pqConn.QueryContext(ctx, rebind(query), args)
+}
+
+func (c postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.pqConn.ExecContext(ctx, rebind(query), args)
+}
+
+// rebind numbers the ? placeholders of query as $1, $2, ..., leaving question marks inside
+// string literals, quoted identifiers and comments alone
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	var quote byte // the quote character of the literal or identifier being copied
+	comment := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case comment:
+			comment = ch != '\n'
+		case quote != 0:
+			if ch == quote {
+				quote = 0 // a doubled quote closes and reopens the literal
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '-' && i+1 < len(query) && query[i+1] == '-':
+			comment = true
+		case ch == '?':
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// createPostgresTables creates the PostgreSQL schema equivalent to the SQLite baseline:
+// DATETIME columns are TIMESTAMP, REAL is DOUBLE PRECISION, flags are BOOLEAN and the
+// full-text index over products is a GIN index. Text that listings sort by uses the "C"
+// collation, so it orders the same as in SQLite.
+func createPostgresTables(tx *sql.Tx) error {
+	tables := []struct{ name, statement string }{
+		{"categories", `
+			CREATE TABLE IF NOT EXISTS categories (
+				id SERIAL PRIMARY KEY,
+				name TEXT COLLATE "C" NOT NULL,
+				parent_id INTEGER REFERENCES categories(id), -- NULL for a root category
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`},
+		{"products", `
+			CREATE TABLE IF NOT EXISTS products (
+				id SERIAL PRIMARY KEY,
+				code TEXT COLLATE "C" NOT NULL UNIQUE,
+				name TEXT COLLATE "C" NOT NULL,
+				description TEXT,
+				unit TEXT NOT NULL,
+				category TEXT COLLATE "C",          -- Name of the category, kept in step with category_id
+				category_id INTEGER REFERENCES categories(id),
+				serialized BOOLEAN NOT NULL DEFAULT FALSE, -- Movements must list a serial number per unit
+				costing_method TEXT,                -- moving_average or fifo; NULL uses the global default
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				archived_at TIMESTAMP               -- Archived products keep their history but take no new transactions
+			)`},
+		{"stock_transactions", `
+			CREATE TABLE IF NOT EXISTS stock_transactions (
+				id SERIAL PRIMARY KEY,
+				product_id INTEGER REFERENCES products(id) ON DELETE CASCADE,
+				location_id INTEGER NOT NULL DEFAULT 1, -- Defaults to the main warehouse
+				transaction_type TEXT CHECK(transaction_type IN ('in','out','adjustment','transfer_out','transfer_in')) NOT NULL,
+				quantity DOUBLE PRECISION NOT NULL,
+				price_per_unit DOUBLE PRECISION,
+				total_value DOUBLE PRECISION,
+				department TEXT COLLATE "C",
+				transaction_timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				notes TEXT,
+				reversal_of INTEGER,                -- Set on the compensating entry of a voided transaction
+				voided_at TIMESTAMP,                -- Set on the original when it has been voided
+				reason_code TEXT,                   -- Adjustments: damage, shrinkage or count_correction
+				counted_quantity DOUBLE PRECISION,  -- Adjustments: the physically counted quantity
+				transfer_id INTEGER,                -- Transfers: the transfer this entry belongs to
+				document_id INTEGER,                -- Document lines: the stock document this entry belongs to
+				lot_number TEXT COLLATE "C",        -- Lot or batch the quantity belongs to, if tracked
+				expiry_date TEXT,                   -- YYYY-MM-DD expiry of the lot
+				unit_cost DOUBLE PRECISION,         -- Cost per unit the movement was booked at
+				cost_total DOUBLE PRECISION         -- quantity * unit_cost; for a stock-out, the cost of goods issued
+			)`},
+		{"inventory_summary", `
+			CREATE TABLE IF NOT EXISTS inventory_summary (
+				product_id INTEGER PRIMARY KEY REFERENCES products(id) ON DELETE CASCADE,
+				opening_stock DOUBLE PRECISION DEFAULT 0,
+				total_in DOUBLE PRECISION DEFAULT 0,
+				total_out DOUBLE PRECISION DEFAULT 0,
+				total_adjustment DOUBLE PRECISION DEFAULT 0,
+				ending_stock DOUBLE PRECISION DEFAULT 0,
+				average_price DOUBLE PRECISION DEFAULT 0,
+				stock_value DOUBLE PRECISION DEFAULT 0,
+				low_stock_threshold DOUBLE PRECISION DEFAULT 5
+			)`},
+		{"periods", `
+			CREATE TABLE IF NOT EXISTS periods (
+				period TEXT PRIMARY KEY,            -- YYYY-MM
+				status TEXT CHECK(status IN ('open','closed')) NOT NULL DEFAULT 'open',
+				closed_at TIMESTAMP
+			)`},
+		{"period_balances", `
+			CREATE TABLE IF NOT EXISTS period_balances (
+				period TEXT NOT NULL REFERENCES periods(period) ON DELETE CASCADE,
+				product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+				opening_stock DOUBLE PRECISION DEFAULT 0,
+				total_in DOUBLE PRECISION DEFAULT 0,
+				total_out DOUBLE PRECISION DEFAULT 0,
+				total_adjustment DOUBLE PRECISION DEFAULT 0,
+				ending_stock DOUBLE PRECISION DEFAULT 0,
+				average_price DOUBLE PRECISION DEFAULT 0,
+				total_value DOUBLE PRECISION DEFAULT 0,
+				PRIMARY KEY(period, product_id)
+			)`},
+		{"period_audit_log", `
+			CREATE TABLE IF NOT EXISTS period_audit_log (
+				id SERIAL PRIMARY KEY,
+				period TEXT NOT NULL,
+				action TEXT CHECK(action IN ('close','reopen')) NOT NULL,
+				performed_by TEXT,
+				reason TEXT,
+				performed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`},
+		{"locations", `
+			CREATE TABLE IF NOT EXISTS locations (
+				id SERIAL PRIMARY KEY,
+				code TEXT NOT NULL UNIQUE,
+				name TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`},
+		{"location_stock", `
+			CREATE TABLE IF NOT EXISTS location_stock (
+				product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+				location_id INTEGER NOT NULL REFERENCES locations(id),
+				total_in DOUBLE PRECISION DEFAULT 0,
+				total_out DOUBLE PRECISION DEFAULT 0,
+				total_adjustment DOUBLE PRECISION DEFAULT 0,
+				ending_stock DOUBLE PRECISION DEFAULT 0,
+				average_price DOUBLE PRECISION DEFAULT 0,
+				stock_value DOUBLE PRECISION DEFAULT 0,
+				PRIMARY KEY(product_id, location_id)
+			)`},
+		{"transfers", `
+			CREATE TABLE IF NOT EXISTS transfers (
+				id SERIAL PRIMARY KEY,
+				product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+				from_location_id INTEGER NOT NULL REFERENCES locations(id),
+				to_location_id INTEGER NOT NULL REFERENCES locations(id),
+				quantity DOUBLE PRECISION NOT NULL,
+				average_price DOUBLE PRECISION DEFAULT 0, -- Source average price at dispatch, carried to the destination
+				status TEXT CHECK(status IN ('in_transit','received','cancelled')) NOT NULL DEFAULT 'in_transit',
+				notes TEXT,
+				dispatched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				received_at TIMESTAMP,
+				out_transaction_id INTEGER,
+				in_transaction_id INTEGER
+			)`},
+		{"stock_documents", `
+			CREATE TABLE IF NOT EXISTS stock_documents (
+				id SERIAL PRIMARY KEY,
+				document_number TEXT UNIQUE,
+				document_type TEXT CHECK(document_type IN ('receipt','issue')) NOT NULL,
+				document_date TIMESTAMP NOT NULL,
+				location_id INTEGER NOT NULL DEFAULT 1 REFERENCES locations(id),
+				department TEXT,
+				supplier TEXT,
+				notes TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`},
+		{"serial_numbers", `
+			CREATE TABLE IF NOT EXISTS serial_numbers (
+				product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+				serial_number TEXT COLLATE "C" NOT NULL,
+				status TEXT CHECK(status IN ('in_stock','in_transit','out')) NOT NULL,
+				location_id INTEGER REFERENCES locations(id), -- Where the unit is, while it is in stock
+				PRIMARY KEY(product_id, serial_number)
+			)`},
+		{"transaction_serials", `
+			CREATE TABLE IF NOT EXISTS transaction_serials (
+				transaction_id INTEGER NOT NULL REFERENCES stock_transactions(id) ON DELETE CASCADE,
+				product_id INTEGER NOT NULL,
+				serial_number TEXT COLLATE "C" NOT NULL,
+				PRIMARY KEY(transaction_id, serial_number)
+			)`},
+		{"cost_layers", `
+			CREATE TABLE IF NOT EXISTS cost_layers (
+				id SERIAL PRIMARY KEY,              -- Layers are consumed in id order
+				product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+				transaction_id INTEGER NOT NULL,    -- The receipt, or 0 for stock on hand before FIFO costing
+				quantity DOUBLE PRECISION NOT NULL, -- Remaining quantity
+				unit_cost DOUBLE PRECISION NOT NULL
+			)`},
+		{"stock_checkpoints", `
+			CREATE TABLE IF NOT EXISTS stock_checkpoints (
+				checkpoint_date TEXT NOT NULL,      -- YYYY-MM-DD; balances of every ledger entry before this day
+				product_id INTEGER NOT NULL,
+				location_id INTEGER NOT NULL,       -- 0 for the company-wide balance
+				ending_stock DOUBLE PRECISION NOT NULL,
+				average_price DOUBLE PRECISION NOT NULL,
+				stock_value DOUBLE PRECISION NOT NULL,
+				PRIMARY KEY(checkpoint_date, product_id, location_id)
+			)`},
+		{"count_sessions", `
+			CREATE TABLE IF NOT EXISTS count_sessions (
+				id SERIAL PRIMARY KEY,
+				name TEXT NOT NULL,
+				category TEXT,
+				location_id INTEGER NOT NULL DEFAULT 1,
+				status TEXT CHECK(status IN ('open','submitted','approved','cancelled')) NOT NULL DEFAULT 'open',
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				approved_at TIMESTAMP,
+				approved_by TEXT
+			)`},
+		{"count_lines", `
+			CREATE TABLE IF NOT EXISTS count_lines (
+				session_id INTEGER NOT NULL REFERENCES count_sessions(id) ON DELETE CASCADE,
+				product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+				counted_quantity DOUBLE PRECISION,  -- NULL until the product has been counted
+				counted_by TEXT,
+				counted_at TIMESTAMP,
+				system_quantity DOUBLE PRECISION,   -- Stored on submission
+				average_price DOUBLE PRECISION,     -- Stored on submission
+				PRIMARY KEY(session_id, product_id)
+			)`},
+	}
+	for _, table := range tables {
+		if _, err := tx.Exec(table.statement); err != nil {
+			return fmt.Errorf("failed to create %s table: %w", table.name, err)
+		}
+	}
+
+	indexes := []string{
+		// Sibling categories have distinct names
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_name ON categories((COALESCE(parent_id, 0)), name)`,
+		// Product searches must match this expression exactly to use the index
+		`CREATE INDEX IF NOT EXISTS idx_products_search ON products USING GIN (to_tsvector('simple', code || ' ' || name || ' ' || COALESCE(description, '')))`,
+		`CREATE INDEX IF NOT EXISTS idx_stock_transactions_timestamp ON stock_transactions(transaction_timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_stock_transactions_product ON stock_transactions(product_id, transaction_timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_stock_transactions_department ON stock_transactions(department, transaction_timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_stock_transactions_quantity ON stock_transactions(quantity)`,
+	}
+	for _, index := range indexes {
+		if _, err := tx.Exec(index); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	// The main warehouse always exists; transactions without a location are recorded there.
+	// Its id is given explicitly, so the id sequence is moved past it.
+	_, err := tx.Exec(`INSERT INTO locations (id, code, name, created_at) VALUES (1, 'MAIN', 'Main warehouse', CURRENT_TIMESTAMP) ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return fmt.Errorf("failed to create default location: %w", err)
+	}
+	_, err = tx.Exec(`SELECT setval(pg_get_serial_sequence('locations', 'id'), (SELECT MAX(id) FROM locations))`)
+	if err != nil {
+		return fmt.Errorf("failed to create default location: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"inventory-app/internal/pgtest"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name, query, want string
+	}{
+		{"no placeholders", `SELECT 1`, `SELECT 1`},
+		{"placeholders", `SELECT * FROM t WHERE a = ? AND b IN (?, ?)`, `SELECT * FROM t WHERE a = $1 AND b IN ($2, $3)`},
+		{"string literal", `SELECT '?' || ? FROM t`, `SELECT '?' || $1 FROM t`},
+		{"doubled quote", `SELECT 'it''s ?', ?`, `SELECT 'it''s ?', $1`},
+		{"quoted identifier", `SELECT "a?b" FROM t WHERE c = ?`, `SELECT "a?b" FROM t WHERE c = $1`},
+		{"comment", "SELECT ? -- why?\nWHERE a = ?", "SELECT $1 -- why?\nWHERE a = $2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rebind(tt.query); got != tt.want {
+				t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreatePostgresTables(t *testing.T) {
+	db := pgtest.Open(t, openPostgres)
+
+	// The baseline is written with IF NOT EXISTS throughout, so running it twice is harmless
+	for i := 0; i < 2; i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := createPostgresTables(tx); err != nil {
+			tx.Rollback()
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, table := range []string{"products", "stock_transactions", "inventory_summary", "location_stock", "locations",
+		"transfers", "stock_documents", "count_sessions", "count_lines", "periods", "period_balances", "categories"} {
+		var found bool
+		err := db.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?)
+		`, table).Scan(&found)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found {
+			t.Errorf("table %s was not created", table)
+		}
+	}
+
+	// The default location is seeded, so transactions without a location have somewhere to go
+	var name string
+	if err := db.QueryRow(`SELECT name FROM locations WHERE id = 1`).Scan(&name); err != nil {
+		t.Errorf("default location: %v", err)
+	}
+}
+
+func TestMigratePostgres(t *testing.T) {
+	db := pgtest.Open(t, openPostgres)
+
+	if err := migrate(db, Postgres); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// A second run finds nothing left to apply
+	if err := migrate(db, Postgres); err != nil {
+		t.Fatalf("migrate again: %v", err)
+	}
+
+	var version int
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != latestVersion() {
+		t.Errorf("schema version = %d, want %d", version, latestVersion())
+	}
+}
@@ -0,0 +1,503 @@
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"strings"
+	"time"
+)
+
+// The SQLite schema, one function per migration. A migration is never changed once released:
+// later changes to the schema are new migrations.
+
+// createBaseline creates the schema of the first release. Databases from before migrations
+// existed already have these tables and are adopted at version 1 as they are.
+func createBaseline(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TABLE IF NOT EXISTS products (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code TEXT NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			description TEXT,        -- Added description
+			unit TEXT NOT NULL,
+			category TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS stock_transactions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			product_id INTEGER,
+			transaction_type TEXT CHECK(transaction_type IN ('in','out')) NOT NULL,
+			quantity REAL NOT NULL,
+			price_per_unit REAL,                -- New field for price per unit
+			total_value REAL,                   -- New field: could be computed (quantity * price_per_unit)
+			department TEXT,                    -- You may still wish to record this if needed
+			transaction_timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+			notes TEXT,
+			FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS inventory_summary (
+			product_id INTEGER PRIMARY KEY,
+			opening_stock REAL DEFAULT 0,
+			total_in REAL DEFAULT 0,
+			total_out REAL DEFAULT 0,
+			ending_stock REAL DEFAULT 0,
+			average_price REAL DEFAULT 0,
+			low_stock_threshold REAL DEFAULT 5,
+			FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE
+		)`,
+	)
+}
+
+// addPeriods creates the closed periods, the balances snapshotted when they close and the
+// audit log of every close and reopen
+func addPeriods(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TABLE periods (
+			period TEXT PRIMARY KEY,            -- YYYY-MM
+			status TEXT CHECK(status IN ('open','closed')) NOT NULL DEFAULT 'open',
+			closed_at DATETIME
+		)`,
+		`CREATE TABLE period_balances (
+			period TEXT NOT NULL,
+			product_id INTEGER NOT NULL,
+			opening_stock REAL DEFAULT 0,
+			total_in REAL DEFAULT 0,
+			total_out REAL DEFAULT 0,
+			ending_stock REAL DEFAULT 0,
+			average_price REAL DEFAULT 0,
+			total_value REAL DEFAULT 0,
+			PRIMARY KEY(period, product_id),
+			FOREIGN KEY(period) REFERENCES periods(period) ON DELETE CASCADE,
+			FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE period_audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			period TEXT NOT NULL,
+			action TEXT CHECK(action IN ('close','reopen')) NOT NULL,
+			performed_by TEXT,
+			reason TEXT,
+			performed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+	)
+}
+
+// addReversals links the compensating entry of a voided transaction to the original
+func addReversals(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE stock_transactions ADD COLUMN reversal_of INTEGER`, // Set on the compensating entry of a voided transaction
+		`ALTER TABLE stock_transactions ADD COLUMN voided_at DATETIME`,  // Set on the original when it has been voided
+	)
+}
+
+// addAdjustments adds the 'adjustment' transaction type with its reason and counted quantity.
+// SQLite cannot alter a CHECK constraint, so stock_transactions is rebuilt.
+func addAdjustments(tx *sql.Tx) error {
+	err := execAll(tx,
+		`ALTER TABLE stock_transactions ADD COLUMN reason_code TEXT`,      // damage, shrinkage or count_correction
+		`ALTER TABLE stock_transactions ADD COLUMN counted_quantity REAL`, // The physically counted quantity
+		`ALTER TABLE inventory_summary ADD COLUMN total_adjustment REAL DEFAULT 0`,
+		`ALTER TABLE period_balances ADD COLUMN total_adjustment REAL DEFAULT 0`,
+	)
+	if err != nil {
+		return err
+	}
+	return rebuildTable(tx, "stock_transactions", `
+		CREATE TABLE stock_transactions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			product_id INTEGER,
+			transaction_type TEXT CHECK(transaction_type IN ('in','out','adjustment')) NOT NULL,
+			quantity REAL NOT NULL,
+			price_per_unit REAL,
+			total_value REAL,
+			department TEXT,
+			transaction_timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+			notes TEXT,
+			reversal_of INTEGER,
+			voided_at DATETIME,
+			reason_code TEXT,
+			counted_quantity REAL,
+			FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE
+		)`)
+}
+
+// addCountSessions creates the cycle counts of a set of products or a category, with one line
+// per product
+func addCountSessions(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TABLE count_sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			category TEXT,
+			status TEXT CHECK(status IN ('open','submitted','approved','cancelled')) NOT NULL DEFAULT 'open',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			approved_at DATETIME,
+			approved_by TEXT
+		)`,
+		`CREATE TABLE count_lines (
+			session_id INTEGER NOT NULL,
+			product_id INTEGER NOT NULL,
+			counted_quantity REAL,              -- NULL until the product has been counted
+			counted_by TEXT,
+			counted_at DATETIME,
+			system_quantity REAL,               -- Stored on submission
+			average_price REAL,                 -- Stored on submission
+			PRIMARY KEY(session_id, product_id),
+			FOREIGN KEY(session_id) REFERENCES count_sessions(id) ON DELETE CASCADE,
+			FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE
+		)`,
+	)
+}
+
+// addLocations creates the warehouses and stores that hold stock and the stock of each product
+// at each of them. Existing stock is all in the main warehouse; summaries of products that no
+// longer exist are left to repair-orphans.
+func addLocations(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TABLE locations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code TEXT NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// The main warehouse always exists; transactions without a location are recorded there
+		`INSERT INTO locations (id, code, name, created_at) VALUES (1, 'MAIN', 'Main warehouse', CURRENT_TIMESTAMP)`,
+		`CREATE TABLE location_stock (
+			product_id INTEGER NOT NULL,
+			location_id INTEGER NOT NULL,
+			total_in REAL DEFAULT 0,
+			total_out REAL DEFAULT 0,
+			total_adjustment REAL DEFAULT 0,
+			ending_stock REAL DEFAULT 0,
+			average_price REAL DEFAULT 0,
+			PRIMARY KEY(product_id, location_id),
+			FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE,
+			FOREIGN KEY(location_id) REFERENCES locations(id)
+		)`,
+		`ALTER TABLE stock_transactions ADD COLUMN location_id INTEGER NOT NULL DEFAULT 1`,
+		`ALTER TABLE count_sessions ADD COLUMN location_id INTEGER NOT NULL DEFAULT 1`,
+		`INSERT INTO location_stock (product_id, location_id, total_in, total_out, total_adjustment, ending_stock, average_price)
+		SELECT product_id, 1, total_in, total_out, total_adjustment, ending_stock, average_price FROM inventory_summary
+		WHERE product_id IN (SELECT id FROM products)`,
+	)
+}
+
+// addTransfers creates the transfers of stock between locations, in transit until received,
+// and adds their transaction types. stock_transactions is rebuilt for the new CHECK constraint.
+func addTransfers(tx *sql.Tx) error {
+	err := execAll(tx,
+		`CREATE TABLE transfers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			product_id INTEGER NOT NULL,
+			from_location_id INTEGER NOT NULL,
+			to_location_id INTEGER NOT NULL,
+			quantity REAL NOT NULL,
+			average_price REAL DEFAULT 0,       -- Source average price at dispatch, carried to the destination
+			status TEXT CHECK(status IN ('in_transit','received','cancelled')) NOT NULL DEFAULT 'in_transit',
+			notes TEXT,
+			dispatched_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			received_at DATETIME,
+			out_transaction_id INTEGER,
+			in_transaction_id INTEGER,
+			FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE,
+			FOREIGN KEY(from_location_id) REFERENCES locations(id),
+			FOREIGN KEY(to_location_id) REFERENCES locations(id)
+		)`,
+		`ALTER TABLE stock_transactions ADD COLUMN transfer_id INTEGER`,
+	)
+	if err != nil {
+		return err
+	}
+	return rebuildTable(tx, "stock_transactions", `
+		CREATE TABLE stock_transactions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			product_id INTEGER,
+			location_id INTEGER NOT NULL DEFAULT 1, -- Defaults to the main warehouse
+			transaction_type TEXT CHECK(transaction_type IN ('in','out','adjustment','transfer_out','transfer_in')) NOT NULL,
+			quantity REAL NOT NULL,
+			price_per_unit REAL,
+			total_value REAL,
+			department TEXT,
+			transaction_timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+			notes TEXT,
+			reversal_of INTEGER,                -- Set on the compensating entry of a voided transaction
+			voided_at DATETIME,                 -- Set on the original when it has been voided
+			reason_code TEXT,                   -- Adjustments: damage, shrinkage or count_correction
+			counted_quantity REAL,              -- Adjustments: the physically counted quantity
+			transfer_id INTEGER,                -- Transfers: the transfer this entry belongs to
+			FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE
+		)`)
+}
+
+// addStockDocuments creates goods receipts and issue slips, whose lines are ledger entries
+func addStockDocuments(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TABLE stock_documents (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			document_number TEXT UNIQUE,
+			document_type TEXT CHECK(document_type IN ('receipt','issue')) NOT NULL,
+			document_date DATETIME NOT NULL,
+			location_id INTEGER NOT NULL DEFAULT 1,
+			department TEXT,
+			supplier TEXT,
+			notes TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY(location_id) REFERENCES locations(id)
+		)`,
+		`ALTER TABLE stock_transactions ADD COLUMN document_id INTEGER`, // The stock document a line belongs to
+	)
+}
+
+// addLots records the lot or batch of a movement and the lot's expiry date
+func addLots(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE stock_transactions ADD COLUMN lot_number TEXT`,
+		`ALTER TABLE stock_transactions ADD COLUMN expiry_date TEXT`, // YYYY-MM-DD
+	)
+}
+
+// addSerialNumbers tracks every unit of a serialized product and the units each movement moved
+func addSerialNumbers(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE products ADD COLUMN serialized INTEGER NOT NULL DEFAULT 0`,
+		`CREATE TABLE serial_numbers (
+			product_id INTEGER NOT NULL,
+			serial_number TEXT NOT NULL,
+			status TEXT CHECK(status IN ('in_stock','in_transit','out')) NOT NULL,
+			location_id INTEGER,                -- Where the unit is, while it is in stock
+			PRIMARY KEY(product_id, serial_number),
+			FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE,
+			FOREIGN KEY(location_id) REFERENCES locations(id)
+		)`,
+		`CREATE TABLE transaction_serials (
+			transaction_id INTEGER NOT NULL,
+			product_id INTEGER NOT NULL,
+			serial_number TEXT NOT NULL,
+			PRIMARY KEY(transaction_id, serial_number),
+			FOREIGN KEY(transaction_id) REFERENCES stock_transactions(id) ON DELETE CASCADE
+		)`,
+	)
+}
+
+// addCosting records the cost movements are booked at and the value of the stock on hand,
+// with the receipt layers FIFO costing consumes. Existing stock is valued at its average price.
+// Existing movements are left uncosted here; services.BackfillCosts costs them from the ledger
+// when the server starts or "migrate up" finishes.
+func addCosting(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE products ADD COLUMN costing_method TEXT`,       // moving_average or fifo; NULL uses the global default
+		`ALTER TABLE stock_transactions ADD COLUMN unit_cost REAL`,  // Cost per unit the movement was booked at
+		`ALTER TABLE stock_transactions ADD COLUMN cost_total REAL`, // For a stock-out, the cost of goods issued
+		`ALTER TABLE inventory_summary ADD COLUMN stock_value REAL DEFAULT 0`,
+		`ALTER TABLE location_stock ADD COLUMN stock_value REAL DEFAULT 0`,
+		`UPDATE inventory_summary SET stock_value = MAX(ending_stock, 0) * average_price`,
+		`UPDATE location_stock SET stock_value = MAX(ending_stock, 0) * average_price`,
+		`CREATE TABLE cost_layers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, -- Layers are consumed in id order
+			product_id INTEGER NOT NULL,
+			transaction_id INTEGER NOT NULL,    -- The receipt, or 0 for stock on hand before FIFO costing
+			quantity REAL NOT NULL,             -- Remaining quantity
+			unit_cost REAL NOT NULL,
+			FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE
+		)`,
+	)
+}
+
+// addStockCheckpoints creates the monthly snapshots of the balances replayed from the ledger,
+// which point-in-time lookups replay forward from by timestamp
+func addStockCheckpoints(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TABLE stock_checkpoints (
+			checkpoint_date TEXT NOT NULL,      -- YYYY-MM-DD; balances of every ledger entry before this day
+			product_id INTEGER NOT NULL,
+			location_id INTEGER NOT NULL,       -- 0 for the company-wide balance
+			ending_stock REAL NOT NULL,
+			average_price REAL NOT NULL,
+			stock_value REAL NOT NULL,
+			PRIMARY KEY(checkpoint_date, product_id, location_id)
+		)`,
+		`CREATE INDEX idx_stock_transactions_timestamp ON stock_transactions(transaction_timestamp)`,
+	)
+}
+
+// addTransactionIndexes indexes the columns the transaction listing filters and pages by
+func addTransactionIndexes(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE INDEX idx_stock_transactions_product ON stock_transactions(product_id, transaction_timestamp)`,
+		`CREATE INDEX idx_stock_transactions_department ON stock_transactions(department, transaction_timestamp)`,
+		`CREATE INDEX idx_stock_transactions_quantity ON stock_transactions(quantity)`,
+	)
+}
+
+// addProductSearch creates the full-text index over the code, name and description of
+// products, kept in step with the products table by triggers
+func addProductSearch(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE VIRTUAL TABLE products_fts USING fts5(
+			code, name, description, content='products', content_rowid='id'
+		)`,
+		`CREATE TRIGGER products_fts_insert AFTER INSERT ON products BEGIN
+			INSERT INTO products_fts (rowid, code, name, description) VALUES (new.id, new.code, new.name, new.description);
+		END`,
+		`CREATE TRIGGER products_fts_delete AFTER DELETE ON products BEGIN
+			INSERT INTO products_fts (products_fts, rowid, code, name, description) VALUES ('delete', old.id, old.code, old.name, old.description);
+		END`,
+		`CREATE TRIGGER products_fts_update AFTER UPDATE ON products BEGIN
+			INSERT INTO products_fts (products_fts, rowid, code, name, description) VALUES ('delete', old.id, old.code, old.name, old.description);
+			INSERT INTO products_fts (rowid, code, name, description) VALUES (new.id, new.code, new.name, new.description);
+		END`,
+		// Existing products are indexed once
+		`INSERT INTO products_fts (products_fts) VALUES ('rebuild')`,
+	)
+}
+
+// addCategories creates the tree of product categories. The free-text categories of existing
+// products become root categories.
+func addCategories(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TABLE categories (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			parent_id INTEGER,                  -- NULL for a root category
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY(parent_id) REFERENCES categories(id)
+		)`,
+		// Sibling categories have distinct names
+		`CREATE UNIQUE INDEX idx_categories_name ON categories(COALESCE(parent_id, 0), name)`,
+		`ALTER TABLE products ADD COLUMN category_id INTEGER REFERENCES categories(id)`,
+		`INSERT INTO categories (name)
+		SELECT DISTINCT category FROM products WHERE COALESCE(category, '') <> ''`,
+		`UPDATE products SET category_id = (SELECT c.id FROM categories c WHERE c.parent_id IS NULL AND c.name = products.category)
+		WHERE COALESCE(category, '') <> ''`,
+	)
+}
+
+// addArchiving lets products be archived: they keep their history but take no new transactions
+func addArchiving(tx *sql.Tx) error {
+	return execAll(tx, `ALTER TABLE products ADD COLUMN archived_at DATETIME`)
+}
+
+// addLocationCostLayers keeps FIFO layers at the location holding their units, so a location's
+// stock is costed from its own receipts, and has transfers record the cost they move stock at.
+// Existing layers stay at the location they were received at, and transfers posted so far are
+// left uncosted, so they replay at the prices they were posted with, and the checkpoints
+// replayed with their old costs are discarded. The SQL runs on both databases.
+func addLocationCostLayers(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE cost_layers ADD COLUMN location_id INTEGER NOT NULL DEFAULT 1`,
+		`UPDATE cost_layers SET location_id = COALESCE((SELECT location_id FROM stock_transactions WHERE id = cost_layers.transaction_id), 1)`,
+		`UPDATE stock_transactions SET unit_cost = NULL, cost_total = NULL WHERE transaction_type IN ('transfer_in', 'transfer_out')`,
+		`DELETE FROM stock_checkpoints`,
+	)
+}
+
+// storedTimestampLayouts are the ways SQLite has been sent timestamps: by the driver (Go's
+// time.String, with the poster's offset), as RFC 3339, by CURRENT_TIMESTAMP and as a date
+var storedTimestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999-07:00",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	models.TimestampLayout,
+	"2006-01-02",
+}
+
+// parseStoredTimestamp parses a timestamp in any of storedTimestampLayouts, ignoring the
+// monotonic clock reading time.String appends. Timestamps without an offset are in UTC.
+func parseStoredTimestamp(value string) (time.Time, error) {
+	value, _, _ = strings.Cut(value, " m=")
+	for _, layout := range storedTimestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised timestamp %q", value)
+}
+
+// rewriteLedgerTimestamps rewrites the ledger's timestamps, stored with the offset of whoever
+// posted them, in UTC in models.TimestampLayout as they are written now, so old and new rows
+// compare correctly as text. The checkpoints replayed with the old order are discarded.
+// PostgreSQL stores timestamps as such and needs no rewrite.
+func rewriteLedgerTimestamps(tx *sql.Tx) error {
+	columns := []struct{ table, column string }{
+		{"stock_transactions", "transaction_timestamp"},
+		{"stock_transactions", "voided_at"},
+		{"transfers", "dispatched_at"},
+		{"transfers", "received_at"},
+		{"stock_documents", "document_date"},
+		{"count_sessions", "approved_at"},
+	}
+	for _, c := range columns {
+		rows, err := tx.Query(`SELECT rowid, CAST(` + c.column + ` AS TEXT) FROM ` + c.table + ` WHERE ` + c.column + ` IS NOT NULL`)
+		if err != nil {
+			return err
+		}
+		stored := map[int64]string{}
+		for rows.Next() {
+			var rowid int64
+			var value string
+			if err := rows.Scan(&rowid, &value); err != nil {
+				rows.Close()
+				return err
+			}
+			stored[rowid] = value
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for rowid, value := range stored {
+			t, err := parseStoredTimestamp(value)
+			if err != nil {
+				return fmt.Errorf("%s.%s of row %d: %w", c.table, c.column, rowid, err)
+			}
+			if utc := t.UTC().Format(models.TimestampLayout); utc != value {
+				if _, err := tx.Exec(`UPDATE `+c.table+` SET `+c.column+` = ? WHERE rowid = ?`, utc, rowid); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return execAll(tx, `DELETE FROM stock_checkpoints`)
+}
+
+// execAll runs the statements of a migration in order
+func execAll(tx *sql.Tx, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildTable recreates table from createStatement, copying every row across. It needs
+// foreign keys off and legacy renames, so only migrations marked rebuild may call it.
+func rebuildTable(tx *sql.Tx, table, createStatement string) error {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		columns = append(columns, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	columnList := strings.Join(columns, ", ")
+
+	return execAll(tx,
+		"ALTER TABLE "+table+" RENAME TO "+table+"_old",
+		createStatement,
+		"INSERT INTO "+table+" ("+columnList+") SELECT "+columnList+" FROM "+table+"_old",
+		"DROP TABLE "+table+"_old",
+	)
+}
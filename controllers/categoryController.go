@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"inventory-app/models"
+	"inventory-app/store"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CategoryHandler serves the category endpoints from a CategoryStore
+type CategoryHandler struct {
+	Categories store.CategoryStore
+}
+
+// NewCategoryHandler returns a CategoryHandler backed by categories
+func NewCategoryHandler(categories store.CategoryStore) *CategoryHandler {
+	return &CategoryHandler{Categories: categories}
+}
+
+// findCategory returns the category with the given id from a loaded list
+func findCategory(categories []models.Category, id int) (models.Category, bool) {
+	for _, category := range categories {
+		if category.ID == id {
+			return category, true
+		}
+	}
+	return models.Category{}, false
+}
+
+// CreateCategory adds a category, at the root or under the given parent_id
+func (h *CategoryHandler) CreateCategory(c *gin.Context) {
+	var category models.Category
+	if err := c.ShouldBindJSON(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(category.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+
+	if err := h.Categories.CreateCategory(&category); err != nil {
+		respondError(c, err, "Failed to create category")
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+// ListCategories returns every category with its path from the root, parents before children
+func (h *CategoryHandler) ListCategories(c *gin.Context) {
+	categories, err := h.Categories.ListCategories()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, categories)
+}
+
+// GetCategory returns a category and its direct subcategories
+func (h *CategoryHandler) GetCategory(c *gin.Context) {
+	id, ok := pathID(c, "category")
+	if !ok {
+		return
+	}
+	categories, err := h.Categories.ListCategories()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	category, ok := findCategory(categories, id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	children := []models.Category{}
+	for _, child := range categories {
+		if child.ParentID != nil && *child.ParentID == category.ID {
+			children = append(children, child)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"category": category, "children": children})
+}
+
+// UpdateCategory renames a category and moves it under another parent (or to the root). A
+// category cannot be moved under itself or one of its subcategories.
+func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
+	id, ok := pathID(c, "category")
+	if !ok {
+		return
+	}
+	var request models.Category
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(request.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+
+	if err := h.Categories.UpdateCategory(id, request); err != nil {
+		respondError(c, err, "Failed to update category")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category updated successfully"})
+}
+
+// DeleteCategory removes a category that has no subcategories and no products
+func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
+	id, ok := pathID(c, "category")
+	if !ok {
+		return
+	}
+
+	if err := h.Categories.DeleteCategory(id); err != nil {
+		respondError(c, err, "Failed to delete category")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"inventory-app/config"
+	"inventory-app/internal/pgtest"
+	"inventory-app/services"
+	"inventory-app/store"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// openTestDB opens a migrated SQLite database of the test's own
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := config.Open(t.TempDir() + "/inventory.db")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// openLegacyTestDB migrates a copy of the committed inventory.db, a database from before
+// migrations existed
+func openLegacyTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	data, err := os.ReadFile("../inventory.db")
+	if err != nil {
+		t.Fatalf("read legacy database: %v", err)
+	}
+	path := t.TempDir() + "/inventory.db"
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("copy legacy database: %v", err)
+	}
+	db, err := config.Open(path)
+	if err != nil {
+		t.Fatalf("open legacy database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestServer routes the product, location, transaction, transfer, inventory, cycle count and
+// period endpoints to handlers backed by a database of the test's own
+func newTestServer(t *testing.T) *gin.Engine {
+	t.Helper()
+	return newTestRouter(openTestDB(t))
+}
+
+// forEachDatabase runs test against a router backed by a fresh SQLite database and, when
+// TEST_DATABASE_URL is set, a fresh PostgreSQL schema
+func forEachDatabase(t *testing.T, test func(t *testing.T, router *gin.Engine, db *sql.DB)) {
+	t.Run("sqlite", func(t *testing.T) {
+		db := openTestDB(t)
+		test(t, newTestRouter(db), db)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		db := pgtest.Open(t, config.OpenPostgres)
+		test(t, newStoreRouter(db, store.NewPostgres(db)), db)
+	})
+}
+
+// newTestRouter routes the endpoints of newTestServer to handlers backed by the SQLite database db
+func newTestRouter(db *sql.DB) *gin.Engine {
+	return newStoreRouter(db, store.NewSQLite(db))
+}
+
+// newStoreRouter routes the endpoints of newTestServer to handlers backed by stores on db
+func newStoreRouter(db *sql.DB, stores store.Store) *gin.Engine {
+	ledger := services.NewDatabase(db)
+	products := NewProductHandler(stores)
+	locations := NewLocationHandler(stores)
+	transactions := NewTransactionHandler(stores, ledger)
+	transfers := NewTransferHandler(stores, ledger)
+	inventory := NewInventoryHandler(stores, stores, ledger)
+	counts := NewCountHandler(stores, ledger)
+	periods := NewPeriodHandler(stores, ledger)
+	reports := NewReportHandler(stores)
+	documents := NewDocumentHandler(stores, ledger)
+	stockCards := NewStockCardHandler(stores, stores, ledger)
+
+	router := gin.New()
+	router.POST("/products", products.CreateProduct)
+	router.GET("/products", products.ListProducts)
+	router.GET("/products/:id", products.GetProductByID)
+	router.PUT("/products/:id", products.UpdateProduct)
+	router.DELETE("/products/:id", products.DeleteProduct)
+	router.POST("/products/:id/archive", products.ArchiveProduct)
+	router.POST("/products/:id/restore", products.RestoreProduct)
+	router.GET("/products/:id/ledger", stockCards.GetProductLedger)
+	router.POST("/locations", locations.CreateLocation)
+	router.POST("/transactions", transactions.CreateStockTransaction)
+	router.GET("/transactions", transactions.ListStockTransactions)
+	router.GET("/transactions/by-date", transactions.GetTransactionsByDate)
+	router.POST("/transactions/:id/void", transactions.VoidStockTransaction)
+	router.POST("/transfers", transfers.CreateTransfer)
+	router.POST("/documents", documents.CreateStockDocument)
+	router.GET("/documents/:id", documents.GetStockDocument)
+	router.GET("/transfers/:id", transfers.GetTransfer)
+	router.POST("/transfers/:id/receive", transfers.ReceiveTransfer)
+	router.POST("/transfers/:id/cancel", transfers.CancelTransfer)
+	router.GET("/inventory/summary", inventory.GetInventorySummary)
+	router.GET("/inventory/summary/monthly", inventory.GetMonthlyInventorySummary)
+	router.GET("/inventory/as-of", inventory.GetStockAsOf)
+	router.GET("/inventory/lots", inventory.GetLotBalances)
+	router.GET("/inventory/expiring", inventory.GetExpiringLots)
+	router.POST("/inventory/rebuild", inventory.RebuildInventorySummary)
+	router.GET("/inventory/integrity", inventory.GetIntegrityReport)
+	router.POST("/counts", counts.CreateCountSession)
+	router.PUT("/counts/:id/lines", counts.RecordCounts)
+	router.POST("/counts/:id/submit", counts.SubmitCountSession)
+	router.GET("/counts/:id/variances", counts.GetCountVariances)
+	router.POST("/counts/:id/approve", counts.ApproveCountSession)
+	router.POST("/periods/:period/close", periods.ClosePeriod)
+	router.POST("/periods/:period/reopen", periods.ReopenPeriod)
+	router.GET("/reports/department-consumption", reports.GetDepartmentConsumption)
+	return router
+}
+
+// createTestProduct creates a product through router and returns its ID
+func createTestProduct(t *testing.T, router *gin.Engine, code string) int {
+	t.Helper()
+	var product struct {
+		ID int `json:"id"`
+	}
+	body := gin.H{"code": code, "name": code, "unit": "pcs"}
+	if status := serve(t, router, "POST", "/products", body, &product); status != http.StatusCreated {
+		t.Fatalf("create product %s: status = %d", code, status)
+	}
+	return product.ID
+}
+
+// serve sends a request with an optional JSON body to router and decodes the JSON response into out
+func serve(t *testing.T, router *gin.Engine, method, path string, body any, out any) int {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encode request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	request := httptest.NewRequest(method, path, reader)
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	if out != nil {
+		if err := json.Unmarshal(response.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode response %q: %v", method, path, response.Body.String(), err)
+		}
+	}
+	return response.Code
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"inventory-app/services"
+	"inventory-app/store"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CountHandler serves the cycle count endpoints. Sessions are kept in a CountStore and approved
+// counts are posted through a CountPosting.
+type CountHandler struct {
+	Counts  store.CountStore
+	Posting services.CountPosting
+}
+
+// NewCountHandler returns a CountHandler backed by counts, posting approvals through posting
+func NewCountHandler(counts store.CountStore, posting services.CountPosting) *CountHandler {
+	return &CountHandler{Counts: counts, Posting: posting}
+}
+
+// CreateCountSession starts a cycle count at a location for a list of products or for every
+// product in a category
+func (h *CountHandler) CreateCountSession(c *gin.Context) {
+	type CreateCountRequest struct {
+		Name       string `json:"name"`
+		ProductIDs []int  `json:"product_ids"`
+		Category   string `json:"category"`
+		LocationID int    `json:"location_id"`
+	}
+
+	var request CreateCountRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	if (len(request.ProductIDs) == 0) == (request.Category == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either product_ids or a category"})
+		return
+	}
+
+	session, err := h.Counts.CreateCountSession(store.NewCountSession{
+		Name:       request.Name,
+		ProductIDs: request.ProductIDs,
+		Category:   request.Category,
+		LocationID: request.LocationID,
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create count session")
+		return
+	}
+
+	c.JSON(http.StatusCreated, session)
+}
+
+// ListCountSessions returns every count session without its lines
+func (h *CountHandler) ListCountSessions(c *gin.Context) {
+	sessions, err := h.Counts.ListCountSessions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// GetCountSession returns a count session and its lines. System quantities are never included.
+func (h *CountHandler) GetCountSession(c *gin.Context) {
+	id, ok := pathID(c, "count session")
+	if !ok {
+		return
+	}
+
+	session, err := h.Counts.GetCountSession(id)
+	if err != nil {
+		respondError(c, err, "Failed to get count session")
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// RecordCounts stores counted quantities for products of an open count session
+func (h *CountHandler) RecordCounts(c *gin.Context) {
+	id, ok := pathID(c, "count session")
+	if !ok {
+		return
+	}
+
+	type RecordCountsRequest struct {
+		CountedBy string             `json:"counted_by"`
+		Counts    []store.CountEntry `json:"counts"`
+	}
+
+	var request RecordCountsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(request.Counts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one count is required"})
+		return
+	}
+
+	session, err := h.Counts.RecordCounts(id, request.CountedBy, request.Counts)
+	if err != nil {
+		respondError(c, err, "Failed to record counts")
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// SubmitCountSession closes counting once every product has been counted, revealing the variances
+func (h *CountHandler) SubmitCountSession(c *gin.Context) {
+	id, ok := pathID(c, "count session")
+	if !ok {
+		return
+	}
+
+	if err := h.Counts.SubmitCountSession(id); err != nil {
+		respondError(c, err, "Failed to submit count session")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Count session submitted for approval"})
+}
+
+// GetCountVariances returns the variances of a submitted or approved count session
+func (h *CountHandler) GetCountVariances(c *gin.Context) {
+	id, ok := pathID(c, "count session")
+	if !ok {
+		return
+	}
+
+	status, variances, err := h.Counts.CountVariances(id)
+	if err != nil {
+		respondError(c, err, "Failed to get count variances")
+		return
+	}
+
+	totalValue := 0.0
+	for _, v := range variances {
+		totalValue += v.VarianceValue
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":               status,
+		"variances":            variances,
+		"total_variance_value": totalValue,
+	})
+}
+
+// ApproveCountSession posts an adjustment into the ledger for every line with a variance
+func (h *CountHandler) ApproveCountSession(c *gin.Context) {
+	id, ok := pathID(c, "count session")
+	if !ok {
+		return
+	}
+
+	type ApproveRequest struct {
+		ApprovedBy string `json:"approved_by"`
+		ReasonCode string `json:"reason_code"`
+	}
+
+	var request ApproveRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if request.ReasonCode == "" {
+		request.ReasonCode = "count_correction"
+	}
+	if !adjustmentReasons[request.ReasonCode] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reason code (expected damage, shrinkage or count_correction)"})
+		return
+	}
+
+	adjustments, err := h.Posting.ApproveCountSession(id, request.ApprovedBy, request.ReasonCode)
+	if err != nil {
+		respondError(c, err, "Failed to approve count session")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Count session approved",
+		"adjustments": adjustments,
+	})
+}
+
+// CancelCountSession abandons a count session that has not been approved
+func (h *CountHandler) CancelCountSession(c *gin.Context) {
+	id, ok := pathID(c, "count session")
+	if !ok {
+		return
+	}
+
+	if err := h.Counts.CancelCountSession(id); err != nil {
+		respondError(c, err, "Failed to cancel count session")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Count session cancelled"})
+}
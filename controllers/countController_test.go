@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCountSessionApproval(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+
+		in := gin.H{"product_id": productID, "transaction_type": "in", "quantity": 10, "price_per_unit": 2}
+		if status := serve(t, router, "POST", "/transactions", in, nil); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+
+		var session models.CountSession
+		create := gin.H{"name": "Shelf A", "product_ids": []int{productID}}
+		if status := serve(t, router, "POST", "/counts", create, &session); status != http.StatusCreated {
+			t.Fatalf("create session: status = %d", status)
+		}
+		base := fmt.Sprintf("/counts/%d", session.ID)
+
+		if status := serve(t, router, "POST", base+"/approve", nil, nil); status != http.StatusConflict {
+			t.Errorf("approve open session: status = %d, want %d", status, http.StatusConflict)
+		}
+		if status := serve(t, router, "GET", base+"/variances", nil, nil); status != http.StatusConflict {
+			t.Errorf("variances of open session: status = %d, want %d", status, http.StatusConflict)
+		}
+
+		lines := gin.H{"counted_by": "ana", "counts": []gin.H{{"product_id": productID, "counted_quantity": 9}}}
+		if status := serve(t, router, "PUT", base+"/lines", lines, nil); status != http.StatusOK {
+			t.Fatalf("record counts: status = %d", status)
+		}
+		if status := serve(t, router, "POST", base+"/submit", nil, nil); status != http.StatusOK {
+			t.Fatalf("submit: status = %d", status)
+		}
+
+		var approved struct {
+			Error       string                    `json:"error"`
+			Adjustments []models.StockTransaction `json:"adjustments"`
+		}
+		if status := serve(t, router, "POST", base+"/approve", gin.H{"approved_by": "lead"}, &approved); status != http.StatusOK {
+			t.Fatalf("approve: status = %d (%s)", status, approved.Error)
+		}
+		if len(approved.Adjustments) != 1 || approved.Adjustments[0].Quantity != -1 {
+			t.Errorf("adjustments = %+v, want one of -1", approved.Adjustments)
+		}
+
+		if status := serve(t, router, "GET", "/counts/abc/variances", nil, nil); status != http.StatusBadRequest {
+			t.Errorf("non-numeric session: status = %d, want %d", status, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestCountApprovalPostsSubmittedVariance(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+
+		receive := gin.H{"product_id": productID, "transaction_type": "in", "quantity": 10, "price_per_unit": 2}
+		if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+
+		var session models.CountSession
+		create := gin.H{"name": "Shelf A", "product_ids": []int{productID}}
+		if status := serve(t, router, "POST", "/counts", create, &session); status != http.StatusCreated {
+			t.Fatalf("create session: status = %d", status)
+		}
+		base := fmt.Sprintf("/counts/%d", session.ID)
+		lines := gin.H{"counts": []gin.H{{"product_id": productID, "counted_quantity": 9}}}
+		if status := serve(t, router, "PUT", base+"/lines", lines, nil); status != http.StatusOK {
+			t.Fatalf("record counts: status = %d", status)
+		}
+		if status := serve(t, router, "POST", base+"/submit", nil, nil); status != http.StatusOK {
+			t.Fatalf("submit: status = %d", status)
+		}
+
+		// Stock received after the count was submitted is not part of the variance
+		if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusCreated {
+			t.Fatalf("second stock-in: status = %d", status)
+		}
+
+		var variances struct {
+			Variances []models.CountVariance `json:"variances"`
+		}
+		if status := serve(t, router, "GET", base+"/variances", nil, &variances); status != http.StatusOK {
+			t.Fatalf("variances: status = %d", status)
+		}
+		if len(variances.Variances) != 1 || variances.Variances[0].Variance != -1 {
+			t.Errorf("variances = %+v, want one of -1", variances.Variances)
+		}
+
+		var approved struct {
+			Adjustments []models.StockTransaction `json:"adjustments"`
+		}
+		if status := serve(t, router, "POST", base+"/approve", nil, &approved); status != http.StatusOK {
+			t.Fatalf("approve: status = %d", status)
+		}
+		if len(approved.Adjustments) != 1 || approved.Adjustments[0].Quantity != -1 {
+			t.Fatalf("adjustments = %+v, want one of -1", approved.Adjustments)
+		}
+
+		// 10 - 1 + 10 leaves 19 on hand
+		var issued postedTransaction
+		issue := gin.H{"product_id": productID, "transaction_type": "out", "quantity": 19}
+		if status := serve(t, router, "POST", "/transactions", issue, &issued); status != http.StatusCreated {
+			t.Fatalf("stock-out: status = %d (%s)", status, issued.Error)
+		}
+		if issued.InventoryUpdate.CurrentStock != 0 {
+			t.Errorf("stock after issuing 19 = %v, want 0", issued.InventoryUpdate.CurrentStock)
+		}
+	})
+}
+
+func TestCountApprovalRejectsNegativeStock(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+
+		receive := gin.H{"product_id": productID, "transaction_type": "in", "quantity": 10, "price_per_unit": 2}
+		if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+
+		var session models.CountSession
+		create := gin.H{"name": "Shelf A", "product_ids": []int{productID}}
+		if status := serve(t, router, "POST", "/counts", create, &session); status != http.StatusCreated {
+			t.Fatalf("create session: status = %d", status)
+		}
+		base := fmt.Sprintf("/counts/%d", session.ID)
+		lines := gin.H{"counts": []gin.H{{"product_id": productID, "counted_quantity": 8}}}
+		if status := serve(t, router, "PUT", base+"/lines", lines, nil); status != http.StatusOK {
+			t.Fatalf("record counts: status = %d", status)
+		}
+		if status := serve(t, router, "POST", base+"/submit", nil, nil); status != http.StatusOK {
+			t.Fatalf("submit: status = %d", status)
+		}
+
+		// Issuing 9 of the 10 leaves 1, which the variance of -2 would take to -1
+		issue := gin.H{"product_id": productID, "transaction_type": "out", "quantity": 9}
+		if status := serve(t, router, "POST", "/transactions", issue, nil); status != http.StatusCreated {
+			t.Fatalf("stock-out: status = %d", status)
+		}
+		if status := serve(t, router, "POST", base+"/approve", nil, nil); status != http.StatusBadRequest {
+			t.Errorf("approve: status = %d, want %d", status, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestSerializedProductsAreNotCountedOrAdjusted(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		plainID := createTestProduct(t, router, "P-1")
+		var serialized struct {
+			ID int `json:"id"`
+		}
+		body := gin.H{"code": "S-1", "name": "Scanner", "unit": "pcs", "category": "Tools", "serialized": true}
+		if status := serve(t, router, "POST", "/products", body, &serialized); status != http.StatusCreated {
+			t.Fatalf("create serialized product: status = %d", status)
+		}
+		body = gin.H{"code": "P-2", "name": "Cable", "unit": "pcs", "category": "Tools"}
+		if status := serve(t, router, "POST", "/products", body, nil); status != http.StatusCreated {
+			t.Fatalf("create product: status = %d", status)
+		}
+
+		receive := gin.H{"product_id": serialized.ID, "transaction_type": "in", "quantity": 2, "price_per_unit": 50,
+			"serial_numbers": []string{"SN-1", "SN-2"}}
+		if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+
+		adjust := gin.H{"product_id": serialized.ID, "transaction_type": "adjustment", "counted_quantity": 1, "reason_code": "damage"}
+		if status := serve(t, router, "POST", "/transactions", adjust, nil); status != http.StatusBadRequest {
+			t.Errorf("adjust serialized product: status = %d, want %d", status, http.StatusBadRequest)
+		}
+
+		create := gin.H{"name": "Shelf A", "product_ids": []int{plainID, serialized.ID}}
+		if status := serve(t, router, "POST", "/counts", create, nil); status != http.StatusBadRequest {
+			t.Errorf("count serialized product: status = %d, want %d", status, http.StatusBadRequest)
+		}
+
+		// A category count leaves the serialized product out
+		var session models.CountSession
+		if status := serve(t, router, "POST", "/counts", gin.H{"name": "Tools", "category": "Tools"}, &session); status != http.StatusCreated {
+			t.Fatalf("create category session: status = %d", status)
+		}
+		if len(session.Lines) != 1 || session.Lines[0].ProductID == serialized.ID {
+			t.Errorf("lines = %+v, want only the unserialized product", session.Lines)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"inventory-app/models"
+	"inventory-app/services"
+	"inventory-app/store"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DocumentHandler serves the stock document endpoints. Documents are read from a DocumentStore
+// and posted to the ledger through a DocumentPosting.
+type DocumentHandler struct {
+	Documents store.DocumentStore
+	Posting   services.DocumentPosting
+}
+
+// NewDocumentHandler returns a DocumentHandler backed by documents, posting through posting
+func NewDocumentHandler(documents store.DocumentStore, posting services.DocumentPosting) *DocumentHandler {
+	return &DocumentHandler{Documents: documents, Posting: posting}
+}
+
+// CreateStockDocument records a goods receipt or issue slip. Every line is posted to the ledger
+// inside one database transaction: if any line fails, nothing is recorded.
+func (h *DocumentHandler) CreateStockDocument(c *gin.Context) {
+	var document models.StockDocument
+	if err := c.ShouldBindJSON(&document); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transactionType, ok := services.DocumentTransactionTypes[document.DocumentType]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document type (expected receipt or issue)"})
+		return
+	}
+	if len(document.Lines) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A document needs at least one line"})
+		return
+	}
+	for i, line := range document.Lines {
+		if line.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Line %d: quantity must be greater than 0", i+1)})
+			return
+		}
+		if line.ExpiryDate != "" {
+			if _, err := time.Parse("2006-01-02", line.ExpiryDate); err != nil || line.LotNumber == "" || transactionType != "in" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Line %d: expiry_date must be YYYY-MM-DD and needs a lot_number on a receipt", i+1)})
+				return
+			}
+		}
+	}
+
+	if err := h.Posting.CreateStockDocument(&document); err != nil {
+		respondError(c, err, "Failed to record document")
+		return
+	}
+
+	c.JSON(http.StatusCreated, document)
+}
+
+// ListStockDocuments retrieves document headers, optionally filtered with ?type=receipt|issue
+func (h *DocumentHandler) ListStockDocuments(c *gin.Context) {
+	documents, err := h.Documents.ListDocuments(c.Query("type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, documents)
+}
+
+// GetStockDocument retrieves a document with its lines
+func (h *DocumentHandler) GetStockDocument(c *gin.Context) {
+	id, ok := pathID(c, "document")
+	if !ok {
+		return
+	}
+
+	document, err := h.Documents.GetDocument(id)
+	if err != nil {
+		respondError(c, err, "Failed to get document")
+		return
+	}
+
+	c.JSON(http.StatusOK, document)
+}
+
+// PrintStockDocument renders a document as plain text, ready to be printed
+func (h *DocumentHandler) PrintStockDocument(c *gin.Context) {
+	id, ok := pathID(c, "document")
+	if !ok {
+		return
+	}
+
+	document, err := h.Documents.GetDocument(id)
+	if err != nil {
+		respondError(c, err, "Failed to get document")
+		return
+	}
+
+	titles := map[string]string{"receipt": "GOODS RECEIPT", "issue": "ISSUE SLIP"}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s\n", titles[document.DocumentType], document.DocumentNumber)
+	fmt.Fprintf(&buf, "Date:       %s\n", document.DocumentDate.Format("2006-01-02"))
+	fmt.Fprintf(&buf, "Location:   %d\n", document.LocationID)
+	if document.Supplier != "" {
+		fmt.Fprintf(&buf, "Supplier:   %s\n", document.Supplier)
+	}
+	if document.Department != "" {
+		fmt.Fprintf(&buf, "Department: %s\n", document.Department)
+	}
+	if document.Notes != "" {
+		fmt.Fprintf(&buf, "Notes:      %s\n", document.Notes)
+	}
+	buf.WriteString("\n")
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "#\tCODE\tNAME\tLOT\tEXPIRY\tQTY\tUNIT\tPRICE\tVALUE\t")
+	for i, l := range document.Lines {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%g\t%s\t%.2f\t%.2f\t\n", i+1, l.Code, l.Name, l.LotNumber, l.ExpiryDate,
+			l.Quantity, l.Unit, l.PricePerUnit, l.TotalValue)
+	}
+	fmt.Fprintf(w, "\t\t\t\t\t\t\tTOTAL\t%.2f\t\n", document.TotalValue)
+	w.Flush()
+
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", buf.Bytes())
+}
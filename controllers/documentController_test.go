@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMultiLineDocuments(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		flour := createTestProduct(t, router, "P-1")
+		sugar := createTestProduct(t, router, "P-2")
+
+		stock := func() map[int]float64 {
+			t.Helper()
+			var summary []models.InventorySummaryLine
+			if status := serve(t, router, "GET", "/inventory/summary", nil, &summary); status != http.StatusOK {
+				t.Fatalf("summary: status = %d", status)
+			}
+			stock := map[int]float64{}
+			for _, line := range summary {
+				stock[line.ID] = line.EndingStock
+			}
+			return stock
+		}
+
+		var receipt models.StockDocument
+		body := gin.H{"document_type": "receipt", "supplier": "Mill", "lines": []gin.H{
+			{"product_id": flour, "quantity": 5, "price_per_unit": 2},
+			{"product_id": sugar, "quantity": 3, "price_per_unit": 4},
+		}}
+		if status := serve(t, router, "POST", "/documents", body, &receipt); status != http.StatusCreated {
+			t.Fatalf("receipt: status = %d", status)
+		}
+		if receipt.DocumentNumber == "" || receipt.TotalValue != 22 || len(receipt.Lines) != 2 {
+			t.Errorf("receipt = %+v, want a numbered document of two lines worth 22", receipt)
+		}
+
+		var loaded models.StockDocument
+		if status := serve(t, router, "GET", fmt.Sprintf("/documents/%d", receipt.ID), nil, &loaded); status != http.StatusOK {
+			t.Fatalf("get receipt: status = %d", status)
+		}
+		if len(loaded.Lines) != 2 || loaded.Lines[0].TransactionID == 0 || loaded.Lines[1].Quantity != 3 {
+			t.Errorf("loaded lines = %+v, want both lines with their ledger entries", loaded.Lines)
+		}
+
+		// A line that cannot be issued fails the whole slip
+		issue := gin.H{"document_type": "issue", "department": "Kitchen", "lines": []gin.H{
+			{"product_id": flour, "quantity": 2},
+			{"product_id": sugar, "quantity": 4},
+		}}
+		if status := serve(t, router, "POST", "/documents", issue, nil); status != http.StatusBadRequest {
+			t.Errorf("issue beyond the stock: status = %d, want %d", status, http.StatusBadRequest)
+		}
+		if got := stock(); got[flour] != 5 || got[sugar] != 3 {
+			t.Errorf("stock after the failed slip = %v, want it untouched", got)
+		}
+
+		issue["lines"] = []gin.H{{"product_id": flour, "quantity": 2}, {"product_id": sugar, "quantity": 1}}
+		if status := serve(t, router, "POST", "/documents", issue, nil); status != http.StatusCreated {
+			t.Fatalf("issue: status = %d", status)
+		}
+		if got := stock(); got[flour] != 3 || got[sugar] != 2 {
+			t.Errorf("stock after the slip = %v, want 3 and 2", got)
+		}
+	})
+}
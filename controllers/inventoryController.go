@@ -1,96 +1,183 @@
 package controllers
 
 import (
-	"inventory-app/config"
 	"inventory-app/models"
+	"inventory-app/services"
+	"inventory-app/store"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetInventorySummary returns current inventory summary
-func GetInventorySummary(c *gin.Context) {
-	rows, err := config.DB.Query(`
-		SELECT 
-			p.id, p.code, p.name, i.opening_stock, i.total_in, i.total_out, i.ending_stock, i.average_price
-		FROM 
-			inventory_summary i
-		JOIN 
-			products p ON p.id = i.product_id
-	`)
+// InventoryHandler serves the stock balance and report endpoints. Balances are read from an
+// InventoryStore; the reports replayed from the ledger are run by LedgerReports.
+type InventoryHandler struct {
+	Inventory store.InventoryStore
+	Locations store.LocationStore
+	Ledger    services.LedgerReports
+}
+
+// NewInventoryHandler returns an InventoryHandler backed by inventory and locations, replaying
+// the ledger through ledger
+func NewInventoryHandler(inventory store.InventoryStore, locations store.LocationStore, ledger services.LedgerReports) *InventoryHandler {
+	return &InventoryHandler{Inventory: inventory, Locations: locations, Ledger: ledger}
+}
+
+// GetInventorySummary returns current inventory summary, company-wide or for a single ?location_id=,
+// optionally only for the products in a ?category_id= and its subcategories
+func (h *InventoryHandler) GetInventorySummary(c *gin.Context) {
+	locationID, ok := queryID(c, "location_id")
+	if !ok {
+		return
+	}
+	categoryID, ok := queryID(c, "category_id")
+	if !ok {
+		return
+	}
+
+	summaries, err := h.Inventory.InventorySummary(locationID, categoryID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err, "Failed to get inventory summary")
 		return
 	}
-	defer rows.Close()
 
-	type Inventory struct {
-		ID            int     `json:"id"`
-		Code          string  `json:"code"`
-		Name          string  `json:"name"`
-		OpeningStock  float64 `json:"opening_stock"`
-		TotalIn       float64 `json:"total_in"`
-		TotalOut      float64 `json:"total_out"`
-		EndingStock   float64 `json:"ending_stock"`
-		AveragePrice  float64 `json:"average_price"`
+	c.JSON(http.StatusOK, summaries)
+}
+
+// GetCategoryRollup returns the stock of every category, each including the products of all
+// its subcategories, company-wide or at a single ?location_id=
+func (h *InventoryHandler) GetCategoryRollup(c *gin.Context) {
+	locationID, ok := queryID(c, "location_id")
+	if !ok {
+		return
 	}
 
-	var summaries []Inventory
-	for rows.Next() {
-		var inv Inventory
-		err := rows.Scan(&inv.ID, &inv.Code, &inv.Name, &inv.OpeningStock, &inv.TotalIn, &inv.TotalOut, &inv.EndingStock, &inv.AveragePrice)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		summaries = append(summaries, inv)
+	rollup, err := h.Inventory.CategoryRollup(locationID)
+	if err != nil {
+		respondError(c, err, "Failed to get category roll-up")
+		return
 	}
 
-	c.JSON(http.StatusOK, summaries)
+	c.JSON(http.StatusOK, rollup)
+}
+
+// GetLowStockAlerts returns products with low stock, company-wide or at a single ?location_id=.
+// At a location, products stocked there are compared with the product's threshold.
+func (h *InventoryHandler) GetLowStockAlerts(c *gin.Context) {
+	locationID, ok := queryID(c, "location_id")
+	if !ok {
+		return
+	}
+
+	alerts, err := h.Inventory.LowStockAlerts(locationID)
+	if err != nil {
+		respondError(c, err, "Failed to get low stock alerts")
+		return
+	}
+
+	c.JSON(http.StatusOK, alerts)
 }
 
+// GetLotBalances returns the on-hand quantity of every lot, optionally filtered with
+// ?product_id= and ?location_id=, in first-expired-first-out order
+func (h *InventoryHandler) GetLotBalances(c *gin.Context) {
+	locationID, ok := parseLocationFilter(c, h.Locations)
+	if !ok {
+		return
+	}
+	productID, err := strconv.Atoi(c.DefaultQuery("product_id", "0"))
+	if err != nil || productID < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product_id"})
+		return
+	}
 
-// GetLowStockAlerts returns products with low stock
-func GetLowStockAlerts(c *gin.Context) {
-	rows, err := config.DB.Query(`
-		SELECT 
-			p.id, p.code, p.name, i.ending_stock, i.low_stock_threshold
-		FROM 
-			inventory_summary i
-		JOIN 
-			products p ON p.id = i.product_id
-		WHERE 
-			i.ending_stock < i.low_stock_threshold
-	`)
+	lots, err := h.Ledger.LotBalances(productID, locationID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err, "Failed to get lot balances")
 		return
 	}
-	defer rows.Close()
 
-	type Alert struct {
-		ID              int     `json:"id"`
-		Code            string  `json:"code"`
-		Name            string  `json:"name"`
-		EndingStock     float64 `json:"ending_stock"`
-		LowStockThresh  float64 `json:"low_stock_threshold"`
+	c.JSON(http.StatusOK, lots)
+}
+
+// GetExpiringLots lists the lots in stock that expire within the given window (?within=30d,
+// the default), expired lots included, soonest first
+func (h *InventoryHandler) GetExpiringLots(c *gin.Context) {
+	locationID, ok := parseLocationFilter(c, h.Locations)
+	if !ok {
+		return
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(c.DefaultQuery("within", "30d"), "d"))
+	if err != nil || days < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid within parameter. Expected a number of days, e.g. 30d"})
+		return
 	}
 
-	var alerts []Alert
-	for rows.Next() {
-		var a Alert
-		if err := rows.Scan(&a.ID, &a.Code, &a.Name, &a.EndingStock, &a.LowStockThresh); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+	lots, err := h.Ledger.LotBalances(0, locationID)
+	if err != nil {
+		respondError(c, err, "Failed to get lot balances")
+		return
+	}
+
+	today, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+	cutoff := today.AddDate(0, 0, days).Format("2006-01-02")
+
+	expiring := []models.ExpiringLot{}
+	for _, l := range lots {
+		if l.ExpiryDate == "" || l.ExpiryDate > cutoff {
+			continue
+		}
+		expiry, err := time.Parse("2006-01-02", l.ExpiryDate)
+		if err != nil {
+			continue
 		}
-		alerts = append(alerts, a)
+		daysLeft := int(expiry.Sub(today).Hours() / 24)
+		expiring = append(expiring, models.ExpiringLot{LotBalance: l, DaysToExpiry: daysLeft, Expired: daysLeft < 0})
 	}
 
-	c.JSON(http.StatusOK, alerts)
+	c.JSON(http.StatusOK, expiring)
+}
+
+// GetStockAsOf returns the stock on hand and its value at the end of ?date= (YYYY-MM-DD),
+// company-wide or at one ?location_id=, optionally for a single ?product_id=. The lookup
+// replays the ledger from the latest monthly checkpoint, which the checkpoint refresher keeps
+// up to date in the background.
+func (h *InventoryHandler) GetStockAsOf(c *gin.Context) {
+	date, err := time.Parse("2006-01-02", c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing or invalid date parameter (expected format: YYYY-MM-DD)"})
+		return
+	}
+	locationID, ok := parseLocationFilter(c, h.Locations)
+	if !ok {
+		return
+	}
+	productID, err := strconv.Atoi(c.DefaultQuery("product_id", "0"))
+	if err != nil || productID < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product_id"})
+		return
+	}
+
+	stock, err := h.Ledger.StockAsOf(date, productID, locationID)
+	if err != nil {
+		respondError(c, err, "Failed to get stock")
+		return
+	}
+	if productID != 0 && len(stock) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stock)
 }
 
-func GetMonthlyInventorySummary(c *gin.Context) {
+// GetMonthlyInventorySummary returns the monthly inventory report for every product:
+// opening stock from all ledger rows before the month, stock in/out during the month,
+// ending stock, the weighted average price as of month end and the resulting value.
+func (h *InventoryHandler) GetMonthlyInventorySummary(c *gin.Context) {
 	month := c.DefaultQuery("month", "") // default to empty string if no query param
 
 	if month == "" {
@@ -99,53 +186,64 @@ func GetMonthlyInventorySummary(c *gin.Context) {
 	}
 
 	// Check if the month format is correct
-	_, err := time.Parse("2006-01", month)
+	monthStart, err := time.Parse("2006-01", month)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month format. Expected format: YYYY-MM"})
 		return
 	}
 
-	// Generate the start and end date for the month
-	startDate := month + "-01"
-	// This assumes the end date is the last day of the month
-	endDate := month + "-31"
+	results, err := h.Ledger.MonthlyReport(monthStart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Query to get transactions for the specific month
-	rows, err := config.DB.Query(`
-		SELECT 
-			p.id, p.code, p.name, p.unit, p.category,
-			COALESCE(SUM(CASE WHEN st.transaction_type = 'in' THEN st.quantity ELSE 0 END), 0) AS stock_in,
-			COALESCE(SUM(CASE WHEN st.transaction_type = 'out' THEN st.quantity ELSE 0 END), 0) AS stock_out
-		FROM 
-			products p
-		LEFT JOIN 
-			stock_transactions st ON p.id = st.product_id AND DATE(st.transaction_timestamp) BETWEEN ? AND ?
-		GROUP BY 
-			p.id
-	`, startDate, endDate)
+	c.JSON(http.StatusOK, results)
+}
 
+// RebuildInventorySummary recomputes inventory_summary from the stock_transactions ledger for one
+// product (?product_id=) or all of them. With ?dry_run=true the differences are reported but not written.
+func (h *InventoryHandler) RebuildInventorySummary(c *gin.Context) {
+	productID, ok := queryID(c, "product_id")
+	if !ok {
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	results, err := h.Ledger.RebuildInventorySummary(productID, dryRun)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rebuild inventory summary: " + err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	var results []models.InventorySummaryResponse
-	for rows.Next() {
-		var item models.InventorySummaryResponse
-		err := rows.Scan(&item.ProductID, &item.Code, &item.Name, &item.Unit, &item.Category, &item.TotalIn, &item.TotalOut)
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":          dryRun,
+		"products_changed": len(results),
+		"differences":      results,
+	})
+}
+
+// GetIntegrityReport returns the findings of the background integrity checker.
+// With ?refresh=true a new check is run before responding.
+func (h *InventoryHandler) GetIntegrityReport(c *gin.Context) {
+	report := services.LatestIntegrityReport()
+	if report == nil || c.Query("refresh") == "true" {
+		var err error
+		report, err = h.Ledger.RunIntegrityCheck()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check inventory integrity: " + err.Error()})
 			return
 		}
-		results = append(results, item)
 	}
 
-	c.JSON(http.StatusOK, results)
+	c.JSON(http.StatusOK, report)
 }
 
-func UpdateLowStockThreshold(c *gin.Context) {
-	id := c.Param("id")
+func (h *InventoryHandler) UpdateLowStockThreshold(c *gin.Context) {
+	id, ok := pathID(c, "product")
+	if !ok {
+		return
+	}
 
 	type ThresholdUpdateRequest struct {
 		NewThreshold float64 `json:"new_threshold"`
@@ -157,15 +255,21 @@ func UpdateLowStockThreshold(c *gin.Context) {
 		return
 	}
 
-	_, err := config.DB.Exec(`
-		UPDATE inventory_summary 
-		SET low_stock_threshold = ? 
-		WHERE product_id = ?`, request.NewThreshold, id)
+	if err := h.Inventory.SetLowStockThreshold(id, request.NewThreshold); err != nil {
+		respondError(c, err, "Failed to update threshold")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Threshold updated successfully"})
+}
 
+// GetStockByLocation returns the company-wide stock of every product with its breakdown per location
+func (h *InventoryHandler) GetStockByLocation(c *gin.Context) {
+	stock, err := h.Inventory.StockByLocation()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update threshold"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Threshold updated successfully"})
+	c.JSON(http.StatusOK, stock)
 }
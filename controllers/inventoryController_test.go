@@ -0,0 +1,386 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"inventory-app/services"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFIFOValuationAcrossLocations(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+
+		var product struct {
+			ID    int    `json:"id"`
+			Error string `json:"error"`
+		}
+		body := gin.H{"code": "F-1", "name": "Flour", "unit": "kg", "costing_method": "fifo"}
+		if status := serve(t, router, "POST", "/products", body, &product); status != http.StatusCreated {
+			t.Fatalf("create product: status = %d (%s)", status, product.Error)
+		}
+		var store models.Location
+		if status := serve(t, router, "POST", "/locations", gin.H{"code": "STORE", "name": "Store"}, &store); status != http.StatusCreated {
+			t.Fatalf("create location: status = %d", status)
+		}
+
+		post := func(what, path string, body gin.H) {
+			t.Helper()
+			var response struct {
+				Error string `json:"error"`
+			}
+			if status := serve(t, router, "POST", path, body, &response); status != http.StatusCreated {
+				t.Fatalf("%s: status = %d (%s)", what, status, response.Error)
+			}
+		}
+		post("first receipt", "/transactions", gin.H{"product_id": product.ID, "transaction_type": "in", "quantity": 10, "price_per_unit": 10})
+		post("second receipt", "/transactions", gin.H{"product_id": product.ID, "transaction_type": "in", "quantity": 10, "price_per_unit": 20})
+		// The oldest units move to the store, so each location holds the cost of its own units
+		post("transfer", "/transfers", gin.H{"product_id": product.ID, "from_location_id": 1, "to_location_id": store.ID, "quantity": 10})
+		post("issue", "/transactions", gin.H{"product_id": product.ID, "transaction_type": "out", "quantity": 5, "location_id": store.ID})
+
+		stockValue := func(query string) float64 {
+			t.Helper()
+			var summary []models.InventorySummaryLine
+			if status := serve(t, router, "GET", "/inventory/summary"+query, nil, &summary); status != http.StatusOK {
+				t.Fatalf("summary%s: status = %d", query, status)
+			}
+			for _, line := range summary {
+				if line.ID == product.ID {
+					return line.StockValue
+				}
+			}
+			return 0
+		}
+		company, main, atStore := stockValue(""), stockValue("?location_id=1"), stockValue(fmt.Sprintf("?location_id=%d", store.ID))
+		if company != 250 || main != 200 || atStore != 50 {
+			t.Errorf("stock value = %v company, %v main, %v store; want 250, 200, 50", company, main, atStore)
+		}
+
+		var report []models.MonthlyInventoryReport
+		month := time.Now().Format("2006-01")
+		if status := serve(t, router, "GET", "/inventory/summary/monthly?month="+month, nil, &report); status != http.StatusOK {
+			t.Fatalf("monthly report: status = %d", status)
+		}
+		if len(report) != 1 || report[0].EndingStock != 15 || math.Abs(report[0].TotalValue-250) > 1e-9 {
+			t.Errorf("monthly report = %+v, want 15 units worth 250", report)
+		}
+
+		var rebuild struct {
+			ProductsChanged int `json:"products_changed"`
+		}
+		if status := serve(t, router, "POST", "/inventory/rebuild?dry_run=true", nil, &rebuild); status != http.StatusOK {
+			t.Fatalf("rebuild: status = %d", status)
+		}
+		if rebuild.ProductsChanged != 0 {
+			t.Errorf("replaying the ledger changed %d products, want none", rebuild.ProductsChanged)
+		}
+	})
+}
+
+func TestStockAsOfOnlyReadsCheckpoints(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+
+		receivedAt := time.Now().AddDate(0, -3, 0).UTC().Format(time.RFC3339)
+		receive := gin.H{"product_id": productID, "transaction_type": "in", "quantity": 10, "price_per_unit": 2, "transaction_timestamp": receivedAt}
+		if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+
+		asOf := func() float64 {
+			t.Helper()
+			var stock []models.StockOnHand
+			path := fmt.Sprintf("/inventory/as-of?date=%s&product_id=%d", time.Now().Format("2006-01-02"), productID)
+			if status := serve(t, router, "GET", path, nil, &stock); status != http.StatusOK || len(stock) != 1 {
+				t.Fatalf("as-of: status = %d, stock = %+v", status, stock)
+			}
+			return stock[0].Quantity
+		}
+		checkpoints := func() int {
+			t.Helper()
+			var count int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM stock_checkpoints`).Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			return count
+		}
+
+		if stock := asOf(); stock != 10 {
+			t.Errorf("stock before the refresh = %v, want 10", stock)
+		}
+		if count := checkpoints(); count != 0 {
+			t.Errorf("as-of lookup wrote %d checkpoints", count)
+		}
+
+		// A second refresh finds the checkpoints already taken and leaves them alone
+		for i := 0; i < 2; i++ {
+			if err := services.RefreshCheckpoints(db); err != nil {
+				t.Fatalf("refresh %d: %v", i+1, err)
+			}
+		}
+		if count := checkpoints(); count == 0 {
+			t.Error("refresh took no checkpoints")
+		}
+		if stock := asOf(); stock != 10 {
+			t.Errorf("stock after the refresh = %v, want 10", stock)
+		}
+	})
+}
+
+func TestRebuildDiscardsCheckpointsOfRecostedEntries(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+
+		receivedAt := time.Now().AddDate(0, -3, 0).UTC().Format(time.RFC3339)
+		receive := gin.H{"product_id": productID, "transaction_type": "in", "quantity": 10, "price_per_unit": 2, "transaction_timestamp": receivedAt}
+		if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+
+		// A stale cost taken into the checkpoints is corrected by the rebuild
+		if _, err := db.Exec(`UPDATE stock_transactions SET unit_cost = 5, cost_total = 50`); err != nil {
+			t.Fatal(err)
+		}
+		if err := services.RefreshCheckpoints(db); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+		if _, err := services.RebuildInventorySummary(db, 0, false); err != nil {
+			t.Fatalf("rebuild: %v", err)
+		}
+
+		var stock []models.StockOnHand
+		path := fmt.Sprintf("/inventory/as-of?date=%s&product_id=%d", time.Now().Format("2006-01-02"), productID)
+		if status := serve(t, router, "GET", path, nil, &stock); status != http.StatusOK || len(stock) != 1 {
+			t.Fatalf("as-of: status = %d, stock = %+v", status, stock)
+		}
+		if stock[0].StockValue != 20 {
+			t.Errorf("stock value = %v, want 20", stock[0].StockValue)
+		}
+	})
+}
+
+func TestMonthlyAndDepartmentReports(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+		month := time.Now().UTC().Format("2006-01")
+		today := time.Now().UTC().Format("2006-01-02")
+
+		post := func(body gin.H) {
+			t.Helper()
+			if status := serve(t, router, "POST", "/transactions", body, nil); status != http.StatusCreated {
+				t.Fatalf("%v: status = %d", body, status)
+			}
+		}
+		post(gin.H{"product_id": productID, "transaction_type": "in", "quantity": 10, "price_per_unit": 4})
+		post(gin.H{"product_id": productID, "transaction_type": "out", "quantity": 3, "department": "Kitchen"})
+		post(gin.H{"product_id": productID, "transaction_type": "out", "quantity": 2, "department": "Bar"})
+
+		var monthly []models.MonthlyInventoryReport
+		if status := serve(t, router, "GET", "/inventory/summary/monthly?month="+month, nil, &monthly); status != http.StatusOK {
+			t.Fatalf("monthly report: status = %d", status)
+		}
+		if len(monthly) != 1 || monthly[0].StockIn != 10 || monthly[0].StockOut != 5 || monthly[0].EndingStock != 5 || monthly[0].TotalValue != 20 {
+			t.Errorf("monthly report = %+v, want 10 in, 5 out, 5 left worth 20", monthly)
+		}
+
+		var consumption models.DepartmentConsumptionReport
+		path := "/reports/department-consumption?from=" + today + "&to=" + today
+		if status := serve(t, router, "GET", path, nil, &consumption); status != http.StatusOK {
+			t.Fatalf("department report: status = %d", status)
+		}
+		if consumption.TotalValue != 20 || len(consumption.Departments) != 2 {
+			t.Errorf("department report = %+v, want two departments worth 20", consumption)
+		}
+		for _, department := range consumption.Departments {
+			want := map[string]float64{"Kitchen": 12, "Bar": 8}[department.Department]
+			if department.Value != want {
+				t.Errorf("%s consumed %v, want %v", department.Department, department.Value, want)
+			}
+		}
+	})
+}
+
+func TestRebuildSummaryDryRun(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+		receive := gin.H{"product_id": productID, "transaction_type": "in", "quantity": 10, "price_per_unit": 3}
+		if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+		if _, err := db.Exec(`UPDATE inventory_summary SET ending_stock = 99 WHERE product_id = ?`, productID); err != nil {
+			t.Fatal(err)
+		}
+
+		endingStock := func() float64 {
+			t.Helper()
+			var summary []models.InventorySummaryLine
+			if status := serve(t, router, "GET", "/inventory/summary", nil, &summary); status != http.StatusOK || len(summary) != 1 {
+				t.Fatalf("summary: status = %d, lines = %+v", status, summary)
+			}
+			return summary[0].EndingStock
+		}
+		var rebuilt struct {
+			DryRun          bool                          `json:"dry_run"`
+			ProductsChanged int                           `json:"products_changed"`
+			Differences     []models.SummaryRebuildResult `json:"differences"`
+		}
+
+		if status := serve(t, router, "POST", "/inventory/rebuild?dry_run=true", nil, &rebuilt); status != http.StatusOK {
+			t.Fatalf("dry run: status = %d", status)
+		}
+		if !rebuilt.DryRun || rebuilt.ProductsChanged != 1 || len(rebuilt.Differences) != 1 {
+			t.Fatalf("dry run = %+v, want one difference", rebuilt)
+		}
+		difference := rebuilt.Differences[0]
+		if difference.ProductID != productID || difference.Stored == nil || difference.Stored.EndingStock != 99 ||
+			difference.Rebuilt.EndingStock != 10 || difference.Rebuilt.StockValue != 30 {
+			t.Errorf("difference = %+v, want 99 stored and 10 worth 30 rebuilt", difference)
+		}
+		if stock := endingStock(); stock != 99 {
+			t.Errorf("ending stock after the dry run = %v, want it left at 99", stock)
+		}
+
+		if status := serve(t, router, "POST", "/inventory/rebuild", nil, &rebuilt); status != http.StatusOK || rebuilt.DryRun || rebuilt.ProductsChanged != 1 {
+			t.Fatalf("rebuild: status = %d, result = %+v", status, rebuilt)
+		}
+		if stock := endingStock(); stock != 10 {
+			t.Errorf("ending stock after the rebuild = %v, want 10", stock)
+		}
+		if status := serve(t, router, "POST", "/inventory/rebuild?dry_run=true", nil, &rebuilt); status != http.StatusOK || rebuilt.ProductsChanged != 0 {
+			t.Errorf("dry run after the rebuild: status = %d, result = %+v, want no differences", status, rebuilt)
+		}
+	})
+}
+
+func TestIntegrityReportFindings(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		drifted := createTestProduct(t, router, "P-1")
+		negative := createTestProduct(t, router, "P-2")
+		missing := createTestProduct(t, router, "P-3")
+		for _, productID := range []int{drifted, negative, missing} {
+			receive := gin.H{"product_id": productID, "transaction_type": "in", "quantity": 5, "price_per_unit": 1}
+			if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusCreated {
+				t.Fatalf("stock-in: status = %d", status)
+			}
+		}
+
+		var report models.IntegrityReport
+		if status := serve(t, router, "GET", "/inventory/integrity?refresh=true", nil, &report); status != http.StatusOK {
+			t.Fatalf("integrity: status = %d", status)
+		}
+		if !report.Healthy {
+			t.Fatalf("report before the damage = %+v, want healthy", report)
+		}
+
+		for _, statement := range []string{
+			fmt.Sprintf(`UPDATE inventory_summary SET ending_stock = 7 WHERE product_id = %d`, drifted),
+			fmt.Sprintf(`UPDATE inventory_summary SET ending_stock = -2 WHERE product_id = %d`, negative),
+			fmt.Sprintf(`DELETE FROM inventory_summary WHERE product_id = %d`, missing),
+		} {
+			if _, err := db.Exec(statement); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if status := serve(t, router, "GET", "/inventory/integrity?refresh=true", nil, &report); status != http.StatusOK {
+			t.Fatalf("integrity: status = %d", status)
+		}
+		if report.Healthy {
+			t.Error("report after the damage is healthy")
+		}
+		drift := map[int]float64{}
+		for _, r := range report.SummaryDrift {
+			drift[r.ProductID] = r.Rebuilt.EndingStock
+		}
+		if len(drift) != 2 || drift[drifted] != 5 || drift[negative] != 5 {
+			t.Errorf("summary drift = %+v, want P-1 and P-2 rebuilt to 5", report.SummaryDrift)
+		}
+		if len(report.NegativeStock) != 1 || report.NegativeStock[0].ProductID != negative {
+			t.Errorf("negative stock = %+v, want P-2", report.NegativeStock)
+		}
+		if len(report.MissingSummaries) != 1 || report.MissingSummaries[0].ProductID != missing {
+			t.Errorf("missing summaries = %+v, want P-3", report.MissingSummaries)
+		}
+		if len(report.OrphanedSummaries) != 0 {
+			t.Errorf("orphaned summaries = %+v, want none", report.OrphanedSummaries)
+		}
+	})
+}
+
+func TestFEFOAllocationAndExpiringLots(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+		today := time.Now()
+		receive := func(lot string, days int, quantity float64) {
+			t.Helper()
+			body := gin.H{"product_id": productID, "transaction_type": "in", "quantity": quantity, "price_per_unit": 1}
+			if lot != "" {
+				body["lot_number"] = lot
+				body["expiry_date"] = today.AddDate(0, 0, days).Format("2006-01-02")
+			}
+			if status := serve(t, router, "POST", "/transactions", body, nil); status != http.StatusCreated {
+				t.Fatalf("receive lot %q: status = %d", lot, status)
+			}
+		}
+		receive("B", 60, 5)
+		receive("C", -3, 1)
+		receive("", 0, 3)
+		receive("A", 10, 5)
+
+		expiring := func(within string) []string {
+			t.Helper()
+			var lots []models.ExpiringLot
+			if status := serve(t, router, "GET", "/inventory/expiring?within="+within, nil, &lots); status != http.StatusOK {
+				t.Fatalf("expiring within %s: status = %d", within, status)
+			}
+			found := []string{}
+			for _, l := range lots {
+				found = append(found, fmt.Sprintf("%s:%v:%t", l.LotNumber, l.Quantity, l.Expired))
+			}
+			return found
+		}
+		if got := fmt.Sprint(expiring("30d")); got != "[C:1:true A:5:false]" {
+			t.Errorf("expiring within 30 days = %s, want C (expired) then A", got)
+		}
+		if got := fmt.Sprint(expiring("90d")); got != "[C:1:true A:5:false B:5:false]" {
+			t.Errorf("expiring within 90 days = %s, want C, A, B", got)
+		}
+
+		issue := func(quantity float64) string {
+			t.Helper()
+			var issued struct {
+				Allocations []models.LotAllocation `json:"lot_allocations"`
+			}
+			body := gin.H{"product_id": productID, "transaction_type": "out", "quantity": quantity}
+			if status := serve(t, router, "POST", "/transactions", body, &issued); status != http.StatusCreated {
+				t.Fatalf("issue %v: status = %d", quantity, status)
+			}
+			taken := []string{}
+			for _, a := range issued.Allocations {
+				taken = append(taken, fmt.Sprintf("%s:%v", a.LotNumber, a.Quantity))
+			}
+			return fmt.Sprint(taken)
+		}
+		// The earliest expiry goes first, and stock without a lot only once the lots run out
+		if got := issue(7); got != "[C:1 A:5 B:1]" {
+			t.Errorf("first issue took %s, want C:1 A:5 B:1", got)
+		}
+		if got := issue(6); got != "[B:4 :2]" {
+			t.Errorf("second issue took %s, want B:4 and 2 without a lot", got)
+		}
+
+		var lots []models.LotBalance
+		if status := serve(t, router, "GET", fmt.Sprintf("/inventory/lots?product_id=%d", productID), nil, &lots); status != http.StatusOK {
+			t.Fatalf("lots: status = %d", status)
+		}
+		if len(lots) != 0 {
+			t.Errorf("lots left = %+v, want none", lots)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"inventory-app/models"
+	"inventory-app/store"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LocationHandler serves the location endpoints from a LocationStore
+type LocationHandler struct {
+	Locations store.LocationStore
+}
+
+// NewLocationHandler returns a LocationHandler backed by locations
+func NewLocationHandler(locations store.LocationStore) *LocationHandler {
+	return &LocationHandler{Locations: locations}
+}
+
+// parseLocationFilter reads the optional ?location_id= filter. It returns 0 when the filter is
+// absent and responds with an error (returning false) when it names an unknown location.
+func parseLocationFilter(c *gin.Context, locations store.LocationStore) (int, bool) {
+	id, ok := queryID(c, "location_id")
+	if !ok || id == 0 {
+		return id, ok
+	}
+	if _, err := locations.GetLocation(id); err != nil {
+		respondError(c, err, "Failed to get location")
+		return 0, false
+	}
+	return id, true
+}
+
+// CreateLocation adds a new stock location
+func (h *LocationHandler) CreateLocation(c *gin.Context) {
+	var location models.Location
+	if err := c.ShouldBindJSON(&location); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if location.Code == "" || location.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code and name are required fields"})
+		return
+	}
+
+	if err := h.Locations.CreateLocation(&location); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, location)
+}
+
+// ListLocations retrieves all locations
+func (h *LocationHandler) ListLocations(c *gin.Context) {
+	locations, err := h.Locations.ListLocations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, locations)
+}
+
+// UpdateLocation renames an existing location
+func (h *LocationHandler) UpdateLocation(c *gin.Context) {
+	id, ok := pathID(c, "location")
+	if !ok {
+		return
+	}
+	var location models.Location
+	if err := c.ShouldBindJSON(&location); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if location.Code == "" || location.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code and name are required fields"})
+		return
+	}
+
+	if err := h.Locations.UpdateLocation(id, location); err != nil {
+		respondError(c, err, "Failed to update location")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Location updated successfully"})
+}
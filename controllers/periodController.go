@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"inventory-app/services"
+	"inventory-app/store"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PeriodHandler serves the period closing endpoints. Periods are read from a PeriodStore and
+// closed and reopened through a PeriodPosting.
+type PeriodHandler struct {
+	Periods store.PeriodStore
+	Posting services.PeriodPosting
+}
+
+// NewPeriodHandler returns a PeriodHandler backed by periods, closing them through posting
+func NewPeriodHandler(periods store.PeriodStore, posting services.PeriodPosting) *PeriodHandler {
+	return &PeriodHandler{Periods: periods, Posting: posting}
+}
+
+// periodAction is the optional body of the close and reopen endpoints
+type periodAction struct {
+	PerformedBy string `json:"performed_by"`
+	Reason      string `json:"reason"`
+}
+
+// parsePeriod validates a YYYY-MM period parameter and returns the first day of that month
+func parsePeriod(c *gin.Context) (string, time.Time, bool) {
+	period := c.Param("period")
+	monthStart, err := time.Parse("2006-01", period)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period format. Expected format: YYYY-MM"})
+		return "", time.Time{}, false
+	}
+	return period, monthStart, true
+}
+
+// ListPeriods returns every period that has been closed at least once
+func (h *PeriodHandler) ListPeriods(c *gin.Context) {
+	periods, err := h.Periods.ListPeriods()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, periods)
+}
+
+// ClosePeriod snapshots each product's balances for the month, carries the ending stock
+// forward as the opening stock and locks the month against new transactions.
+func (h *PeriodHandler) ClosePeriod(c *gin.Context) {
+	period, monthStart, ok := parsePeriod(c)
+	if !ok {
+		return
+	}
+
+	var request periodAction
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	balances, err := h.Posting.ClosePeriod(period, monthStart, request.PerformedBy, request.Reason)
+	if err != nil {
+		respondError(c, err, "Failed to close period")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Period closed successfully",
+		"period":   period,
+		"balances": balances,
+	})
+}
+
+// ReopenPeriod reopens the most recently closed period. A reason is required and the action is audited.
+func (h *PeriodHandler) ReopenPeriod(c *gin.Context) {
+	period, _, ok := parsePeriod(c)
+	if !ok {
+		return
+	}
+
+	var request periodAction
+	if err := c.ShouldBindJSON(&request); err != nil || request.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to reopen a period"})
+		return
+	}
+
+	if err := h.Posting.ReopenPeriod(period, request.PerformedBy, request.Reason); err != nil {
+		respondError(c, err, "Failed to reopen period")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Period reopened successfully", "period": period})
+}
+
+// GetPeriodBalances returns the balances snapshotted when the period was closed
+func (h *PeriodHandler) GetPeriodBalances(c *gin.Context) {
+	period, _, ok := parsePeriod(c)
+	if !ok {
+		return
+	}
+
+	balances, err := h.Periods.PeriodBalances(period)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, balances)
+}
+
+// GetPeriodAuditLog returns every close and reopen recorded for the period
+func (h *PeriodHandler) GetPeriodAuditLog(c *gin.Context) {
+	period, _, ok := parsePeriod(c)
+	if !ok {
+		return
+	}
+
+	entries, err := h.Periods.PeriodAuditLog(period)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
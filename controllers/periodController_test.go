@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClosedPeriodRejectsPostings(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+
+		now := time.Now().UTC()
+		lastMonth := now.AddDate(0, 0, -now.Day()) // the last day of the previous month
+		period := lastMonth.Format("2006-01")
+		in := gin.H{"product_id": productID, "transaction_type": "in", "quantity": 5, "price_per_unit": 1, "transaction_timestamp": lastMonth}
+		if status := serve(t, router, "POST", "/transactions", in, nil); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+
+		var closed struct {
+			Error    string `json:"error"`
+			Balances []struct {
+				EndingStock float64 `json:"ending_stock"`
+			} `json:"balances"`
+		}
+		if status := serve(t, router, "POST", "/periods/"+period+"/close", nil, &closed); status != http.StatusOK {
+			t.Fatalf("close: status = %d (%s)", status, closed.Error)
+		}
+		if len(closed.Balances) != 1 || closed.Balances[0].EndingStock != 5 {
+			t.Errorf("closing balances = %+v, want one ending at 5", closed.Balances)
+		}
+
+		if status := serve(t, router, "POST", "/transactions", in, nil); status != http.StatusConflict {
+			t.Errorf("posting into the closed period: status = %d, want %d", status, http.StatusConflict)
+		}
+
+		reopen := gin.H{"reason": "late invoice"}
+		if status := serve(t, router, "POST", "/periods/"+period+"/reopen", reopen, nil); status != http.StatusOK {
+			t.Fatalf("reopen: status = %d", status)
+		}
+		if status := serve(t, router, "POST", "/transactions", in, nil); status != http.StatusCreated {
+			t.Errorf("posting into the reopened period: status = %d, want %d", status, http.StatusCreated)
+		}
+	})
+}
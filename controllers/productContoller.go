@@ -1,129 +1,117 @@
 package controllers
 
 import (
-	"database/sql"
-	"inventory-app/config"
 	"inventory-app/models"
+	"inventory-app/services"
+	"inventory-app/store"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CreateProduct handles creating a new product
-// CreateProduct handles creating a new product
-func CreateProduct(c *gin.Context) {
-    var product models.Product
-    if err := c.ShouldBindJSON(&product); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        return
-    }
-
-    // Validate required fields
-    if product.Code == "" || product.Name == "" || product.Unit == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Code, name, and unit are required fields"})
-        return
-    }
-
-    // Get low stock threshold if provided, otherwise use default
-    var lowStockThreshold float64 = 5.0 // Default value
-    thresholdStr := c.Query("low_stock_threshold")
-    if thresholdStr != "" {
-        threshold, err := strconv.ParseFloat(thresholdStr, 64)
-        if err == nil && threshold > 0 {
-            lowStockThreshold = threshold
-        }
-    }
-
-    // Start a transaction for atomicity
-    tx, err := config.DB.Begin()
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
-        return
-    }
-
-    // Insert product
-    stmt, err := tx.Prepare(`
-        INSERT INTO products (code, name, description, unit, category, created_at)
-        VALUES (?, ?, ?, ?, ?, datetime('now'))
-    `)
-    if err != nil {
-        tx.Rollback()
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
-    defer stmt.Close()
-
-    result, err := stmt.Exec(product.Code, product.Name, product.Description, product.Unit, product.Category)
-    if err != nil {
-        tx.Rollback()
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
-
-    productId, err := result.LastInsertId()
-    if err != nil {
-        tx.Rollback()
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
-    product.ID = int(productId)
-
-    // Initialize inventory summary with custom threshold
-    _, err = tx.Exec(`
-        INSERT INTO inventory_summary (product_id, opening_stock, total_in, total_out, ending_stock, average_price, low_stock_threshold)
-        VALUES (?, 0, 0, 0, 0, 0, ?)
-    `, product.ID, lowStockThreshold)
-    if err != nil {
-        tx.Rollback()
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initialize inventory summary: " + err.Error()})
-        return
-    }
-
-    // Commit the transaction
-    if err := tx.Commit(); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
-        return
-    }
-
-    c.JSON(http.StatusCreated, product)
+// ProductHandler serves the product endpoints from a ProductStore
+type ProductHandler struct {
+	Products store.ProductStore
 }
 
-// ListProducts retrieves all products
-func ListProducts(c *gin.Context) {
-	rows, err := config.DB.Query("SELECT id, code, name, description, unit, category FROM products")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// NewProductHandler returns a ProductHandler backed by products
+func NewProductHandler(products store.ProductStore) *ProductHandler {
+	return &ProductHandler{Products: products}
+}
+
+// CreateProduct handles creating a new product
+func (h *ProductHandler) CreateProduct(c *gin.Context) {
+	var product models.Product
+	if err := c.ShouldBindJSON(&product); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	var products []models.Product
-	for rows.Next() {
-		var p models.Product
-		if err := rows.Scan(&p.ID, &p.Code, &p.Name, &p.Description, &p.Unit, &p.Category); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+	// Validate required fields
+	if product.Code == "" || product.Name == "" || product.Unit == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code, name, and unit are required fields"})
+		return
+	}
+	if !services.ValidCostingMethod(product.CostingMethod) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid costing method (expected moving_average or fifo)"})
+		return
+	}
+
+	// Get low stock threshold if provided, otherwise use default
+	var lowStockThreshold float64 = 5.0 // Default value
+	thresholdStr := c.Query("low_stock_threshold")
+	if thresholdStr != "" {
+		threshold, err := strconv.ParseFloat(thresholdStr, 64)
+		if err == nil && threshold > 0 {
+			lowStockThreshold = threshold
 		}
-		products = append(products, p)
 	}
 
-	c.JSON(http.StatusOK, products)
+	if err := h.Products.CreateProduct(&product, lowStockThreshold); err != nil {
+		respondError(c, err, "Failed to create product")
+		return
+	}
+
+	c.JSON(http.StatusCreated, product)
+}
+
+// ListProducts retrieves products a page at a time. ?q= searches the code, name and description,
+// ?category= (a category name), ?category_id= (a category and its subcategories) and ?unit= filter, ?sort= is id, code, name, created_at or relevance (when
+// searching), prefixed with "-" for descending, and ?limit= (default 100, at most 1000) and
+// ?offset= page through the results. With ?include_stock=true each product carries its
+// current stock from inventory_summary. Archived products are left out unless
+// ?include_archived=true.
+func (h *ProductHandler) ListProducts(c *gin.Context) {
+	filter := store.ProductFilter{
+		Search:          c.Query("q"),
+		Category:        c.Query("category"),
+		Unit:            c.Query("unit"),
+		Sort:            c.Query("sort"),
+		IncludeStock:    c.Query("include_stock") == "true",
+		IncludeArchived: c.Query("include_archived") == "true",
+	}
+	var ok bool
+	if filter.CategoryID, ok = queryID(c, "category_id"); !ok {
+		return
+	}
+
+	var err error
+	filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || filter.Limit <= 0 || filter.Limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit (expected 1 to 1000)"})
+		return
+	}
+	filter.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || filter.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	products, total, err := h.Products.ListProducts(filter)
+	if err != nil {
+		respondError(c, err, "Failed to list products")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"products": products,
+		"total":    total,
+		"limit":    filter.Limit,
+		"offset":   filter.Offset,
+	})
 }
 
 // GetProductByID retrieves a product by ID
-func GetProductByID(c *gin.Context) {
-	id := c.Param("id")
+func (h *ProductHandler) GetProductByID(c *gin.Context) {
+	id, ok := pathID(c, "product")
+	if !ok {
+		return
+	}
 
-	var product models.Product
-	err := config.DB.QueryRow("SELECT id, code, name, description, unit, category FROM products WHERE id = ?", id).
-		Scan(&product.ID, &product.Code, &product.Name, &product.Description, &product.Unit, &product.Category)
+	product, err := h.Products.GetProduct(id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		}
+		respondError(c, err, "Failed to get product")
 		return
 	}
 
@@ -131,83 +119,88 @@ func GetProductByID(c *gin.Context) {
 }
 
 // UpdateProduct handles updating an existing product
-func UpdateProduct(c *gin.Context) {
-	id := c.Param("id")
-	var product models.Product
-	if err := c.ShouldBindJSON(&product); err != nil {
+func (h *ProductHandler) UpdateProduct(c *gin.Context) {
+	id, ok := pathID(c, "product")
+	if !ok {
+		return
+	}
+	var update store.ProductUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !services.ValidCostingMethod(update.CostingMethod) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid costing method (expected moving_average or fifo)"})
+		return
+	}
 
-	_, err := config.DB.Exec(`
-		UPDATE products SET code = ?, name = ?, description = ?, unit = ?, category = ?
-		WHERE id = ?`, product.Code, product.Name, product.Description, product.Unit, product.Category, id)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.Products.UpdateProduct(id, update); err != nil {
+		respondError(c, err, "Failed to update product")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Product updated successfully"})
 }
 
-// DeleteProduct handles deleting a product
-func DeleteProduct(c *gin.Context) {
-	id := c.Param("id")
+// DeleteProduct permanently deletes a product that has never had a transaction. Products with
+// history must be archived instead so their ledger is kept.
+func (h *ProductHandler) DeleteProduct(c *gin.Context) {
+	id, ok := pathID(c, "product")
+	if !ok {
+		return
+	}
 
-	_, err := config.DB.Exec("DELETE FROM products WHERE id = ?", id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.Products.DeleteProduct(id); err != nil {
+		respondError(c, err, "Failed to delete product")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
 
-func GetProductCategories(c *gin.Context) {
-    rows, err := config.DB.Query("SELECT DISTINCT category FROM products WHERE category IS NOT NULL AND category != ''")
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
-    defer rows.Close()
-    
-    var categories []string
-    for rows.Next() {
-        var category string
-        if err := rows.Scan(&category); err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-            return
-        }
-        categories = append(categories, category)
-    }
-    
-    c.JSON(http.StatusOK, categories)
+// ArchiveProduct hides a product and blocks new transactions for it, keeping its ledger and
+// reports. Only products without stock on hand (including stock in transit) can be archived.
+func (h *ProductHandler) ArchiveProduct(c *gin.Context) {
+	id, ok := pathID(c, "product")
+	if !ok {
+		return
+	}
+
+	if err := h.Products.ArchiveProduct(id); err != nil {
+		respondError(c, err, "Failed to archive product")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product archived successfully"})
 }
 
-func GetProductsByCategory(c *gin.Context) {
-    category := c.Param("category")
-    
-    rows, err := config.DB.Query(`
-        SELECT id, code, name, description, unit, category 
-        FROM products 
-        WHERE category = ?
-    `, category)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
-    defer rows.Close()
-    
-    var products []models.Product
-    for rows.Next() {
-        var p models.Product
-        if err := rows.Scan(&p.ID, &p.Code, &p.Name, &p.Description, &p.Unit, &p.Category); err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-            return
-        }
-        products = append(products, p)
-    }
-    
-    c.JSON(http.StatusOK, products)
-}
\ No newline at end of file
+// RestoreProduct brings an archived product back into use
+func (h *ProductHandler) RestoreProduct(c *gin.Context) {
+	id, ok := pathID(c, "product")
+	if !ok {
+		return
+	}
+
+	if err := h.Products.RestoreProduct(id); err != nil {
+		respondError(c, err, "Failed to restore product")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product restored successfully"})
+}
+
+// GetProductsByCategory returns the products in a category and all of its subcategories
+func (h *ProductHandler) GetProductsByCategory(c *gin.Context) {
+	id, ok := pathID(c, "product")
+	if !ok {
+		return
+	}
+
+	products, err := h.Products.ProductsInCategory(id)
+	if err != nil {
+		respondError(c, err, "Failed to list products")
+		return
+	}
+
+	c.JSON(http.StatusOK, products)
+}
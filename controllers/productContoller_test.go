@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"inventory-app/store"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeProducts is a ProductStore holding products in memory
+type fakeProducts struct {
+	store.ProductStore
+	products  map[int]models.Product
+	threshold float64
+}
+
+func (f *fakeProducts) CreateProduct(p *models.Product, lowStockThreshold float64) error {
+	p.ID = len(f.products) + 1
+	f.products[p.ID] = *p
+	f.threshold = lowStockThreshold
+	return nil
+}
+
+func (f *fakeProducts) GetProduct(id int) (models.Product, error) {
+	p, ok := f.products[id]
+	if !ok {
+		return p, store.Errorf(store.NotFound, "Product not found")
+	}
+	return p, nil
+}
+
+func newProductRouter(products store.ProductStore) *gin.Engine {
+	handler := NewProductHandler(products)
+	router := gin.New()
+	router.POST("/products", handler.CreateProduct)
+	router.GET("/products/:id", handler.GetProductByID)
+	return router
+}
+
+func TestCreateProduct(t *testing.T) {
+	products := &fakeProducts{products: map[int]models.Product{}}
+	router := newProductRouter(products)
+
+	var created models.Product
+	body := models.Product{Code: "P-1", Name: "Widget", Unit: "pcs"}
+	if status := serve(t, router, "POST", "/products?low_stock_threshold=12", body, &created); status != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", status, http.StatusCreated)
+	}
+	if created.ID != 1 || products.threshold != 12 {
+		t.Errorf("created product %d with threshold %v, want product 1 with threshold 12", created.ID, products.threshold)
+	}
+}
+
+func TestCreateProductValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body models.Product
+	}{
+		{"missing unit", models.Product{Code: "P-1", Name: "Widget"}},
+		{"unknown costing method", models.Product{Code: "P-1", Name: "Widget", Unit: "pcs", CostingMethod: "lifo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			products := &fakeProducts{products: map[int]models.Product{}}
+			var response map[string]string
+			if status := serve(t, newProductRouter(products), "POST", "/products", tt.body, &response); status != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d (%s)", status, http.StatusBadRequest, response["error"])
+			}
+			if len(products.products) != 0 {
+				t.Error("an invalid product reached the store")
+			}
+		})
+	}
+}
+
+func TestGetProductByID(t *testing.T) {
+	products := &fakeProducts{products: map[int]models.Product{1: {ID: 1, Code: "P-1"}}}
+	router := newProductRouter(products)
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/products/1", http.StatusOK},
+		{"/products/2", http.StatusNotFound},
+		{"/products/abc", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if status := serve(t, router, "GET", tt.path, nil, nil); status != tt.status {
+			t.Errorf("GET %s: status = %d, want %d", tt.path, status, tt.status)
+		}
+	}
+}
+
+func TestListProductsSearchAndPaging(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		ids := map[string]int{}
+		for _, p := range []models.Product{
+			{Code: "FLOUR-W", Name: "Wheat flour", Unit: "kg", Description: "Baking"},
+			{Code: "FLOUR-R", Name: "Rye flour", Unit: "kg"},
+			{Code: "SUGAR", Name: "Cane sugar", Unit: "kg", Description: "For baking and drinks"},
+			{Code: "NAPKIN", Name: "Paper napkins", Unit: "pcs"},
+		} {
+			var created models.Product
+			if status := serve(t, router, "POST", "/products", p, &created); status != http.StatusCreated {
+				t.Fatalf("create %s: status = %d", p.Code, status)
+			}
+			ids[p.Code] = created.ID
+		}
+		receive := gin.H{"product_id": ids["SUGAR"], "transaction_type": "in", "quantity": 5, "price_per_unit": 2}
+		if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+
+		type page struct {
+			Products []models.Product `json:"products"`
+			Total    int              `json:"total"`
+			Limit    int              `json:"limit"`
+			Offset   int              `json:"offset"`
+		}
+		list := func(query string) page {
+			t.Helper()
+			var p page
+			if status := serve(t, router, "GET", "/products?"+query, nil, &p); status != http.StatusOK {
+				t.Fatalf("list ?%s: status = %d", query, status)
+			}
+			return p
+		}
+		codes := func(p page) string {
+			found := []string{}
+			for _, product := range p.Products {
+				found = append(found, product.Code)
+			}
+			return strings.Join(found, ",")
+		}
+
+		tests := []struct {
+			query string
+			codes string
+			total int
+		}{
+			{"q=flour&sort=code", "FLOUR-R,FLOUR-W", 2},
+			{"q=bak&sort=code", "FLOUR-W,SUGAR", 2},             // words match the description, as prefixes
+			{"q=flo+whe", "FLOUR-W", 1},                         // every word must match
+			{"q=chocolate", "", 0},                              // no matches is an empty page
+			{"unit=kg&sort=code&limit=2", "FLOUR-R,FLOUR-W", 3}, // the total counts every page
+			{"unit=kg&sort=code&limit=2&offset=2", "SUGAR", 3},  // the last page
+			{"unit=kg&sort=code&limit=2&offset=10", "", 3},      // past the end
+			{"sort=-name&limit=2", "FLOUR-W,FLOUR-R", 4},        // descending
+			{"q=flour&unit=pcs", "", 0},                         // filters combine with the search
+		}
+		for _, tt := range tests {
+			p := list(tt.query)
+			if got := codes(p); got != tt.codes || p.Total != tt.total {
+				t.Errorf("?%s = %s (total %d), want %s (total %d)", tt.query, got, p.Total, tt.codes, tt.total)
+			}
+		}
+		if p := list("unit=kg&limit=2&offset=2"); p.Limit != 2 || p.Offset != 2 {
+			t.Errorf("page echoes limit %d and offset %d, want 2 and 2", p.Limit, p.Offset)
+		}
+
+		// Stock is only attached on request
+		for _, product := range list("include_stock=true&sort=code").Products {
+			want := map[string]float64{"SUGAR": 5}[product.Code]
+			if product.Stock == nil || product.Stock.EndingStock != want {
+				t.Errorf("%s stock = %+v, want %v on hand", product.Code, product.Stock, want)
+			}
+		}
+		if list("sort=code").Products[0].Stock != nil {
+			t.Error("stock listed without include_stock")
+		}
+
+		for _, query := range []string{"sort=relevance", "sort=price", "limit=0", "limit=1001", "offset=-1"} {
+			if status := serve(t, router, "GET", "/products?"+query, nil, nil); status != http.StatusBadRequest {
+				t.Errorf("?%s: status = %d, want 400", query, status)
+			}
+		}
+	})
+}
+
+func TestArchiveAndDeleteRules(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+		unusedID := createTestProduct(t, router, "P-2")
+		path := func(id int, action string) string {
+			return fmt.Sprintf("/products/%d%s", id, action)
+		}
+		post := func(body gin.H) int {
+			t.Helper()
+			body["product_id"] = productID
+			return serve(t, router, "POST", "/transactions", body, nil)
+		}
+		listed := func(query string) bool {
+			t.Helper()
+			var page struct {
+				Products []models.Product `json:"products"`
+			}
+			if status := serve(t, router, "GET", "/products?"+query, nil, &page); status != http.StatusOK {
+				t.Fatalf("list: status = %d", status)
+			}
+			for _, p := range page.Products {
+				if p.ID == productID {
+					return true
+				}
+			}
+			return false
+		}
+
+		if status := post(gin.H{"transaction_type": "in", "quantity": 4, "price_per_unit": 1}); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+		if status := serve(t, router, "POST", path(productID, "/archive"), nil, nil); status != http.StatusConflict {
+			t.Errorf("archive with stock on hand: status = %d, want 409", status)
+		}
+
+		// Stock in transit is still on hand
+		storeID := createTestLocation(t, router, "STORE")
+		var transfer models.Transfer
+		dispatch := gin.H{"product_id": productID, "from_location_id": 1, "to_location_id": storeID, "quantity": 4, "in_transit": true}
+		if status := serve(t, router, "POST", "/transfers", dispatch, &transfer); status != http.StatusCreated {
+			t.Fatalf("dispatch: status = %d", status)
+		}
+		if status := serve(t, router, "POST", path(productID, "/archive"), nil, nil); status != http.StatusConflict {
+			t.Errorf("archive with stock in transit: status = %d, want 409", status)
+		}
+		if status := serve(t, router, "POST", fmt.Sprintf("/transfers/%d/receive", transfer.ID), nil, nil); status != http.StatusOK {
+			t.Fatalf("receive: status = %d", status)
+		}
+		issue := gin.H{"transaction_type": "out", "quantity": 4, "location_id": storeID}
+		if status := post(issue); status != http.StatusCreated {
+			t.Fatalf("issue: status = %d", status)
+		}
+
+		if status := serve(t, router, "POST", path(productID, "/archive"), nil, nil); status != http.StatusOK {
+			t.Fatalf("archive without stock: status = %d", status)
+		}
+		if status := serve(t, router, "POST", path(productID, "/archive"), nil, nil); status != http.StatusConflict {
+			t.Errorf("archive twice: status = %d, want 409", status)
+		}
+		if listed("") || !listed("include_archived=true") {
+			t.Error("an archived product must only be listed with include_archived=true")
+		}
+		var archived models.Product
+		if status := serve(t, router, "GET", path(productID, ""), nil, &archived); status != http.StatusOK || archived.ArchivedAt == nil {
+			t.Errorf("get archived product: status = %d, archived at %v", status, archived.ArchivedAt)
+		}
+		if status := post(gin.H{"transaction_type": "in", "quantity": 1, "price_per_unit": 1}); status != http.StatusConflict {
+			t.Errorf("stock-in of an archived product: status = %d, want 409", status)
+		}
+
+		// A product with history is never hard-deleted, archived or not
+		if status := serve(t, router, "DELETE", path(productID, ""), nil, nil); status != http.StatusConflict {
+			t.Errorf("delete a product with transactions: status = %d, want 409", status)
+		}
+
+		if status := serve(t, router, "POST", path(productID, "/restore"), nil, nil); status != http.StatusOK {
+			t.Fatalf("restore: status = %d", status)
+		}
+		if status := serve(t, router, "POST", path(productID, "/restore"), nil, nil); status != http.StatusNotFound {
+			t.Errorf("restore an active product: status = %d, want 404", status)
+		}
+		if !listed("") {
+			t.Error("a restored product is not listed")
+		}
+		if status := post(gin.H{"transaction_type": "in", "quantity": 1, "price_per_unit": 1}); status != http.StatusCreated {
+			t.Errorf("stock-in after restoring: status = %d", status)
+		}
+
+		if status := serve(t, router, "DELETE", path(unusedID, ""), nil, nil); status != http.StatusOK {
+			t.Fatalf("delete a product without transactions: status = %d", status)
+		}
+		if status := serve(t, router, "GET", path(unusedID, ""), nil, nil); status != http.StatusNotFound {
+			t.Errorf("get a deleted product: status = %d, want 404", status)
+		}
+		for _, action := range []string{"", "/archive", "/restore"} {
+			method := "POST"
+			if action == "" {
+				method = "DELETE"
+			}
+			if status := serve(t, router, method, path(unusedID, action), nil, nil); status != http.StatusNotFound {
+				t.Errorf("%s %s of a deleted product: status = %d, want 404", method, action, status)
+			}
+		}
+	})
+}
+
+func TestUpdateProductKeepsOmittedSettings(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		var product models.Product
+		body := gin.H{"code": "L-1", "name": "Laptop", "unit": "pcs", "serialized": true, "costing_method": "fifo"}
+		if status := serve(t, router, "POST", "/products", body, &product); status != http.StatusCreated {
+			t.Fatalf("create: status = %d", status)
+		}
+		update := func(body gin.H) models.Product {
+			t.Helper()
+			if status := serve(t, router, "PUT", fmt.Sprintf("/products/%d", product.ID), body, nil); status != http.StatusOK {
+				t.Fatalf("update %v: status = %d", body, status)
+			}
+			var updated models.Product
+			if status := serve(t, router, "GET", fmt.Sprintf("/products/%d", product.ID), nil, &updated); status != http.StatusOK {
+				t.Fatalf("get: status = %d", status)
+			}
+			return updated
+		}
+
+		// A client that only knows the basic details leaves serial tracking and costing as they were
+		if got := update(gin.H{"code": "L-1", "name": "Work laptop", "unit": "pcs"}); got.Name != "Work laptop" || !got.Serialized || got.CostingMethod != "fifo" {
+			t.Errorf("after a partial update = %+v, want renamed, still serialized and fifo", got)
+		}
+		if got := update(gin.H{"code": "L-1", "name": "Work laptop", "unit": "pcs", "serialized": false}); got.Serialized {
+			t.Error("serial tracking is still on after sending serialized: false")
+		}
+	})
+}
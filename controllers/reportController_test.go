@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"inventory-app/models"
+	"inventory-app/services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDepartmentConsumptionCSV(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+		today := time.Now().UTC().Format("2006-01-02")
+		for _, body := range []gin.H{
+			{"product_id": productID, "transaction_type": "in", "quantity": 10, "price_per_unit": 2.5},
+			{"product_id": productID, "transaction_type": "out", "quantity": 3, "department": "Kitchen"},
+			{"product_id": productID, "transaction_type": "out", "quantity": 1.5, "department": "Bar, upstairs"},
+		} {
+			if status := serve(t, router, "POST", "/transactions", body, nil); status != http.StatusCreated {
+				t.Fatalf("%v: status = %d", body, status)
+			}
+		}
+
+		path := "/reports/department-consumption?format=csv&from=" + today + "&to=" + today
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+		if response.Code != http.StatusOK {
+			t.Fatalf("csv report: status = %d", response.Code)
+		}
+		if contentType := response.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+			t.Errorf("content type = %q, want text/csv", contentType)
+		}
+		wantName := `filename="department-consumption-` + today + "-" + today + `.csv"`
+		if disposition := response.Header().Get("Content-Disposition"); !strings.Contains(disposition, wantName) {
+			t.Errorf("content disposition = %q, want %s", disposition, wantName)
+		}
+
+		records, err := csv.NewReader(response.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("parse csv: %v", err)
+		}
+		id := strconv.Itoa(productID)
+		want := [][]string{
+			{"department", "product_id", "code", "name", "category", "unit", "quantity", "value", "uncosted_quantity"},
+			{"Bar, upstairs", id, "P-1", "P-1", "", "pcs", "1.5", "3.75", "0"},
+			{"Kitchen", id, "P-1", "P-1", "", "pcs", "3", "7.50", "0"},
+		}
+		if len(records) != len(want) {
+			t.Fatalf("csv = %q, want %q", records, want)
+		}
+		for i := range want {
+			if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+				t.Errorf("csv row %d = %q, want %q", i, records[i], want[i])
+			}
+		}
+	})
+}
+
+func TestBackfillCostsOfLegacyMovements(t *testing.T) {
+	// Product 9 of the legacy database issued 3 x 46 at 10.50 to Warehouse A on 15 April 2025 (UTC),
+	// recorded before costing was added
+	db := openLegacyTestDB(t)
+	router := newTestRouter(db)
+
+	consumption := func() models.DepartmentConsumption {
+		t.Helper()
+		var report models.DepartmentConsumptionReport
+		path := "/reports/department-consumption?from=2025-04-15&to=2025-04-15&department=Warehouse%20A"
+		if status := serve(t, router, "GET", path, nil, &report); status != http.StatusOK {
+			t.Fatalf("department report: status = %d", status)
+		}
+		if len(report.Lines) != 1 {
+			t.Fatalf("department report lines = %+v, want product 9 only", report.Lines)
+		}
+		return report.Lines[0]
+	}
+	if line := consumption(); line.UncostedQuantity != 138 {
+		t.Errorf("before the backfill: %+v, want 138 uncosted", line)
+	}
+
+	costed, err := services.BackfillCosts(db)
+	if err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	if costed != 6 {
+		t.Errorf("backfill costed %d movements, want the 6 of product 9 (the rest are of deleted products)", costed)
+	}
+	if line := consumption(); line.Quantity != 138 || line.UncostedQuantity != 0 || line.Value != 1449 {
+		t.Errorf("after the backfill: %+v, want 138 worth 1449, none uncosted", line)
+	}
+
+	// Once every movement is costed, starting up again leaves the ledger alone
+	if costed, err := services.BackfillCosts(db); err != nil || costed != 0 {
+		t.Errorf("second backfill = %d, %v, want nothing to do", costed, err)
+	}
+}
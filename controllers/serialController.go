@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"inventory-app/store"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SerialHandler serves the serial number endpoints from a SerialStore
+type SerialHandler struct {
+	Serials store.SerialStore
+}
+
+// NewSerialHandler returns a SerialHandler backed by serials
+func NewSerialHandler(serials store.SerialStore) *SerialHandler {
+	return &SerialHandler{Serials: serials}
+}
+
+// ListProductSerials returns the units of a serialized product, optionally filtered with
+// ?status= and ?location_id=
+func (h *SerialHandler) ListProductSerials(c *gin.Context) {
+	productID, ok := pathID(c, "product")
+	if !ok {
+		return
+	}
+	locationID, ok := queryID(c, "location_id")
+	if !ok {
+		return
+	}
+
+	serials, err := h.Serials.ProductSerials(productID, c.Query("status"), locationID)
+	if err != nil {
+		respondError(c, err, "Failed to list serial numbers")
+		return
+	}
+
+	c.JSON(http.StatusOK, serials)
+}
+
+// GetSerialHistory looks up a serial number and returns every ledger entry that moved it, oldest
+// first. The same serial may exist for several products; ?product_id= narrows the lookup.
+func (h *SerialHandler) GetSerialHistory(c *gin.Context) {
+	productID, err := strconv.Atoi(c.DefaultQuery("product_id", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product_id"})
+		return
+	}
+
+	units, err := h.Serials.SerialHistory(c.Param("serial"), productID)
+	if err != nil {
+		respondError(c, err, "Failed to get serial history")
+		return
+	}
+
+	c.JSON(http.StatusOK, units)
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"inventory-app/models"
+	"inventory-app/services"
+	"inventory-app/store"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StockCardHandler serves product stock cards, replayed from the ledger by LedgerReports
+type StockCardHandler struct {
+	Products  store.ProductStore
+	Locations store.LocationStore
+	Ledger    services.LedgerReports
+}
+
+// NewStockCardHandler returns a StockCardHandler backed by products and locations, replaying
+// the ledger through ledger
+func NewStockCardHandler(products store.ProductStore, locations store.LocationStore, ledger services.LedgerReports) *StockCardHandler {
+	return &StockCardHandler{Products: products, Locations: locations, Ledger: ledger}
+}
+
+// GetProductLedger returns the stock card of a product: its ledger entries between ?from= and
+// ?to= (YYYY-MM-DD, both inclusive and optional) in chronological order, each with the running
+// quantity, average cost and value after it, and the opening balance at from. With
+// ?location_id= the card covers a single location.
+func (h *StockCardHandler) GetProductLedger(c *gin.Context) {
+	id, ok := pathID(c, "product")
+	if !ok {
+		return
+	}
+	product, err := h.Products.GetProduct(id)
+	if err != nil {
+		respondError(c, err, "Failed to get product")
+		return
+	}
+	card := models.StockCard{
+		ProductID: product.ID,
+		Code:      product.Code,
+		Name:      product.Name,
+		Unit:      product.Unit,
+		From:      c.Query("from"),
+		To:        c.Query("to"),
+	}
+
+	locationID, ok := parseLocationFilter(c, h.Locations)
+	if !ok {
+		return
+	}
+	card.LocationID = locationID
+
+	// The card covers [from, the day after to)
+	var from, to string
+	if card.From != "" {
+		fromDate, err := time.Parse("2006-01-02", card.From)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date. Use YYYY-MM-DD"})
+			return
+		}
+		from = fromDate.Format("2006-01-02")
+	}
+	if card.To != "" {
+		toDate, err := time.Parse("2006-01-02", card.To)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date. Use YYYY-MM-DD"})
+			return
+		}
+		to = toDate.AddDate(0, 0, 1).Format("2006-01-02")
+	}
+	if from != "" && to != "" && to <= from {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+
+	card.Opening, card.Lines, err = h.Ledger.StockCard(card.ProductID, locationID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	card.Closing = card.Opening
+	if n := len(card.Lines); n > 0 {
+		card.Closing = card.Lines[n-1].Balance
+	}
+
+	c.JSON(http.StatusOK, card)
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStockCardRunningBalances(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+		storeID := createTestLocation(t, router, "STORE")
+
+		// The store's receipt is backdated before the issue; the card follows the ledger's timestamps
+		for _, body := range []gin.H{
+			{"transaction_type": "in", "quantity": 10, "price_per_unit": 2, "transaction_timestamp": "2025-03-01T09:00:00Z"},
+			{"transaction_type": "in", "quantity": 10, "price_per_unit": 4, "transaction_timestamp": "2025-03-02T09:00:00Z"},
+			{"transaction_type": "out", "quantity": 5, "transaction_timestamp": "2025-03-03T09:00:00Z"},
+			{"transaction_type": "in", "quantity": 5, "price_per_unit": 3, "transaction_timestamp": "2025-03-02T12:00:00Z", "location_id": storeID},
+		} {
+			body["product_id"] = productID
+			if status := serve(t, router, "POST", "/transactions", body, nil); status != http.StatusCreated {
+				t.Fatalf("%v: status = %d", body, status)
+			}
+		}
+
+		card := func(query string) models.StockCard {
+			t.Helper()
+			var card models.StockCard
+			path := fmt.Sprintf("/products/%d/ledger%s", productID, query)
+			if status := serve(t, router, "GET", path, nil, &card); status != http.StatusOK {
+				t.Fatalf("GET %s: status = %d", path, status)
+			}
+			return card
+		}
+		balances := func(card models.StockCard) string {
+			lines := []string{}
+			for _, l := range card.Lines {
+				lines = append(lines, fmt.Sprintf("%s %v@%v=%v", l.TransactionType, l.Balance.Quantity, l.Balance.AverageCost, l.Balance.Value))
+			}
+			return fmt.Sprint(lines)
+		}
+
+		full := card("")
+		if got := balances(full); got != "[in 10@2=20 in 20@3=60 in 25@3=75 out 20@3=60]" {
+			t.Errorf("stock card = %s", got)
+		}
+		if full.Opening.Quantity != 0 || full.Closing != full.Lines[len(full.Lines)-1].Balance {
+			t.Errorf("opening %+v, closing %+v, want empty and the last balance", full.Opening, full.Closing)
+		}
+
+		// From a day on, the entries before it make up the opening balance
+		fromSecond := card("?from=2025-03-02&to=2025-03-02")
+		if fromSecond.Opening != (models.StockBalance{Quantity: 10, AverageCost: 2, Value: 20}) || len(fromSecond.Lines) != 2 {
+			t.Errorf("card of 2 March = opening %+v with %d lines, want 10 worth 20 and 2 lines", fromSecond.Opening, len(fromSecond.Lines))
+		}
+		if fromSecond.Closing != (models.StockBalance{Quantity: 25, AverageCost: 3, Value: 75}) {
+			t.Errorf("closing on 2 March = %+v, want 25 worth 75", fromSecond.Closing)
+		}
+
+		// A location's card only has the entries posted there
+		atStore := card(fmt.Sprintf("?location_id=%d", storeID))
+		if got := balances(atStore); got != "[in 5@3=15]" {
+			t.Errorf("card at the store = %s, want the one receipt", got)
+		}
+
+		if status := serve(t, router, "GET", fmt.Sprintf("/products/%d/ledger?from=2025-03-05&to=2025-03-01", productID), nil, nil); status != http.StatusBadRequest {
+			t.Errorf("to before from: status = %d, want 400", status)
+		}
+	})
+}
@@ -1,9 +1,11 @@
 package controllers
 
 import (
-	"inventory-app/config"
 	"inventory-app/models"
+	"inventory-app/services"
+	"inventory-app/store"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,210 +13,263 @@ import (
 
 const LOW_STOCK_THRESHOLD = 5 // configurable threshold for low-stock alerts
 
+// adjustmentReasons are the reason codes accepted on 'adjustment' transactions
+var adjustmentReasons = map[string]bool{
+	"damage":           true,
+	"shrinkage":        true,
+	"count_correction": true,
+}
+
+// TransactionHandler serves the stock transaction endpoints. The ledger is read from a
+// TransactionStore and posted to through a TransactionPosting.
+type TransactionHandler struct {
+	Transactions store.TransactionStore
+	Posting      services.TransactionPosting
+}
+
+// NewTransactionHandler returns a TransactionHandler backed by transactions, posting through posting
+func NewTransactionHandler(transactions store.TransactionStore, posting services.TransactionPosting) *TransactionHandler {
+	return &TransactionHandler{Transactions: transactions, Posting: posting}
+}
+
 // CreateStockTransaction handles adding a new stock transaction and updating inventory summary.
-func CreateStockTransaction(c *gin.Context) {
+func (h *TransactionHandler) CreateStockTransaction(c *gin.Context) {
     var transaction models.StockTransaction
     if err := c.ShouldBindJSON(&transaction); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
 
-    // Basic validation
-    if transaction.Quantity <= 0 {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be greater than 0"})
-        return
-    }
-
-    if transaction.TransactionType != "in" && transaction.TransactionType != "out" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction type"})
-        return
-    }
+    // Reversal links are only ever set by VoidStockTransaction, and costs by the costing engine
+    transaction.ReversalOf = nil
+    transaction.VoidedAt = nil
+    transaction.UnitCost = 0
+    transaction.CostTotal = 0
 
-    // For stock-out, verify there's enough stock
-    if transaction.TransactionType == "out" {
-        var currentStock float64
-        err := config.DB.QueryRow(`
-            SELECT ending_stock FROM inventory_summary WHERE product_id = ?
-        `, transaction.ProductID).Scan(&currentStock)
-        
-        if err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check current stock: " + err.Error()})
+    // Basic validation
+    switch transaction.TransactionType {
+    case "in", "out":
+        if transaction.Quantity <= 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be greater than 0"})
             return
         }
-        
-        if currentStock < transaction.Quantity {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock for this transaction"})
+        transaction.CountedQuantity = nil
+        transaction.ReasonCode = ""
+        if transaction.TransactionType == "in" && transaction.ExpiryDate != "" {
+            if transaction.LotNumber == "" {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "An expiry_date requires a lot_number"})
+                return
+            }
+            if _, err := time.Parse("2006-01-02", transaction.ExpiryDate); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expiry_date format. Use YYYY-MM-DD"})
+                return
+            }
+        }
+    case "adjustment":
+        if transaction.CountedQuantity == nil || *transaction.CountedQuantity < 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Adjustments require a counted_quantity of 0 or more"})
             return
         }
-    }
-
-    // Set default timestamp if not provided
-    if transaction.TransactionTimestamp.IsZero() {
-        transaction.TransactionTimestamp = time.Now()
-    }
-
-    // Auto-calculate total value if needed
-    if transaction.TotalValue == 0 && transaction.PricePerUnit > 0 {
-        transaction.TotalValue = transaction.PricePerUnit * transaction.Quantity
-    }
-
-    // Start a transaction for atomicity
-    tx, err := config.DB.Begin()
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin transaction: " + err.Error()})
+        if !adjustmentReasons[transaction.ReasonCode] {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reason code (expected damage, shrinkage or count_correction)"})
+            return
+        }
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction type"})
         return
     }
 
-    // Insert the stock transaction
-    stmt, err := tx.Prepare(`
-        INSERT INTO stock_transactions
-        (product_id, transaction_type, quantity, price_per_unit, total_value, department, transaction_timestamp, notes)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-    `)
+    recorded, err := h.Posting.RecordTransaction(transaction)
     if err != nil {
-        tx.Rollback()
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(c, err, "Failed to record transaction")
         return
     }
-    defer stmt.Close()
+    posting := recorded.Posting
 
-    result, err := stmt.Exec(
-        transaction.ProductID,
-        transaction.TransactionType,
-        transaction.Quantity,
-        transaction.PricePerUnit,
-        transaction.TotalValue,
-        transaction.Department,
-        transaction.TransactionTimestamp,
-        transaction.Notes,
-    )
-    if err != nil {
-        tx.Rollback()
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
+    response := gin.H{
+        "message": "Transaction recorded successfully",
+        "transaction": recorded.Entries[0],
+        "inventory_update": gin.H{
+            "previous_stock": posting.Before.EndingStock,
+            "current_stock": posting.After.EndingStock,
+            "average_price": posting.After.AveragePrice,
+            "stock_value": posting.After.StockValue,
+            "location_stock": posting.LocationAfter.EndingStock,
+        },
+        "low_stock_alert": recorded.LowStock,
     }
+    if recorded.Allocations != nil {
+        // A stock-out spanning several lots is recorded as one ledger entry per lot
+        response["lot_allocations"] = recorded.Allocations
+        response["transactions"] = recorded.Entries
+    }
+    c.JSON(http.StatusCreated, response)
+}
 
-    id, _ := result.LastInsertId()
-    transaction.ID = int(id)
-
-    // Get current inventory summary state
-    var (
-        currentIn, currentOut, currentAvg, currentEnding float64
-    )
+// ListStockTransactions retrieves stock transactions a page at a time, newest first.
+// Filters: ?product_id=, ?location_id=, ?type=, ?department=, ?from= and ?to= (YYYY-MM-DD,
+// inclusive), ?min_quantity=, ?max_quantity= and ?q= (searches the notes). With
+// ?include_voided=false voided transactions and their reversals are left out. ?sort= is
+// timestamp, quantity or id, prefixed with "-" for descending (default -timestamp). Pages
+// hold ?limit= rows (default 100, at most 1000); pass the returned next_cursor as ?cursor=
+// to fetch the next one.
+func (h *TransactionHandler) ListStockTransactions(c *gin.Context) {
+	filter := store.TransactionFilter{
+		Department:    c.Query("department"),
+		Notes:         c.Query("q"),
+		IncludeVoided: c.DefaultQuery("include_voided", "true") != "false",
+		Sort:          c.Query("sort"),
+		Cursor:        c.Query("cursor"),
+	}
 
-    row := tx.QueryRow(`
-        SELECT total_in, total_out, average_price, ending_stock 
-        FROM inventory_summary WHERE product_id = ?
-    `, transaction.ProductID)
+	var ok bool
+	if filter.ProductID, ok = queryID(c, "product_id"); !ok {
+		return
+	}
+	if filter.LocationID, ok = queryID(c, "location_id"); !ok {
+		return
+	}
+	if value := c.Query("type"); value != "" {
+		switch value {
+		case "in", "out", "adjustment", "transfer_out", "transfer_in":
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction type"})
+			return
+		}
+		filter.Type = value
+	}
+	if value := c.Query("from"); value != "" {
+		from, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date. Use YYYY-MM-DD"})
+			return
+		}
+		filter.From = from
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date. Use YYYY-MM-DD"})
+			return
+		}
+		filter.To = to
+	}
+	for param, bound := range map[string]**float64{"min_quantity": &filter.MinQuantity, "max_quantity": &filter.MaxQuantity} {
+		if value := c.Query(param); value != "" {
+			quantity, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			*bound = &quantity
+		}
+	}
 
-    err = row.Scan(&currentIn, &currentOut, &currentAvg, &currentEnding)
-    if err != nil {
-        tx.Rollback()
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get current inventory state: " + err.Error()})
-        return
-    }
+	var err error
+	filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || filter.Limit <= 0 || filter.Limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit (expected 1 to 1000)"})
+		return
+	}
 
-    // Update inventory summary based on transaction type
-    var newIn, newOut, newEnding, newAvg float64
-    newIn = currentIn
-    newOut = currentOut
-    newEnding = currentEnding
-    newAvg = currentAvg
+	transactions, nextCursor, err := h.Transactions.ListTransactions(filter)
+	if err != nil {
+		respondError(c, err, "Failed to list transactions")
+		return
+	}
 
-    if transaction.TransactionType == "in" {
-        newIn += transaction.Quantity
-        newEnding += transaction.Quantity
-        
-        // Recalculate average price (weighted average) for stock-in
-        if transaction.PricePerUnit > 0 {
-            // Weighted average calculation
-            totalValueBefore := currentAvg * currentIn
-            totalValueNew := transaction.PricePerUnit * transaction.Quantity
-            if newIn > 0 { // Avoid division by zero
-                newAvg = (totalValueBefore + totalValueNew) / newIn
-            }
-        }
-    } else { // "out"
-        newOut += transaction.Quantity
-        newEnding -= transaction.Quantity
-        // Average price stays the same for stock-out
-    }
+	c.JSON(http.StatusOK, gin.H{
+		"transactions": transactions,
+		"next_cursor":  nextCursor,
+	})
+}
 
-    // Update the inventory summary
-    _, err = tx.Exec(`
-        UPDATE inventory_summary
-        SET total_in = ?, total_out = ?, ending_stock = ?, average_price = ?
-        WHERE product_id = ?
-    `, newIn, newOut, newEnding, newAvg, transaction.ProductID)
+// storeErrorStatus is the HTTP status for each kind of store error
+var storeErrorStatus = map[store.Kind]int{
+	store.Invalid:       http.StatusBadRequest,
+	store.NotFound:      http.StatusNotFound,
+	store.Conflict:      http.StatusConflict,
+	store.Unprocessable: http.StatusUnprocessableEntity,
+}
 
-    if err != nil {
-        tx.Rollback()
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update inventory summary: " + err.Error()})
-        return
-    }
+// respondError reports an error from a store. Errors caused by the request carry their own
+// message; anything else is reported as an internal error after failure.
+func respondError(c *gin.Context, err error, failure string) {
+	if status, ok := storeErrorStatus[store.KindOf(err)]; ok {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": failure + ": " + err.Error()})
+}
 
-    // Check if this puts the product in low stock state
-    var lowStockThreshold float64
-    err = tx.QueryRow(`
-        SELECT low_stock_threshold FROM inventory_summary WHERE product_id = ?
-    `, transaction.ProductID).Scan(&lowStockThreshold)
-    
-    if err != nil {
-        tx.Rollback()
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check low stock threshold: " + err.Error()})
-        return
-    }
-    
-    isLowStock := newEnding <= lowStockThreshold
+// pathID reads the :id path parameter, answering 400 when it is not a positive number
+func pathID(c *gin.Context, what string) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + what + " ID"})
+		return 0, false
+	}
+	return id, true
+}
 
-    // Commit the transaction
-    if err := tx.Commit(); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction: " + err.Error()})
-        return
-    }
+// queryID reads an optional id from the query string. It returns 0 when the parameter is not
+// set and answers 400 when it is not a positive number; whether the record exists is left to
+// the store.
+func queryID(c *gin.Context, name string) (int, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, true
+	}
 
-    c.JSON(http.StatusCreated, gin.H{
-        "message": "Transaction recorded successfully",
-        "transaction": transaction,
-        "inventory_update": gin.H{
-            "previous_stock": currentEnding,
-            "current_stock": newEnding,
-            "average_price": newAvg,
-        },
-        "low_stock_alert": isLowStock,
-    })
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return 0, false
+	}
+	return id, true
 }
 
-// ListStockTransactions retrieves all stock transactions.
-func ListStockTransactions(c *gin.Context) {
-	rows, err := config.DB.Query(`
-		SELECT id, product_id, transaction_type, quantity, price_per_unit, total_value, department, transaction_timestamp, notes 
-		FROM stock_transactions ORDER BY transaction_timestamp DESC
-	`)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// VoidStockTransaction corrects a transaction without editing the ledger: it posts a compensating
+// entry (same type, negated quantity) linked to the original, marks the original as voided and
+// takes the movement back out of the inventory summary.
+func (h *TransactionHandler) VoidStockTransaction(c *gin.Context) {
+	id, ok := pathID(c, "transaction")
+	if !ok {
 		return
 	}
-	defer rows.Close()
 
-	transactions := []models.StockTransaction{}
-	for rows.Next() {
-		var t models.StockTransaction
-		if err := rows.Scan(
-			&t.ID, &t.ProductID, &t.TransactionType, &t.Quantity,
-			&t.PricePerUnit, &t.TotalValue, &t.Department,
-			&t.TransactionTimestamp, &t.Notes,
-		); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		transactions = append(transactions, t)
+	type VoidRequest struct {
+		Reason string `json:"reason"`
+	}
+
+	var request VoidRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to void a transaction"})
+		return
 	}
 
-	c.JSON(http.StatusOK, transactions)
+	voided, err := h.Posting.VoidTransaction(id, request.Reason)
+	if err != nil {
+		respondError(c, err, "Failed to void transaction")
+		return
+	}
+	posting := voided.Posting
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Transaction voided successfully",
+		"transaction": voided.Original,
+		"reversal":    voided.Reversal,
+		"inventory_update": gin.H{
+			"previous_stock": posting.Before.EndingStock,
+			"current_stock":  posting.After.EndingStock,
+			"average_price":  posting.After.AveragePrice,
+			"stock_value":    posting.After.StockValue,
+			"location_stock": posting.LocationAfter.EndingStock,
+		},
+	})
 }
 
-func GetTransactionsByDate(c *gin.Context) {
+func (h *TransactionHandler) GetTransactionsByDate(c *gin.Context) {
 	date := c.Query("date")
 	if date == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing date parameter"})
@@ -228,42 +283,11 @@ func GetTransactionsByDate(c *gin.Context) {
 		return
 	}
 
-	rows, err := config.DB.Query(`
-		SELECT 
-			st.id, p.name, st.transaction_type, st.quantity, st.transaction_timestamp
-		FROM 
-			stock_transactions st
-		JOIN 
-			products p ON p.id = st.product_id
-		WHERE 
-			strftime('%Y-%m-%d', st.transaction_timestamp) = ?
-		ORDER BY 
-			st.transaction_timestamp DESC
-	`, date)
-
+	results, err := h.Transactions.TransactionsOn(date)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
-
-	type Transaction struct {
-		ID         int       `json:"id"`
-		Product    string    `json:"product"`
-		Type       string    `json:"transaction_type"`
-		Quantity   float64   `json:"quantity"`
-		Timestamp  time.Time `json:"transaction_timestamp"`
-	}
-
-	var results []Transaction
-	for rows.Next() {
-		var tx Transaction
-		if err := rows.Scan(&tx.ID, &tx.Product, &tx.Type, &tx.Quantity, &tx.Timestamp); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		results = append(results, tx)
-	}
 
 	c.JSON(http.StatusOK, results)
 }
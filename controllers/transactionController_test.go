@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"inventory-app/models"
+	"inventory-app/services"
+	"inventory-app/store"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type postedTransaction struct {
+	Error           string                  `json:"error"`
+	Transaction     models.StockTransaction `json:"transaction"`
+	InventoryUpdate struct {
+		CurrentStock float64 `json:"current_stock"`
+		AveragePrice float64 `json:"average_price"`
+	} `json:"inventory_update"`
+}
+
+func TestRecordAndVoidTransaction(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+
+		var received postedTransaction
+		in := gin.H{"product_id": productID, "transaction_type": "in", "quantity": 10, "price_per_unit": 4}
+		if status := serve(t, router, "POST", "/transactions", in, &received); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d (%s)", status, received.Error)
+		}
+
+		var issued postedTransaction
+		out := gin.H{"product_id": productID, "transaction_type": "out", "quantity": 3}
+		if status := serve(t, router, "POST", "/transactions", out, &issued); status != http.StatusCreated {
+			t.Fatalf("stock-out: status = %d (%s)", status, issued.Error)
+		}
+		if issued.InventoryUpdate.CurrentStock != 7 || issued.InventoryUpdate.AveragePrice != 4 {
+			t.Errorf("after stock-out: stock %v at %v, want 7 at 4", issued.InventoryUpdate.CurrentStock, issued.InventoryUpdate.AveragePrice)
+		}
+
+		var rejected postedTransaction
+		tooMuch := gin.H{"product_id": productID, "transaction_type": "out", "quantity": 8}
+		if status := serve(t, router, "POST", "/transactions", tooMuch, &rejected); status != http.StatusBadRequest {
+			t.Errorf("stock-out beyond stock: status = %d, want %d", status, http.StatusBadRequest)
+		}
+
+		var voided postedTransaction
+		path := fmt.Sprintf("/transactions/%d/void", issued.Transaction.ID)
+		if status := serve(t, router, "POST", path, gin.H{"reason": "keyed twice"}, &voided); status != http.StatusOK {
+			t.Fatalf("void: status = %d (%s)", status, voided.Error)
+		}
+		if voided.InventoryUpdate.CurrentStock != 10 {
+			t.Errorf("after void: stock %v, want 10", voided.InventoryUpdate.CurrentStock)
+		}
+		if status := serve(t, router, "POST", path, gin.H{"reason": "again"}, nil); status != http.StatusConflict {
+			t.Errorf("second void: status = %d, want %d", status, http.StatusConflict)
+		}
+
+		var listed struct {
+			Transactions []models.StockTransaction `json:"transactions"`
+		}
+		if status := serve(t, router, "GET", "/transactions", nil, &listed); status != http.StatusOK {
+			t.Fatalf("list: status = %d", status)
+		}
+		if len(listed.Transactions) != 3 {
+			t.Errorf("listed %d transactions, want 3", len(listed.Transactions))
+		}
+	})
+}
+
+// fakePosting is a TransactionPosting that records what it is asked to post
+type fakePosting struct {
+	services.TransactionPosting
+	posted []models.StockTransaction
+	err    error
+}
+
+func (f *fakePosting) RecordTransaction(t models.StockTransaction) (services.RecordedTransaction, error) {
+	if f.err != nil {
+		return services.RecordedTransaction{}, f.err
+	}
+	t.ID = len(f.posted) + 1
+	f.posted = append(f.posted, t)
+
+	var recorded services.RecordedTransaction
+	recorded.Entries = []models.StockTransaction{t}
+	recorded.Posting.After.EndingStock = t.Quantity
+	recorded.Posting.After.AveragePrice = t.PricePerUnit
+	return recorded, nil
+}
+
+func TestCreateStockTransactionPostsThroughPosting(t *testing.T) {
+	posting := &fakePosting{}
+	handler := NewTransactionHandler(nil, posting)
+	router := gin.New()
+	router.POST("/transactions", handler.CreateStockTransaction)
+
+	var created postedTransaction
+	body := gin.H{"product_id": 7, "transaction_type": "in", "quantity": 4, "price_per_unit": 2.5, "expiry_date": "2030-01-01", "lot_number": "L1"}
+	if status := serve(t, router, "POST", "/transactions", body, &created); status != http.StatusCreated {
+		t.Fatalf("status = %d (%s)", status, created.Error)
+	}
+	if len(posting.posted) != 1 || posting.posted[0].ProductID != 7 || posting.posted[0].Quantity != 4 {
+		t.Fatalf("posted = %+v, want one stock-in of 4 of product 7", posting.posted)
+	}
+	if created.Transaction.ID != 1 || created.InventoryUpdate.CurrentStock != 4 || created.InventoryUpdate.AveragePrice != 2.5 {
+		t.Errorf("response = %+v", created)
+	}
+
+	// Requests failing validation never reach the ledger
+	invalid := gin.H{"product_id": 7, "transaction_type": "out", "quantity": 0}
+	if status := serve(t, router, "POST", "/transactions", invalid, nil); status != http.StatusBadRequest {
+		t.Errorf("zero quantity: status = %d, want %d", status, http.StatusBadRequest)
+	}
+	if len(posting.posted) != 1 {
+		t.Errorf("posted %d transactions, want 1", len(posting.posted))
+	}
+
+	posting.err = store.Errorf(store.Conflict, "Transaction date falls inside a closed period")
+	if status := serve(t, router, "POST", "/transactions", body, nil); status != http.StatusConflict {
+		t.Errorf("closed period: status = %d, want %d", status, http.StatusConflict)
+	}
+	posting.err = errors.New("disk full")
+	if status := serve(t, router, "POST", "/transactions", body, nil); status != http.StatusInternalServerError {
+		t.Errorf("database failure: status = %d, want %d", status, http.StatusInternalServerError)
+	}
+}
+
+func TestStockOutWithoutLotsHasNoAllocations(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+		receive := gin.H{"product_id": productID, "transaction_type": "in", "quantity": 10, "price_per_unit": 2}
+		if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+
+		var issued map[string]json.RawMessage
+		issue := gin.H{"product_id": productID, "transaction_type": "out", "quantity": 4}
+		if status := serve(t, router, "POST", "/transactions", issue, &issued); status != http.StatusCreated {
+			t.Fatalf("stock-out: status = %d", status)
+		}
+		if _, ok := issued["lot_allocations"]; ok {
+			t.Errorf("stock-out of a product without lots has lot_allocations: %s", issued["lot_allocations"])
+		}
+		if _, ok := issued["transaction"]; !ok {
+			t.Error("stock-out response has no transaction")
+		}
+	})
+}
+
+func TestLocationLookupFailuresAreNotUnknownLocations(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+		if _, err := db.Exec(`ALTER TABLE locations RENAME TO moved_locations`); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, request := range []struct {
+			path string
+			body gin.H
+		}{
+			{"/transactions", gin.H{"product_id": productID, "transaction_type": "in", "quantity": 1}},
+			{"/transfers", gin.H{"product_id": productID, "from_location_id": 1, "to_location_id": 2, "quantity": 1}},
+			{"/documents", gin.H{"document_type": "receipt", "lines": []gin.H{{"product_id": productID, "quantity": 1}}}},
+			{"/counts", gin.H{"name": "Monthly", "product_ids": []int{productID}}},
+		} {
+			if status := serve(t, router, "POST", request.path, request.body, nil); status != http.StatusInternalServerError {
+				t.Errorf("POST %s without a locations table: status = %d, want %d", request.path, status, http.StatusInternalServerError)
+			}
+		}
+	})
+}
+
+func TestRecordTransactionUnknownProduct(t *testing.T) {
+	router := newTestServer(t)
+
+	body := gin.H{"product_id": 99, "transaction_type": "in", "quantity": 1}
+	if status := serve(t, router, "POST", "/transactions", body, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestRecordTransactionRejectedByPosting(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		var product struct {
+			ID int `json:"id"`
+		}
+		body := gin.H{"code": "S-1", "name": "Scanner", "unit": "pcs", "serialized": true}
+		if status := serve(t, router, "POST", "/products", body, &product); status != http.StatusCreated {
+			t.Fatalf("create product: status = %d", status)
+		}
+
+		receive := gin.H{"product_id": product.ID, "transaction_type": "in", "quantity": 2, "serial_numbers": []string{"SN-1"}}
+		if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusBadRequest {
+			t.Errorf("missing serial number: status = %d, want %d", status, http.StatusBadRequest)
+		}
+
+		if _, err := db.Exec(`UPDATE products SET archived_at = CURRENT_TIMESTAMP WHERE id = ?`, product.ID); err != nil {
+			t.Fatal(err)
+		}
+		receive["serial_numbers"] = []string{"SN-1", "SN-2"}
+		if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusConflict {
+			t.Errorf("archived product: status = %d, want %d", status, http.StatusConflict)
+		}
+	})
+}
+
+func TestTransactionsWithMixedOffsets(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+
+		// 03:00 UTC, then 04:30 UTC: read as local clock times the stock-out would come first
+		postings := []gin.H{
+			{"product_id": productID, "transaction_type": "in", "quantity": 5, "price_per_unit": 1, "transaction_timestamp": "2024-01-10T10:00:00+07:00"},
+			{"product_id": productID, "transaction_type": "out", "quantity": 2, "transaction_timestamp": "2024-01-10T09:30:00+05:00"},
+		}
+		for _, body := range postings {
+			var posted postedTransaction
+			if status := serve(t, router, "POST", "/transactions", body, &posted); status != http.StatusCreated {
+				t.Fatalf("%s: status = %d (%s)", body["transaction_type"], status, posted.Error)
+			}
+		}
+
+		var listed struct {
+			Transactions []models.StockTransaction `json:"transactions"`
+		}
+		if status := serve(t, router, "GET", "/transactions?sort=timestamp", nil, &listed); status != http.StatusOK {
+			t.Fatalf("list: status = %d", status)
+		}
+		if len(listed.Transactions) != 2 {
+			t.Fatalf("listed %d transactions, want 2", len(listed.Transactions))
+		}
+		want := []string{"2024-01-10T03:00:00Z", "2024-01-10T04:30:00Z"}
+		for i, transaction := range listed.Transactions {
+			if got := transaction.TransactionTimestamp.UTC().Format(time.RFC3339); got != want[i] {
+				t.Errorf("transaction %d at %s, want %s", i, got, want[i])
+			}
+		}
+	})
+}
+
+func TestLegacyTimestampsAfterMigration(t *testing.T) {
+	// Product 9 of the legacy database received and issued stock on the evening of 15 April
+	// 2025 (UTC), stored in Go's time.String format at +07:00, leaving 12 on hand
+	router := newTestRouter(openLegacyTestDB(t))
+
+	var asOf []models.StockOnHand
+	if status := serve(t, router, "GET", "/inventory/as-of?date=2025-04-15&product_id=9", nil, &asOf); status != http.StatusOK {
+		t.Fatalf("as-of: status = %d", status)
+	}
+	if len(asOf) != 1 || asOf[0].Quantity != 12 {
+		t.Errorf("stock as of 2025-04-15 = %+v, want 12", asOf)
+	}
+
+	var onDate []json.RawMessage
+	if status := serve(t, router, "GET", "/transactions/by-date?date=2025-04-15", nil, &onDate); status != http.StatusOK {
+		t.Fatalf("by date: status = %d", status)
+	}
+	if len(onDate) == 0 {
+		t.Error("no transactions listed on 2025-04-15")
+	}
+
+	var issued postedTransaction
+	out := gin.H{"product_id": 9, "transaction_type": "out", "quantity": 5, "transaction_timestamp": "2025-04-15T19:00:00Z"}
+	if status := serve(t, router, "POST", "/transactions", out, &issued); status != http.StatusCreated {
+		t.Errorf("stock-out after the legacy entries: status = %d (%s)", status, issued.Error)
+	}
+}
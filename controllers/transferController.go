@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"inventory-app/services"
+	"inventory-app/store"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TransferHandler serves the transfer endpoints. Transfers are read from a TransferStore and
+// posted to the ledger through a TransferPosting.
+type TransferHandler struct {
+	Transfers store.TransferStore
+	Posting   services.TransferPosting
+}
+
+// NewTransferHandler returns a TransferHandler backed by transfers, posting through posting
+func NewTransferHandler(transfers store.TransferStore, posting services.TransferPosting) *TransferHandler {
+	return &TransferHandler{Transfers: transfers, Posting: posting}
+}
+
+// CreateTransfer dispatches stock from one location to another. The transfer_out entry at the
+// source (and, unless the stock is sent in transit, the transfer_in entry at the destination)
+// are posted in a single database transaction.
+func (h *TransferHandler) CreateTransfer(c *gin.Context) {
+	var request services.TransferRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Quantity <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be greater than 0"})
+		return
+	}
+	if request.FromLocationID == request.ToLocationID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Source and destination locations must differ"})
+		return
+	}
+
+	transfer, err := h.Posting.CreateTransfer(request)
+	if err != nil {
+		respondError(c, err, "Failed to create transfer")
+		return
+	}
+
+	c.JSON(http.StatusCreated, transfer)
+}
+
+// ListTransfers retrieves transfers, optionally filtered with ?status=
+func (h *TransferHandler) ListTransfers(c *gin.Context) {
+	transfers, err := h.Transfers.ListTransfers(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, transfers)
+}
+
+// GetTransfer retrieves a single transfer
+func (h *TransferHandler) GetTransfer(c *gin.Context) {
+	id, ok := pathID(c, "transfer")
+	if !ok {
+		return
+	}
+
+	transfer, err := h.Transfers.GetTransfer(id)
+	if err != nil {
+		respondError(c, err, "Failed to get transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// ReceiveTransfer books an in-transit transfer into its destination location
+func (h *TransferHandler) ReceiveTransfer(c *gin.Context) {
+	id, ok := pathID(c, "transfer")
+	if !ok {
+		return
+	}
+
+	transfer, err := h.Posting.ReceiveTransfer(id)
+	if err != nil {
+		respondError(c, err, "Failed to receive transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer received successfully", "transfer": transfer})
+}
+
+// CancelTransfer returns the stock of an in-transit transfer to its source location
+func (h *TransferHandler) CancelTransfer(c *gin.Context) {
+	id, ok := pathID(c, "transfer")
+	if !ok {
+		return
+	}
+
+	transfer, err := h.Posting.CancelTransfer(id)
+	if err != nil {
+		respondError(c, err, "Failed to cancel transfer")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer cancelled successfully", "transfer": transfer})
+}
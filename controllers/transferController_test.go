@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createTestLocation creates a location through router and returns its ID
+func createTestLocation(t *testing.T, router *gin.Engine, code string) int {
+	t.Helper()
+	var location models.Location
+	if status := serve(t, router, "POST", "/locations", gin.H{"code": code, "name": code}, &location); status != http.StatusCreated {
+		t.Fatalf("create location %s: status = %d", code, status)
+	}
+	return location.ID
+}
+
+func TestBackdatedTransferChecksStockAtTheTime(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+		storeID := createTestLocation(t, router, "STORE")
+
+		received := time.Now().UTC().AddDate(0, 0, -10)
+		in := gin.H{"product_id": productID, "transaction_type": "in", "quantity": 10, "price_per_unit": 3, "transaction_timestamp": received}
+		if status := serve(t, router, "POST", "/transactions", in, nil); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+
+		// Before the receipt the source held nothing
+		transfer := gin.H{"product_id": productID, "from_location_id": 1, "to_location_id": storeID, "quantity": 10,
+			"transaction_timestamp": received.AddDate(0, 0, -1)}
+		var rejected struct {
+			Error string `json:"error"`
+		}
+		if status := serve(t, router, "POST", "/transfers", transfer, &rejected); status != http.StatusBadRequest {
+			t.Errorf("transfer before the receipt: status = %d (%s), want %d", status, rejected.Error, http.StatusBadRequest)
+		}
+
+		// A stock-out after the receipt leaves 4, which a transfer dated between them must not take
+		out := gin.H{"product_id": productID, "transaction_type": "out", "quantity": 6, "transaction_timestamp": received.AddDate(0, 0, 2)}
+		if status := serve(t, router, "POST", "/transactions", out, nil); status != http.StatusCreated {
+			t.Fatalf("stock-out: status = %d", status)
+		}
+		transfer["transaction_timestamp"] = received.AddDate(0, 0, 1)
+		if status := serve(t, router, "POST", "/transfers", transfer, nil); status != http.StatusBadRequest {
+			t.Errorf("transfer that a later stock-out overdraws: status = %d, want %d", status, http.StatusBadRequest)
+		}
+		transfer["quantity"] = 4
+		if status := serve(t, router, "POST", "/transfers", transfer, &rejected); status != http.StatusCreated {
+			t.Errorf("transfer within the stock: status = %d (%s), want %d", status, rejected.Error, http.StatusCreated)
+		}
+	})
+}
+
+func TestInTransitTransferReceiveAndCancel(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, router *gin.Engine, db *sql.DB) {
+		productID := createTestProduct(t, router, "P-1")
+		storeID := createTestLocation(t, router, "STORE")
+		receive := gin.H{"product_id": productID, "transaction_type": "in", "quantity": 10, "price_per_unit": 2}
+		if status := serve(t, router, "POST", "/transactions", receive, nil); status != http.StatusCreated {
+			t.Fatalf("stock-in: status = %d", status)
+		}
+
+		stockAt := func(locationID int) float64 {
+			t.Helper()
+			var summary []models.InventorySummaryLine
+			path := fmt.Sprintf("/inventory/summary?location_id=%d", locationID)
+			if status := serve(t, router, "GET", path, nil, &summary); status != http.StatusOK {
+				t.Fatalf("summary at %d: status = %d", locationID, status)
+			}
+			for _, line := range summary {
+				if line.ID == productID {
+					return line.EndingStock
+				}
+			}
+			return 0
+		}
+		dispatch := func(quantity float64) models.Transfer {
+			t.Helper()
+			var transfer models.Transfer
+			body := gin.H{"product_id": productID, "from_location_id": 1, "to_location_id": storeID, "quantity": quantity, "in_transit": true}
+			if status := serve(t, router, "POST", "/transfers", body, &transfer); status != http.StatusCreated {
+				t.Fatalf("dispatch %v: status = %d", quantity, status)
+			}
+			if transfer.Status != "in_transit" {
+				t.Fatalf("dispatched transfer status = %q, want in_transit", transfer.Status)
+			}
+			return transfer
+		}
+		var settled struct {
+			Transfer models.Transfer `json:"transfer"`
+		}
+
+		// In transit, the stock has left the source but not reached the destination
+		received := dispatch(4)
+		if main, atStore := stockAt(1), stockAt(storeID); main != 6 || atStore != 0 {
+			t.Errorf("stock in transit: main %v, store %v; want 6 and 0", main, atStore)
+		}
+		path := fmt.Sprintf("/transfers/%d", received.ID)
+		if status := serve(t, router, "POST", path+"/receive", nil, &settled); status != http.StatusOK || settled.Transfer.Status != "received" {
+			t.Fatalf("receive: status = %d, transfer = %+v", status, settled.Transfer)
+		}
+		if settled.Transfer.ReceivedAt == nil || settled.Transfer.InTransactionID == nil {
+			t.Errorf("received transfer = %+v, want its arrival recorded", settled.Transfer)
+		}
+		if main, atStore := stockAt(1), stockAt(storeID); main != 6 || atStore != 4 {
+			t.Errorf("stock after receiving: main %v, store %v; want 6 and 4", main, atStore)
+		}
+		if status := serve(t, router, "POST", path+"/receive", nil, nil); status != http.StatusConflict {
+			t.Errorf("receive twice: status = %d, want %d", status, http.StatusConflict)
+		}
+
+		// A cancelled transfer returns its stock to the source
+		cancelled := dispatch(3)
+		path = fmt.Sprintf("/transfers/%d", cancelled.ID)
+		if status := serve(t, router, "POST", path+"/cancel", nil, &settled); status != http.StatusOK || settled.Transfer.Status != "cancelled" {
+			t.Fatalf("cancel: status = %d, transfer = %+v", status, settled.Transfer)
+		}
+		if main, atStore := stockAt(1), stockAt(storeID); main != 6 || atStore != 4 {
+			t.Errorf("stock after cancelling: main %v, store %v; want 6 and 4", main, atStore)
+		}
+		if status := serve(t, router, "POST", path+"/receive", nil, nil); status != http.StatusConflict {
+			t.Errorf("receive a cancelled transfer: status = %d, want %d", status, http.StatusConflict)
+		}
+		var transfer models.Transfer
+		if status := serve(t, router, "GET", path, nil, &transfer); status != http.StatusOK || transfer.Status != "cancelled" {
+			t.Errorf("get cancelled transfer: status = %d, transfer = %+v", status, transfer)
+		}
+		if status := serve(t, router, "POST", "/transfers/999/cancel", nil, nil); status != http.StatusNotFound {
+			t.Errorf("cancel an unknown transfer: status = %d, want %d", status, http.StatusNotFound)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+// Package pgtest gives tests a PostgreSQL database of their own. The tests using it run when
+// TEST_DATABASE_URL names a PostgreSQL server (see the Makefile) and are skipped otherwise.
+package pgtest
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// Open connects to the database named by TEST_DATABASE_URL in a schema of its own, dropped
+// when the test ends, skipping the test when it is not set. The schema is opened with open,
+// so the caller decides how the connection is set up and migrated.
+func Open(t testing.TB, open func(url string) (*sql.DB, error)) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	if strings.Contains(url, "://") {
+		separator := "?"
+		if strings.Contains(url, "?") {
+			separator = "&"
+		}
+		url += separator + "search_path=" + schema
+	} else {
+		url += " search_path=" + schema
+	}
+	db, err := open(url)
+	if err != nil {
+		t.Fatalf("open schema: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -4,21 +4,72 @@ package main
 import (
 	"inventory-app/config"
 	"inventory-app/routes"
+	"inventory-app/services"
+	"inventory-app/store"
 	"log"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	// Initialize the database.
-	config.InitDB()
+	// Initialize the database. The migrate command opens it itself, without migrating it.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		config.OpenDB()
+	} else {
+		config.InitDB()
+	}
+
+	// Products without a costing method of their own use COSTING_METHOD (default: moving average).
+	if method := os.Getenv("COSTING_METHOD"); method != "" {
+		if !services.ValidCostingMethod(method) {
+			log.Fatalf("Invalid COSTING_METHOD %q (expected moving_average or fifo)", method)
+		}
+		services.DefaultCostingMethod = method
+	}
+
+	// Subcommands (e.g. rebuild-summary) run against the database and exit.
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
+	// Databases upgraded from before costing (or transfer costing) have uncosted movements,
+	// which are costed by replaying the ledger once. "migrate up" does the same.
+	backfillCosts()
+
+	// Periodically compare inventory_summary with the ledger (default: nightly).
+	interval := 24 * time.Hour
+	if value := os.Getenv("INTEGRITY_CHECK_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid INTEGRITY_CHECK_INTERVAL %q", value)
+		}
+		interval = parsed
+	}
+	services.StartIntegrityChecker(config.DB, interval)
+
+	// Take the monthly stock checkpoints used by as-of lookups (checked hourly by default).
+	checkpointInterval := time.Hour
+	if value := os.Getenv("CHECKPOINT_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid CHECKPOINT_INTERVAL %q", value)
+		}
+		checkpointInterval = parsed
+	}
+	services.StartCheckpointRefresher(config.DB, checkpointInterval)
 
 	// Create a new Gin router.
 	router := gin.Default()
 
-	// Register the API routes.
-	routes.RegisterRoutes(router)
+	// Register the API routes, with the stores backed by the configured database.
+	var stores store.Store = store.NewSQLite(config.DB)
+	if config.Driver == config.Postgres {
+		stores = store.NewPostgres(config.DB)
+	}
+	routes.RegisterRoutes(router, stores, services.NewDatabase(config.DB))
 
 	// Optionally, set the port from an environment variable.
 	port := os.Getenv("PORT")
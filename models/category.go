@@ -0,0 +1,24 @@
+// models/category.go
+package models
+
+import "time"
+
+// Category groups products. Categories form a tree: a category without a parent is a root.
+type Category struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	ParentID  *int      `json:"parent_id"`
+	Path      string    `json:"path"` // names from the root down, e.g. "Office / Paper"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CategoryRollup is the stock of every product in a category and its subcategories.
+type CategoryRollup struct {
+	CategoryID   int     `json:"category_id"`
+	Name         string  `json:"name"`
+	ParentID     *int    `json:"parent_id"`
+	Path         string  `json:"path"`
+	ProductCount int     `json:"product_count"`
+	EndingStock  float64 `json:"ending_stock"`
+	StockValue   float64 `json:"stock_value"`
+}
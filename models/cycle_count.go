@@ -0,0 +1,42 @@
+// models/cycle_count.go
+package models
+
+import "time"
+
+// CountSession is a cycle count of a set of products. Counts are recorded blind: the system
+// quantity is only revealed through the variances once the session has been submitted.
+type CountSession struct {
+	ID         int         `json:"id"`
+	Name       string      `json:"name"`
+	Category   string      `json:"category,omitempty"`
+	LocationID int         `json:"location_id"`
+	Status     string      `json:"status"` // "open", "submitted", "approved" or "cancelled"
+	CreatedAt  time.Time   `json:"created_at"`
+	ApprovedAt *time.Time  `json:"approved_at,omitempty"`
+	ApprovedBy string      `json:"approved_by,omitempty"`
+	Lines      []CountLine `json:"lines,omitempty"`
+}
+
+// CountLine is a product to be counted in a session, without its system quantity.
+type CountLine struct {
+	ProductID       int        `json:"product_id"`
+	Code            string     `json:"code"`
+	Name            string     `json:"name"`
+	Unit            string     `json:"unit"`
+	CountedQuantity *float64   `json:"counted_quantity"`
+	CountedBy       string     `json:"counted_by,omitempty"`
+	CountedAt       *time.Time `json:"counted_at,omitempty"`
+}
+
+// CountVariance compares a counted quantity with the system stock, valued at the average price.
+type CountVariance struct {
+	ProductID       int     `json:"product_id"`
+	Code            string  `json:"code"`
+	Name            string  `json:"name"`
+	Unit            string  `json:"unit"`
+	SystemQuantity  float64 `json:"system_quantity"`
+	CountedQuantity float64 `json:"counted_quantity"`
+	Variance        float64 `json:"variance"`
+	AveragePrice    float64 `json:"average_price"`
+	VarianceValue   float64 `json:"variance_value"`
+}
@@ -0,0 +1,32 @@
+// models/integrity.go
+package models
+
+import "time"
+
+// IntegrityIssue describes a single problem found by the integrity checker.
+type IntegrityIssue struct {
+	ProductID int    `json:"product_id"`
+	Code      string `json:"code,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+// IntegrityReport is the result of comparing inventory_summary against the stock_transactions ledger.
+type IntegrityReport struct {
+	CheckedAt         time.Time              `json:"checked_at"`
+	Healthy           bool                   `json:"healthy"`
+	SummaryDrift      []SummaryRebuildResult `json:"summary_drift"`
+	NegativeStock     []IntegrityIssue       `json:"negative_stock"`
+	OrphanedSummaries []IntegrityIssue       `json:"orphaned_summaries"`
+	MissingSummaries  []IntegrityIssue       `json:"missing_summaries"`
+}
+
+// OrphanRepair counts the rows of a table whose reference to a parent table points at a
+// missing record, and what the repair did with them.
+type OrphanRepair struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Parent string `json:"parent"`
+	Rows   int    `json:"rows"`
+	Action string `json:"action"` // "deleted", or "cleared" for optional references
+}
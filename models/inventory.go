@@ -9,6 +9,7 @@ type MonthlyInventoryReport struct {
 	OpeningStock float64 `json:"opening_stock"`
 	StockIn      float64 `json:"stock_in"`
 	StockOut     float64 `json:"stock_out"`
+	Adjustment   float64 `json:"adjustment"`
 	EndingStock  float64 `json:"ending_stock"`
 	AveragePrice float64 `json:"average_price"`
 	TotalValue   float64 `json:"total_value"`
@@ -0,0 +1,88 @@
+// models/inventory_summary.go
+package models
+
+// InventoryTotals are the ledger-derived columns of an inventory_summary row.
+type InventoryTotals struct {
+	TotalIn         float64 `json:"total_in"`
+	TotalOut        float64 `json:"total_out"`
+	TotalAdjustment float64 `json:"total_adjustment"`
+	EndingStock     float64 `json:"ending_stock"`
+	AveragePrice    float64 `json:"average_price"`
+	StockValue      float64 `json:"stock_value"` // cost of the stock on hand
+}
+
+// CostLayer is a receipt of a FIFO-costed product that has not been fully issued yet.
+type CostLayer struct {
+	TransactionID int     `json:"transaction_id"` // 0 for stock on hand before the product was costed FIFO
+	LocationID    int     `json:"location_id"`    // where the units are; transfers move them
+	Quantity      float64 `json:"quantity"`
+	UnitCost      float64 `json:"unit_cost"`
+}
+
+// SummaryRebuildResult compares the stored summary of a product with the values replayed from the ledger.
+type SummaryRebuildResult struct {
+	ProductID int              `json:"product_id"`
+	Code      string           `json:"code"`
+	Name      string           `json:"name"`
+	Stored    *InventoryTotals `json:"stored"` // nil when the product has no summary row
+	Rebuilt   InventoryTotals  `json:"rebuilt"`
+	Changed   bool             `json:"changed"`
+
+	// Locations lists only the locations whose stored stock differs from the ledger
+	Locations []LocationRebuildResult `json:"locations,omitempty"`
+
+	// CostLayers are the replayed FIFO layers of a FIFO-costed product
+	CostLayers []CostLayer `json:"-"`
+
+	// Costs lists the ledger entries whose recorded cost differs from the replayed one
+	Costs []TransactionCost `json:"-"`
+}
+
+// TransactionCost is the cost a ledger entry is booked at.
+type TransactionCost struct {
+	TransactionID int     `json:"transaction_id"`
+	UnitCost      float64 `json:"unit_cost"`
+	CostTotal     float64 `json:"cost_total"`
+}
+
+// LocationRebuildResult compares the stored stock of a product at one location with the replayed ledger.
+type LocationRebuildResult struct {
+	LocationID int              `json:"location_id"`
+	Stored     *InventoryTotals `json:"stored"` // nil when there is no location_stock row
+	Rebuilt    InventoryTotals  `json:"rebuilt"`
+}
+
+// StockOnHand is the stock of a product at a point in time, company-wide or at one location.
+type StockOnHand struct {
+	ProductID    int     `json:"product_id"`
+	Code         string  `json:"code"`
+	Name         string  `json:"name"`
+	Unit         string  `json:"unit"`
+	LocationID   int     `json:"location_id,omitempty"` // 0 for the company-wide stock
+	Quantity     float64 `json:"quantity"`
+	AveragePrice float64 `json:"average_price"`
+	StockValue   float64 `json:"stock_value"`
+}
+
+// InventorySummaryLine is the current stock of a product, company-wide or at one location.
+type InventorySummaryLine struct {
+	ID              int     `json:"id"`
+	Code            string  `json:"code"`
+	Name            string  `json:"name"`
+	OpeningStock    float64 `json:"opening_stock"`
+	TotalIn         float64 `json:"total_in"`
+	TotalOut        float64 `json:"total_out"`
+	TotalAdjustment float64 `json:"total_adjustment"`
+	EndingStock     float64 `json:"ending_stock"`
+	AveragePrice    float64 `json:"average_price"`
+	StockValue      float64 `json:"stock_value"`
+}
+
+// LowStockAlert is a product whose stock is below its low-stock threshold.
+type LowStockAlert struct {
+	ID                int     `json:"id"`
+	Code              string  `json:"code"`
+	Name              string  `json:"name"`
+	EndingStock       float64 `json:"ending_stock"`
+	LowStockThreshold float64 `json:"low_stock_threshold"`
+}
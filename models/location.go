@@ -0,0 +1,35 @@
+// models/location.go
+package models
+
+import "time"
+
+// DefaultLocationID is the main warehouse. Transactions that do not name a location are
+// recorded here, as is every transaction made before locations existed.
+const DefaultLocationID = 1
+
+// Location is a place where stock is kept, such as a warehouse or a branch store.
+type Location struct {
+	ID        int       `json:"id"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LocationBalance is the stock of a product held at one location.
+type LocationBalance struct {
+	LocationID   int     `json:"location_id"`
+	Code         string  `json:"code"`
+	Name         string  `json:"name"`
+	EndingStock  float64 `json:"ending_stock"`
+	AveragePrice float64 `json:"average_price"`
+}
+
+// ProductLocations is the company-wide stock of a product with its breakdown per location.
+type ProductLocations struct {
+	ProductID    int               `json:"product_id"`
+	Code         string            `json:"code"`
+	Name         string            `json:"name"`
+	EndingStock  float64           `json:"ending_stock"`
+	AveragePrice float64           `json:"average_price"`
+	Locations    []LocationBalance `json:"locations"`
+}
@@ -0,0 +1,28 @@
+// models/lot.go
+package models
+
+// LotBalance is the on-hand quantity of one lot of a product at a location, derived from the ledger.
+type LotBalance struct {
+	ProductID  int     `json:"product_id"`
+	Code       string  `json:"code,omitempty"`
+	Name       string  `json:"name,omitempty"`
+	LocationID int     `json:"location_id"`
+	LotNumber  string  `json:"lot_number"`
+	ExpiryDate string  `json:"expiry_date,omitempty"` // YYYY-MM-DD
+	Quantity   float64 `json:"quantity"`
+}
+
+// LotAllocation is the share of a stock-out taken from one lot. An empty lot number is stock
+// that was received without a lot.
+type LotAllocation struct {
+	LotNumber  string  `json:"lot_number"`
+	ExpiryDate string  `json:"expiry_date,omitempty"`
+	Quantity   float64 `json:"quantity"`
+}
+
+// ExpiringLot is a lot on the expiry report.
+type ExpiringLot struct {
+	LotBalance
+	DaysToExpiry int  `json:"days_to_expiry"` // negative once expired
+	Expired      bool `json:"expired"`
+}
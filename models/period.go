@@ -0,0 +1,36 @@
+// models/period.go
+package models
+
+import "time"
+
+// Period is an accounting month (YYYY-MM) that can be closed to further stock transactions.
+type Period struct {
+	Period   string     `json:"period"`
+	Status   string     `json:"status"` // "open" or "closed"
+	ClosedAt *time.Time `json:"closed_at,omitempty"`
+}
+
+// PeriodBalance is the per-product snapshot taken when a period is closed.
+type PeriodBalance struct {
+	Period       string  `json:"period"`
+	ProductID    int     `json:"product_id"`
+	Code         string  `json:"code"`
+	Name         string  `json:"name"`
+	OpeningStock float64 `json:"opening_stock"`
+	TotalIn      float64 `json:"total_in"`
+	TotalOut     float64 `json:"total_out"`
+	Adjustment   float64 `json:"total_adjustment"`
+	EndingStock  float64 `json:"ending_stock"`
+	AveragePrice float64 `json:"average_price"`
+	TotalValue   float64 `json:"total_value"`
+}
+
+// PeriodAuditEntry records a single close or reopen of a period.
+type PeriodAuditEntry struct {
+	ID          int       `json:"id"`
+	Period      string    `json:"period"`
+	Action      string    `json:"action"` // "close" or "reopen"
+	PerformedBy string    `json:"performed_by"`
+	Reason      string    `json:"reason"`
+	PerformedAt time.Time `json:"performed_at"`
+}
@@ -4,11 +4,16 @@ package models
 import "time"
 
 type Product struct {
-    ID          int       `json:"id"`
-    Code        string    `json:"code"`
-    Name        string    `json:"name"`
-    Description string    `json:"description"` // Change from pointer to string
-    Unit        string    `json:"unit"`
-    Category    string    `json:"category"`
-    CreatedAt   time.Time `json:"created_at"`
+    ID            int              `json:"id"`
+    Code          string           `json:"code"`
+    Name          string           `json:"name"`
+    Description   string           `json:"description"`              // Change from pointer to string
+    Unit          string           `json:"unit"`
+    Category      string           `json:"category"`                 // name of the product's category
+    CategoryID    *int             `json:"category_id,omitempty"`
+    Serialized    bool             `json:"serialized"`               // stock movements must list the serial number of every unit
+    CostingMethod string           `json:"costing_method,omitempty"` // "moving_average" or "fifo"; empty uses the global default
+    CreatedAt     time.Time        `json:"created_at"`
+    ArchivedAt    *time.Time       `json:"archived_at,omitempty"`    // archived products are hidden and take no new transactions
+    Stock         *InventoryTotals `json:"stock,omitempty"`          // current stock, when requested with the product list
 }
\ No newline at end of file
@@ -0,0 +1,32 @@
+// models/report.go
+package models
+
+// DepartmentConsumption is the stock one department drew of one product over a report's date
+// range, valued at the cost recorded when each unit was issued.
+type DepartmentConsumption struct {
+	Department       string  `json:"department"`
+	ProductID        int     `json:"product_id"`
+	Code             string  `json:"code"`
+	Name             string  `json:"name"`
+	Category         string  `json:"category"`
+	Unit             string  `json:"unit"`
+	Quantity         float64 `json:"quantity"`
+	Value            float64 `json:"value"`
+	UncostedQuantity float64 `json:"uncosted_quantity,omitempty"` // issued before costs were recorded; not in Value
+}
+
+// DepartmentTotal is the total a department consumed over a report's date range
+type DepartmentTotal struct {
+	Department string  `json:"department"`
+	Quantity   float64 `json:"quantity"`
+	Value      float64 `json:"value"`
+}
+
+// DepartmentConsumptionReport is the cost of goods issued per department between two dates
+type DepartmentConsumptionReport struct {
+	From        string                  `json:"from"`
+	To          string                  `json:"to"`
+	Lines       []DepartmentConsumption `json:"lines"`
+	Departments []DepartmentTotal       `json:"departments"`
+	TotalValue  float64                 `json:"total_value"`
+}
@@ -0,0 +1,13 @@
+// models/serial.go
+package models
+
+// SerialNumber is a single unit of a serialized product.
+type SerialNumber struct {
+	ProductID    int                `json:"product_id"`
+	Code         string             `json:"code"`
+	Name         string             `json:"name"`
+	SerialNumber string             `json:"serial_number"`
+	Status       string             `json:"status"`                // "in_stock", "in_transit" or "out"
+	LocationID   *int               `json:"location_id,omitempty"` // while in stock
+	Movements    []StockTransaction `json:"movements,omitempty"`
+}
@@ -0,0 +1,44 @@
+// models/stock_card.go
+package models
+
+import "time"
+
+// StockBalance is the stock of a product at a point on its stock card.
+type StockBalance struct {
+	Quantity    float64 `json:"quantity"`
+	AverageCost float64 `json:"average_cost"`
+	Value       float64 `json:"value"`
+}
+
+// StockCardLine is one ledger entry on a stock card with the running balance after it.
+type StockCardLine struct {
+	TransactionID        int          `json:"transaction_id"`
+	TransactionTimestamp time.Time    `json:"transaction_timestamp"`
+	TransactionType      string       `json:"transaction_type"`
+	LocationID           int          `json:"location_id"`
+	Department           string       `json:"department,omitempty"`
+	Notes                string       `json:"notes,omitempty"`
+	LotNumber            string       `json:"lot_number,omitempty"`
+	ReversalOf           *int         `json:"reversal_of,omitempty"`
+	DocumentID           *int         `json:"document_id,omitempty"`
+	TransferID           *int         `json:"transfer_id,omitempty"`
+	QuantityIn           float64      `json:"quantity_in"`
+	QuantityOut          float64      `json:"quantity_out"`
+	UnitCost             float64      `json:"unit_cost"`
+	Value                float64      `json:"value"` // signed change in the value of the stock
+	Balance              StockBalance `json:"balance"`
+}
+
+// StockCard is the running-balance ledger of one product, company-wide or at one location.
+type StockCard struct {
+	ProductID  int             `json:"product_id"`
+	Code       string          `json:"code"`
+	Name       string          `json:"name"`
+	Unit       string          `json:"unit"`
+	LocationID int             `json:"location_id,omitempty"` // 0 for the company-wide card
+	From       string          `json:"from,omitempty"`
+	To         string          `json:"to,omitempty"`
+	Opening    StockBalance    `json:"opening"`
+	Lines      []StockCardLine `json:"lines"`
+	Closing    StockBalance    `json:"closing"`
+}
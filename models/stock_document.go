@@ -0,0 +1,36 @@
+// models/stock_document.go
+package models
+
+import "time"
+
+// StockDocument is a goods receipt or an issue slip: a header with any number of lines, each of
+// which is posted to the ledger as a stock transaction referencing the document.
+type StockDocument struct {
+	ID             int            `json:"id"`
+	DocumentNumber string         `json:"document_number"` // generated when left empty
+	DocumentType   string         `json:"document_type"`   // "receipt" or "issue"
+	DocumentDate   time.Time      `json:"document_date"`
+	LocationID     int            `json:"location_id"`
+	Department     string         `json:"department"`
+	Supplier       string         `json:"supplier"`
+	Notes          string         `json:"notes"`
+	TotalValue     float64        `json:"total_value"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Lines          []DocumentLine `json:"lines,omitempty"`
+}
+
+// DocumentLine is one product on a stock document.
+type DocumentLine struct {
+	TransactionID int      `json:"transaction_id"`
+	ProductID     int      `json:"product_id"`
+	Code          string   `json:"code"`
+	Name          string   `json:"name"`
+	Unit          string   `json:"unit"`
+	Quantity      float64  `json:"quantity"`
+	PricePerUnit  float64  `json:"price_per_unit"`
+	TotalValue    float64  `json:"total_value"`
+	Notes         string   `json:"notes"`
+	LotNumber     string   `json:"lot_number,omitempty"`
+	ExpiryDate    string   `json:"expiry_date,omitempty"` // receipts: YYYY-MM-DD expiry of the lot
+	SerialNumbers []string `json:"serial_numbers,omitempty"`
+}
@@ -3,14 +3,39 @@ package models
 
 import "time"
 
+// TimestampLayout is how timestamps are stored: in UTC and without an offset, so that they
+// sort and compare correctly as text
+const TimestampLayout = "2006-01-02 15:04:05.999999999"
+
 type StockTransaction struct {
-    ID                   int       `json:"id"`
-    ProductID            int       `json:"product_id"`
-    TransactionType      string    `json:"transaction_type"` // "in" or "out"
-    Quantity             float64   `json:"quantity"`
-    PricePerUnit         float64   `json:"price_per_unit"`
-    TotalValue           float64   `json:"total_value"`
-    Department           string    `json:"department"`
-    TransactionTimestamp time.Time `json:"transaction_timestamp"`
-    Notes                string    `json:"notes"`
+    ID                   int        `json:"id"`
+    ProductID            int        `json:"product_id"`
+    LocationID           int        `json:"location_id"` // defaults to the main warehouse
+    TransactionType      string     `json:"transaction_type"` // "in", "out", "adjustment", "transfer_out" or "transfer_in"
+    Quantity             float64    `json:"quantity"`
+    PricePerUnit         float64    `json:"price_per_unit"`
+    TotalValue           float64    `json:"total_value"`
+    Department           string     `json:"department"`
+    TransactionTimestamp time.Time  `json:"transaction_timestamp"`
+    Notes                string     `json:"notes"`
+    ReversalOf           *int       `json:"reversal_of,omitempty"` // ID of the transaction this entry voids
+    VoidedAt             *time.Time `json:"voided_at,omitempty"`
+    ReasonCode           string     `json:"reason_code,omitempty"`      // adjustments: damage, shrinkage or count_correction
+    CountedQuantity      *float64   `json:"counted_quantity,omitempty"` // adjustments: physically counted quantity
+    TransferID           *int       `json:"transfer_id,omitempty"`      // transfer entries: the transfer they belong to
+    DocumentID           *int       `json:"document_id,omitempty"`      // document lines: the receipt or issue slip they belong to
+    LotNumber            string     `json:"lot_number,omitempty"`
+    ExpiryDate           string     `json:"expiry_date,omitempty"` // YYYY-MM-DD, set on the stock-in of a lot
+    SerialNumbers        []string   `json:"serial_numbers,omitempty"` // serialized products: one per unit moved
+    UnitCost             float64    `json:"unit_cost"`  // cost per unit the movement was booked at, set when posted
+    CostTotal            float64    `json:"cost_total"` // quantity * unit_cost: the cost of goods issued, for a stock-out
+}
+
+// DailyTransaction is a ledger entry in the list of one day's transactions.
+type DailyTransaction struct {
+    ID        int       `json:"id"`
+    Product   string    `json:"product"`
+    Type      string    `json:"transaction_type"`
+    Quantity  float64   `json:"quantity"`
+    Timestamp time.Time `json:"transaction_timestamp"`
 }
@@ -0,0 +1,23 @@
+// models/transfer.go
+package models
+
+import "time"
+
+// Transfer moves stock of a product from one location to another. Dispatch posts a
+// 'transfer_out' entry at the source; receipt posts the matching 'transfer_in' at the
+// destination, valued at the source's average price at dispatch. In between the stock is
+// in transit: it still counts towards the company total but is held at neither location.
+type Transfer struct {
+	ID               int        `json:"id"`
+	ProductID        int        `json:"product_id"`
+	FromLocationID   int        `json:"from_location_id"`
+	ToLocationID     int        `json:"to_location_id"`
+	Quantity         float64    `json:"quantity"`
+	AveragePrice     float64    `json:"average_price"`
+	Status           string     `json:"status"` // "in_transit", "received" or "cancelled"
+	Notes            string     `json:"notes"`
+	DispatchedAt     time.Time  `json:"dispatched_at"`
+	ReceivedAt       *time.Time `json:"received_at,omitempty"`
+	OutTransactionID *int       `json:"out_transaction_id,omitempty"` // first entry; a transfer of several lots has one per lot
+	InTransactionID  *int       `json:"in_transaction_id,omitempty"`
+}
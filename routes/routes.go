@@ -2,29 +2,107 @@ package routes
 
 import (
 	"inventory-app/controllers"
+	"inventory-app/services"
+	"inventory-app/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(router *gin.Engine) {
+// RegisterRoutes registers the API routes. Records are read and kept through stores, and stock
+// is posted to and replayed from the ledger through ledger.
+func RegisterRoutes(router *gin.Engine, stores store.Store, ledger services.Ledger) {
+	productHandler := controllers.NewProductHandler(stores)
+	transactionHandler := controllers.NewTransactionHandler(stores, ledger)
+	inventoryHandler := controllers.NewInventoryHandler(stores, stores, ledger)
+	serialHandler := controllers.NewSerialHandler(stores)
+	stockCardHandler := controllers.NewStockCardHandler(stores, stores, ledger)
+	reportHandler := controllers.NewReportHandler(stores)
+	categoryHandler := controllers.NewCategoryHandler(stores)
+	locationHandler := controllers.NewLocationHandler(stores)
+	documentHandler := controllers.NewDocumentHandler(stores, ledger)
+	transferHandler := controllers.NewTransferHandler(stores, ledger)
+	periodHandler := controllers.NewPeriodHandler(stores, ledger)
+	countHandler := controllers.NewCountHandler(stores, ledger)
+
 	api := router.Group("/api")
 	{
 		// Product routes
-		api.POST("/products", controllers.CreateProduct)
-		api.GET("/products", controllers.ListProducts)
-		api.GET("/products/:id", controllers.GetProductByID)   // For GET Product by ID
-		api.PUT("/products/:id", controllers.UpdateProduct)    // For PUT Update Product
-		api.DELETE("/products/:id", controllers.DeleteProduct) // For DELETE Product
+		api.POST("/products", productHandler.CreateProduct)
+		api.GET("/products", productHandler.ListProducts)
+		api.GET("/products/:id", productHandler.GetProductByID)   // For GET Product by ID
+		api.PUT("/products/:id", productHandler.UpdateProduct)    // For PUT Update Product
+		api.DELETE("/products/:id", productHandler.DeleteProduct) // For DELETE Product
+		api.POST("/products/:id/archive", productHandler.ArchiveProduct)
+		api.POST("/products/:id/restore", productHandler.RestoreProduct)
+		api.GET("/products/:id/serials", serialHandler.ListProductSerials)
+		api.GET("/products/:id/ledger", stockCardHandler.GetProductLedger)
+
+		// Serial number routes
+		api.GET("/serials/:serial", serialHandler.GetSerialHistory)
 
 		// Transaction routes
-		api.POST("/transactions", controllers.CreateStockTransaction)
-		api.GET("/transactions", controllers.ListStockTransactions)
-		api.GET("/transactions/by-date", controllers.GetTransactionsByDate)
+		api.POST("/transactions", transactionHandler.CreateStockTransaction)
+		api.GET("/transactions", transactionHandler.ListStockTransactions)
+		api.GET("/transactions/by-date", transactionHandler.GetTransactionsByDate)
+		api.POST("/transactions/:id/void", transactionHandler.VoidStockTransaction)
 
 		// Inventory routes
-		api.GET("/inventory/summary", controllers.GetInventorySummary)
-		api.GET("/inventory/summary/monthly", controllers.GetMonthlyInventorySummary) // Keep only one registration
-		api.GET("/inventory/low-stock", controllers.GetLowStockAlerts)
-		api.PUT("/inventory/:id/threshold", controllers.UpdateLowStockThreshold)
+		api.GET("/inventory/summary", inventoryHandler.GetInventorySummary)
+		api.GET("/inventory/summary/monthly", inventoryHandler.GetMonthlyInventorySummary) // Keep only one registration
+		api.GET("/inventory/low-stock", inventoryHandler.GetLowStockAlerts)
+		api.PUT("/inventory/:id/threshold", inventoryHandler.UpdateLowStockThreshold)
+		api.POST("/inventory/rebuild", inventoryHandler.RebuildInventorySummary)
+		api.GET("/inventory/integrity", inventoryHandler.GetIntegrityReport)
+		api.GET("/inventory/by-location", inventoryHandler.GetStockByLocation)
+		api.GET("/inventory/lots", inventoryHandler.GetLotBalances)
+		api.GET("/inventory/expiring", inventoryHandler.GetExpiringLots)
+		api.GET("/inventory/as-of", inventoryHandler.GetStockAsOf)
+		api.GET("/inventory/by-category", inventoryHandler.GetCategoryRollup)
+
+		// Report routes
+		api.GET("/reports/department-consumption", reportHandler.GetDepartmentConsumption)
+
+		// Category routes
+		api.POST("/categories", categoryHandler.CreateCategory)
+		api.GET("/categories", categoryHandler.ListCategories)
+		api.GET("/categories/:id", categoryHandler.GetCategory)
+		api.PUT("/categories/:id", categoryHandler.UpdateCategory)
+		api.DELETE("/categories/:id", categoryHandler.DeleteCategory)
+		api.GET("/categories/:id/products", productHandler.GetProductsByCategory)
+
+		// Location routes
+		api.POST("/locations", locationHandler.CreateLocation)
+		api.GET("/locations", locationHandler.ListLocations)
+		api.PUT("/locations/:id", locationHandler.UpdateLocation)
+
+		// Stock document routes
+		api.POST("/documents", documentHandler.CreateStockDocument)
+		api.GET("/documents", documentHandler.ListStockDocuments)
+		api.GET("/documents/:id", documentHandler.GetStockDocument)
+		api.GET("/documents/:id/print", documentHandler.PrintStockDocument)
+
+		// Transfer routes
+		api.POST("/transfers", transferHandler.CreateTransfer)
+		api.GET("/transfers", transferHandler.ListTransfers)
+		api.GET("/transfers/:id", transferHandler.GetTransfer)
+		api.POST("/transfers/:id/receive", transferHandler.ReceiveTransfer)
+		api.POST("/transfers/:id/cancel", transferHandler.CancelTransfer)
+
+		// Period routes
+		api.GET("/periods", periodHandler.ListPeriods)
+		api.POST("/periods/:period/close", periodHandler.ClosePeriod)
+		api.POST("/periods/:period/reopen", periodHandler.ReopenPeriod)
+		api.GET("/periods/:period/balances", periodHandler.GetPeriodBalances)
+		api.GET("/periods/:period/audit", periodHandler.GetPeriodAuditLog)
+
+		// Cycle count routes
+		api.POST("/counts", countHandler.CreateCountSession)
+		api.GET("/counts", countHandler.ListCountSessions)
+		api.GET("/counts/:id", countHandler.GetCountSession)
+		api.PUT("/counts/:id/lines", countHandler.RecordCounts)
+		api.POST("/counts/:id/submit", countHandler.SubmitCountSession)
+		api.GET("/counts/:id/variances", countHandler.GetCountVariances)
+		api.POST("/counts/:id/approve", countHandler.ApproveCountSession)
+		api.POST("/counts/:id/cancel", countHandler.CancelCountSession)
 	}
 }
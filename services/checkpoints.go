@@ -0,0 +1,236 @@
+package services
+
+import (
+	"database/sql"
+	"inventory-app/models"
+	"log"
+	"time"
+)
+
+// Stock checkpoints are snapshots of every product's balances at the start of a month, replayed
+// from the ledger. Stock as of a date is the latest checkpoint before it plus the ledger entries
+// since, so a lookup never replays much more than a month of the ledger. Posting an entry
+// dated before a checkpoint discards that checkpoint (see invalidateCheckpoints).
+
+// checkpointLayout is the format of checkpoint dates. A checkpoint holds the balances of every
+// ledger entry before that day.
+const checkpointLayout = "2006-01-02"
+
+// companyLocation is the location id under which company-wide balances are kept
+const companyLocation = 0
+
+// balances are replayed stock totals, company-wide (location companyLocation) and per location
+type balances map[locationKey]*models.InventoryTotals
+
+func (b balances) get(key locationKey) *models.InventoryTotals {
+	totals, ok := b[key]
+	if !ok {
+		totals = &models.InventoryTotals{}
+		b[key] = totals
+	}
+	return totals
+}
+
+// loadCheckpoint returns the date and balances of the latest checkpoint on or before cutoff,
+// for productID or every product (0). Without one the date is empty and the balances are zero.
+func loadCheckpoint(q queryer, cutoff string, productID int) (string, balances, error) {
+	b := balances{}
+	var date sql.NullString
+	err := q.QueryRow(`SELECT MAX(checkpoint_date) FROM stock_checkpoints WHERE checkpoint_date <= ?`, cutoff).Scan(&date)
+	if err != nil || !date.Valid {
+		return "", b, err
+	}
+
+	rows, err := q.Query(`
+		SELECT product_id, location_id, ending_stock, average_price, stock_value
+		FROM stock_checkpoints
+		WHERE checkpoint_date = ? AND (? = 0 OR product_id = ?)
+	`, date.String, productID, productID)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key locationKey
+		var totals models.InventoryTotals
+		if err := rows.Scan(&key.productID, &key.locationID, &totals.EndingStock, &totals.AveragePrice, &totals.StockValue); err != nil {
+			return "", nil, err
+		}
+		b[key] = &totals
+	}
+	return date.String, b, rows.Err()
+}
+
+// replayRange applies the ledger entries timestamped in [from, to) to b, in ledger order. Each
+// entry is applied at the unit cost it was posted with; entries from before costs were
+// recorded are costed at the moving average.
+func replayRange(q queryer, b balances, from, to string, productID int) error {
+	rows, err := q.Query(`
+		SELECT st.product_id, st.location_id, st.transaction_type, st.quantity, COALESCE(st.price_per_unit, 0), st.unit_cost,
+			st.reversal_of, COALESCE(p.costing_method, '')
+		FROM stock_transactions st
+		LEFT JOIN products p ON p.id = st.product_id
+		WHERE st.transaction_timestamp >= ? AND st.transaction_timestamp < ? AND (? = 0 OR st.product_id = ?)
+		ORDER BY st.transaction_timestamp, st.id
+	`, from, to, productID, productID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.StockTransaction
+		var unitCost sql.NullFloat64
+		var reversalOf sql.NullInt64
+		var method string
+		if err := rows.Scan(&t.ProductID, &t.LocationID, &t.TransactionType, &t.Quantity, &t.PricePerUnit, &unitCost, &reversalOf,
+			&method); err != nil {
+			return err
+		}
+		if reversalOf.Valid {
+			id := int(reversalOf.Int64)
+			t.ReversalOf = &id
+		}
+		if method == "" {
+			method = DefaultCostingMethod
+		}
+
+		b.apply(&t, method, unitCost)
+	}
+	return rows.Err()
+}
+
+// apply posts a ledger entry of a product costed with method to its company-wide and location
+// balances, at the recorded unit cost or, for entries from before costs were recorded, at the
+// moving average. t.UnitCost is set to the recorded cost; the location cost is returned.
+func (b balances) apply(t *models.StockTransaction, method string, recorded sql.NullFloat64) float64 {
+	company := b.get(locationKey{t.ProductID, companyLocation})
+	location := b.get(locationKey{t.ProductID, t.LocationID})
+	if recorded.Valid {
+		t.UnitCost = recorded.Float64
+	} else {
+		method = MovingAverage
+		(&costing{method: method}).cost(*company, *location, t)
+	}
+	Apply(company, t.TransactionType, t.Quantity, t.UnitCost)
+
+	locationCost := locationUnitCost(method, *location, *t)
+	ApplyLocation(location, t.TransactionType, t.Quantity, locationCost)
+	return locationCost
+}
+
+// RefreshCheckpoints takes a checkpoint at the start of every month since the latest one (or
+// since the first ledger entry) up to the start of the current month. Checkpoints another
+// refresh has taken in the meantime are left as they are.
+func RefreshCheckpoints(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	thisMonth := time.Now().Format("2006-01") + "-01"
+	from, b, err := loadCheckpoint(tx, thisMonth, 0)
+	if err != nil {
+		return err
+	}
+
+	var start string
+	if from != "" {
+		start = from
+	} else {
+		var first sql.NullString
+		if err := tx.QueryRow(`SELECT MIN(transaction_timestamp) FROM stock_transactions`).Scan(&first); err != nil {
+			return err
+		}
+		if !first.Valid || len(first.String) < 7 {
+			return nil
+		}
+		start = first.String[:7] + "-01"
+	}
+	month, err := time.Parse(checkpointLayout, start)
+	if err != nil {
+		return err
+	}
+
+	for {
+		month = month.AddDate(0, 1, 0)
+		to := month.Format(checkpointLayout)
+		if to > thisMonth {
+			break
+		}
+		if err := replayRange(tx, b, from, to, 0); err != nil {
+			return err
+		}
+		for key, totals := range b {
+			_, err := tx.Exec(`
+				INSERT INTO stock_checkpoints (checkpoint_date, product_id, location_id, ending_stock, average_price, stock_value)
+				VALUES (?, ?, ?, ?, ?, ?)
+				ON CONFLICT DO NOTHING
+			`, to, key.productID, key.locationID, totals.EndingStock, totals.AveragePrice, totals.StockValue)
+			if err != nil {
+				return err
+			}
+		}
+		from = to
+	}
+	return tx.Commit()
+}
+
+// StartCheckpointRefresher refreshes the checkpoints immediately and then once every interval
+// in the background, so stock lookups only ever read them.
+func StartCheckpointRefresher(db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := RefreshCheckpoints(db); err != nil {
+				log.Printf("Checkpoint refresh failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// invalidateCheckpoints discards the checkpoints that a ledger entry posted at timestamp falls before
+func invalidateCheckpoints(tx *sql.Tx, timestamp time.Time) error {
+	_, err := tx.Exec(`DELETE FROM stock_checkpoints WHERE checkpoint_date > ?`, timestamp.UTC().Format(checkpointLayout))
+	return err
+}
+
+// StockAsOf returns the stock on hand of every product (or only productID when it is non-zero)
+// at the end of date, company-wide or at locationID when it is non-zero, replayed from the
+// latest checkpoint.
+func StockAsOf(q queryer, date time.Time, productID, locationID int) ([]models.StockOnHand, error) {
+	cutoff := date.AddDate(0, 0, 1).Format(checkpointLayout)
+	from, b, err := loadCheckpoint(q, cutoff, productID)
+	if err != nil {
+		return nil, err
+	}
+	if err := replayRange(q, b, from, cutoff, productID); err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(`
+		SELECT id, code, name, unit FROM products WHERE ? = 0 OR id = ? ORDER BY code
+	`, productID, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stock := []models.StockOnHand{}
+	for rows.Next() {
+		s := models.StockOnHand{LocationID: locationID}
+		if err := rows.Scan(&s.ProductID, &s.Code, &s.Name, &s.Unit); err != nil {
+			return nil, err
+		}
+		if totals, ok := b[locationKey{s.ProductID, locationID}]; ok {
+			s.Quantity, s.AveragePrice, s.StockValue = totals.EndingStock, totals.AveragePrice, totals.StockValue
+		}
+		stock = append(stock, s)
+	}
+	return stock, rows.Err()
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"database/sql"
+	"inventory-app/models"
+	"math"
+)
+
+// Costing methods. A product without a method of its own is costed with DefaultCostingMethod.
+const (
+	MovingAverage = "moving_average" // weighted average of the stock on hand
+	FIFO          = "fifo"           // issues are costed from the oldest receipts still on hand
+)
+
+// DefaultCostingMethod is the costing method of products that do not set one
+var DefaultCostingMethod = MovingAverage
+
+// ValidCostingMethod reports whether method is a known costing method. The empty string
+// stands for the default method.
+func ValidCostingMethod(method string) bool {
+	return method == "" || method == MovingAverage || method == FIFO
+}
+
+// stockEpsilon is the quantity below which stock is considered gone
+const stockEpsilon = 1e-9
+
+// stockDelta is the change a movement makes to the company-wide stock. Transfers only move
+// stock between locations.
+func stockDelta(transactionType string, quantity float64) float64 {
+	switch transactionType {
+	case "in", "adjustment":
+		return quantity
+	case "out":
+		return -quantity
+	}
+	return 0
+}
+
+// locationDelta is the change a movement makes to the stock of the location it is posted at
+func locationDelta(transactionType string, quantity float64) float64 {
+	switch transactionType {
+	case "transfer_in":
+		return quantity
+	case "transfer_out":
+		return -quantity
+	}
+	return stockDelta(transactionType, quantity)
+}
+
+// costing costs the movements of one product with its costing method
+type costing struct {
+	method string
+	layers []models.CostLayer // FIFO only, oldest first, each at the location holding its units
+}
+
+// costingMethod returns the costing method of a product, DefaultCostingMethod when it sets none
+func costingMethod(q rowQueryer, productID int) (string, error) {
+	var method sql.NullString
+	if err := q.QueryRow(`SELECT costing_method FROM products WHERE id = ?`, productID).Scan(&method); err != nil {
+		return "", err
+	}
+	if method.String == "" {
+		return DefaultCostingMethod, nil
+	}
+	return method.String, nil
+}
+
+// loadCosting reads the costing method of a product and, for FIFO, its open cost layers.
+// The layers are reconciled with the stock at each location: stock that no layer accounts for
+// (received before the product was costed FIFO) becomes an opening layer at the location's
+// average price, and layers beyond the stock (moved by a transfer before layers were kept per
+// location) are dropped oldest first.
+func loadCosting(q queryer, productID int) (*costing, error) {
+	method, err := costingMethod(q, productID)
+	if err != nil {
+		return nil, err
+	}
+	c := &costing{method: method}
+	if c.method != FIFO {
+		return c, nil
+	}
+
+	rows, err := q.Query(`
+		SELECT transaction_id, location_id, quantity, unit_cost FROM cost_layers WHERE product_id = ? ORDER BY id
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+	layered := map[int]float64{}
+	for rows.Next() {
+		var l models.CostLayer
+		if err := rows.Scan(&l.TransactionID, &l.LocationID, &l.Quantity, &l.UnitCost); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		layered[l.LocationID] += l.Quantity
+		c.layers = append(c.layers, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(`
+		SELECT location_id, ending_stock, average_price FROM location_stock WHERE product_id = ? ORDER BY location_id
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var opening []models.CostLayer
+	for rows.Next() {
+		var locationID int
+		var stock, averagePrice float64
+		if err := rows.Scan(&locationID, &stock, &averagePrice); err != nil {
+			return nil, err
+		}
+		if unlayered := stock - layered[locationID]; unlayered > stockEpsilon {
+			opening = append(opening, models.CostLayer{LocationID: locationID, Quantity: unlayered, UnitCost: averagePrice})
+		} else if unlayered < -stockEpsilon {
+			c.consume(locationID, -unlayered, 0, 0)
+		}
+	}
+	c.layers = append(opening, c.layers...)
+	return c, rows.Err()
+}
+
+// saveCostLayers replaces the stored cost layers of a product
+func saveCostLayers(tx *sql.Tx, productID int, layers []models.CostLayer) error {
+	if _, err := tx.Exec(`DELETE FROM cost_layers WHERE product_id = ?`, productID); err != nil {
+		return err
+	}
+	for _, l := range layers {
+		_, err := tx.Exec(`
+			INSERT INTO cost_layers (product_id, transaction_id, location_id, quantity, unit_cost) VALUES (?, ?, ?, ?, ?)
+		`, productID, l.TransactionID, l.LocationID, l.Quantity, l.UnitCost)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cost works out the unit cost at which t moves the stock, given the company-wide and location
+// totals before the movement, and stamps it with the resulting cost total onto t.
+//
+// Receipts are booked at their price, or at the average price when they carry none.
+// Issues are booked at the average price (moving average) or from the oldest layers at their
+// location (FIFO). Transfers leave the source at its average price or from its oldest layers,
+// and arrive at the cost they left at, which the caller carries over in t.UnitCost.
+// Reversals and replayed ledger entries that arrive with a unit cost keep it, so a voided
+// issue returns its units at the cost they left at.
+func (c *costing) cost(totals, location models.InventoryTotals, t *models.StockTransaction) {
+	delta := locationDelta(t.TransactionType, t.Quantity)
+	if delta == 0 {
+		return
+	}
+
+	var unitCost float64
+	if delta > 0 {
+		switch {
+		case t.UnitCost > 0:
+			unitCost = t.UnitCost
+		case t.TransactionType == "transfer_in" || t.TransactionType == "in" && t.PricePerUnit > 0:
+			unitCost = t.PricePerUnit
+		default:
+			unitCost = totals.AveragePrice
+		}
+		if c.method == FIFO {
+			c.layers = append(c.layers, models.CostLayer{TransactionID: t.ID, LocationID: t.LocationID, Quantity: delta, UnitCost: unitCost})
+		}
+	} else {
+		preferred := 0
+		if t.ReversalOf != nil {
+			preferred = *t.ReversalOf
+		}
+		fallback := totals.AveragePrice
+		if t.TransactionType == "transfer_out" {
+			fallback = location.AveragePrice
+		}
+		switch {
+		case c.method == FIFO:
+			unitCost = c.consume(t.LocationID, -delta, preferred, fallback)
+		case t.ReversalOf != nil && t.UnitCost > 0:
+			unitCost = t.UnitCost
+		default:
+			unitCost = fallback
+		}
+	}
+
+	t.UnitCost = unitCost
+	t.CostTotal = t.Quantity * unitCost
+}
+
+// consume takes quantity out of the FIFO layers at a location and returns its cost per unit.
+// Units are taken from the layer of the preferred transaction first (a reversed receipt takes
+// back its own units), then from the oldest layers. Anything beyond the layered stock is
+// costed at fallback.
+func (c *costing) consume(locationID int, quantity float64, preferred int, fallback float64) float64 {
+	remaining, total := quantity, 0.0
+	take := func(l *models.CostLayer) {
+		n := math.Min(l.Quantity, remaining)
+		total += n * l.UnitCost
+		l.Quantity -= n
+		remaining -= n
+	}
+
+	if preferred != 0 {
+		for i := range c.layers {
+			if c.layers[i].TransactionID == preferred && c.layers[i].LocationID == locationID {
+				take(&c.layers[i])
+			}
+		}
+	}
+	for i := range c.layers {
+		if remaining <= stockEpsilon {
+			break
+		}
+		if c.layers[i].LocationID == locationID {
+			take(&c.layers[i])
+		}
+	}
+	if remaining > stockEpsilon {
+		total += remaining * fallback
+	}
+
+	open := c.layers[:0]
+	for _, l := range c.layers {
+		if l.Quantity > stockEpsilon {
+			open = append(open, l)
+		}
+	}
+	c.layers = open
+
+	return total / quantity
+}
+
+// locationUnitCost is the unit cost at which t, costed with method, moves the stock of its
+// location. FIFO layers are kept per location, so under FIFO every movement moves it at the
+// cost stamped on t. Under moving average so do arrivals, transfers and reversals, while other
+// departures leave at the location's average price.
+func locationUnitCost(method string, totals models.InventoryTotals, t models.StockTransaction) float64 {
+	if method == FIFO || locationDelta(t.TransactionType, t.Quantity) > 0 || t.TransactionType == "transfer_out" || t.ReversalOf != nil {
+		return t.UnitCost
+	}
+	return totals.AveragePrice
+}
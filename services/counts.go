@@ -0,0 +1,90 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"inventory-app/store"
+	"sort"
+	"time"
+)
+
+// ApproveCountSession approves a submitted count session inside tx, posting an adjustment
+// into the ledger for every line with a variance. The variances are the ones stored when the
+// session was submitted, so stock received or issued since then is left as it is; a write-down
+// that stock issued since would take below zero is rejected.
+func ApproveCountSession(tx *sql.Tx, id int, approvedBy, reasonCode string) ([]models.StockTransaction, error) {
+	// The session is locked before it is read, so it cannot be approved twice
+	if _, err := tx.Exec(`UPDATE count_sessions SET status = status WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	status, locationID, err := store.CountSessionStatus(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status != "submitted" {
+		return nil, store.Errorf(store.Conflict, "Only a submitted session can be approved")
+	}
+
+	variances, err := store.SessionVariances(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The products are locked before their stock is checked, in a fixed order so two approvals
+	// cannot each hold a lock the other is waiting for
+	productIDs := make([]int, 0, len(variances))
+	for _, v := range variances {
+		productIDs = append(productIDs, v.ProductID)
+	}
+	sort.Ints(productIDs)
+	for _, productID := range productIDs {
+		if err := lockProduct(tx, productID); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	adjustments := []models.StockTransaction{}
+	for _, v := range variances {
+		if v.Variance == 0 {
+			continue
+		}
+		if v.Variance < 0 {
+			stock, _, err := LocationStockAt(tx, v.ProductID, locationID, now)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check current stock: %w", err)
+			}
+			if stock+v.Variance < 0 {
+				return nil, store.Errorf(store.Invalid, "Adjustment of %s would leave the stock negative: %v on hand, variance %v",
+					v.Code, stock, v.Variance)
+			}
+		}
+
+		counted := v.CountedQuantity
+		adjustment := models.StockTransaction{
+			ProductID:            v.ProductID,
+			LocationID:           locationID,
+			TransactionType:      "adjustment",
+			Quantity:             v.Variance,
+			PricePerUnit:         v.AveragePrice,
+			TotalValue:           v.VarianceValue,
+			TransactionTimestamp: now,
+			Notes:                fmt.Sprintf("Cycle count #%d", id),
+			ReasonCode:           reasonCode,
+			CountedQuantity:      &counted,
+		}
+		if _, err := PostTransaction(tx, &adjustment); err != nil {
+			return nil, postingFailure(err, "Failed to post adjustment")
+		}
+		adjustments = append(adjustments, adjustment)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE count_sessions SET status = 'approved', approved_at = ?, approved_by = ? WHERE id = ?
+	`, ledgerTime(now), approvedBy, id)
+	if err != nil {
+		return nil, err
+	}
+	return adjustments, nil
+}
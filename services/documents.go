@@ -0,0 +1,155 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"inventory-app/store"
+	"sort"
+	"time"
+)
+
+// DocumentTransactionTypes maps each stock document type to the ledger entries its lines post
+var DocumentTransactionTypes = map[string]string{
+	"receipt": "in",
+	"issue":   "out",
+}
+
+// documentNumberPrefixes are used to number documents created without a document number
+var documentNumberPrefixes = map[string]string{
+	"receipt": "GR",
+	"issue":   "GI",
+}
+
+// CreateStockDocument records a goods receipt or issue slip, posting every line to the ledger
+// inside tx, and fills in its ID, number, lines and total. A line issued from several lots is
+// posted, and returned, as one line per lot. The document's type and lines must already have
+// been validated.
+func CreateStockDocument(tx *sql.Tx, document *models.StockDocument) error {
+	transactionType := DocumentTransactionTypes[document.DocumentType]
+
+	// The products are locked before anything is checked, in a fixed order so two documents
+	// sharing products cannot each hold a lock the other is waiting for
+	productIDs := make([]int, 0, len(document.Lines))
+	for _, line := range document.Lines {
+		productIDs = append(productIDs, line.ProductID)
+	}
+	sort.Ints(productIDs)
+	for _, id := range productIDs {
+		if err := lockProduct(tx, id); err != nil {
+			return err
+		}
+	}
+
+	if document.LocationID == 0 {
+		document.LocationID = models.DefaultLocationID
+	}
+	found, err := locationExists(tx, document.LocationID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return store.Errorf(store.Invalid, "Unknown location")
+	}
+
+	if document.DocumentDate.IsZero() {
+		document.DocumentDate = time.Now()
+	}
+	closed, err := PeriodClosed(tx, document.DocumentDate)
+	if err != nil {
+		return fmt.Errorf("failed to check period status: %w", err)
+	}
+	if closed {
+		return store.Errorf(store.Conflict, "Document date falls inside a closed period")
+	}
+
+	var documentNumber any
+	if document.DocumentNumber != "" {
+		documentNumber = document.DocumentNumber
+	}
+	err = tx.QueryRow(`
+		INSERT INTO stock_documents (document_number, document_type, document_date, location_id, department, supplier, notes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		RETURNING id
+	`, documentNumber, document.DocumentType, ledgerTime(document.DocumentDate), document.LocationID, document.Department, document.Supplier, document.Notes).Scan(&document.ID)
+	if err != nil {
+		return store.Errorf(store.Conflict, "Failed to create document: %s", err)
+	}
+	document.CreatedAt = time.Now()
+
+	if document.DocumentNumber == "" {
+		document.DocumentNumber = fmt.Sprintf("%s-%06d", documentNumberPrefixes[document.DocumentType], document.ID)
+		if _, err := tx.Exec(`UPDATE stock_documents SET document_number = ? WHERE id = ?`, document.DocumentNumber, document.ID); err != nil {
+			return fmt.Errorf("failed to number document: %w", err)
+		}
+	}
+
+	posted := []models.DocumentLine{}
+	document.TotalValue = 0
+	for i := range document.Lines {
+		line := &document.Lines[i]
+
+		var code, name, unit sql.NullString
+		err := tx.QueryRow(`
+			SELECT p.code, p.name, p.unit FROM products p
+			JOIN inventory_summary i ON i.product_id = p.id
+			WHERE p.id = ?
+		`, line.ProductID).Scan(&code, &name, &unit)
+		if err == sql.ErrNoRows {
+			return store.Errorf(store.Unprocessable, "Line %d: product not found", i+1)
+		}
+		if err != nil {
+			return err
+		}
+		line.Code, line.Name, line.Unit = code.String, name.String, unit.String
+
+		// Issues are checked line by line, so earlier lines of the same product are taken into account
+		allocations := []models.LotAllocation{{LotNumber: line.LotNumber, ExpiryDate: line.ExpiryDate, Quantity: line.Quantity}}
+		if transactionType == "out" {
+			// A backdated issue must also leave every later balance at the location non-negative
+			_, lowest, err := LocationStockAt(tx, line.ProductID, document.LocationID, document.DocumentDate)
+			if err != nil {
+				return fmt.Errorf("failed to check current stock: %w", err)
+			}
+			if lowest < line.Quantity {
+				return store.Errorf(store.Invalid, "Line %d: insufficient stock for %s", i+1, line.Code)
+			}
+			allocations, err = AllocateLots(tx, line.ProductID, document.LocationID, line.LotNumber, line.Quantity)
+			if err != nil {
+				return store.Errorf(store.Invalid, "Line %d: invalid lot: %v", i+1, err)
+			}
+		}
+
+		line.TotalValue = line.Quantity * line.PricePerUnit
+		entry := models.StockTransaction{
+			ProductID:            line.ProductID,
+			LocationID:           document.LocationID,
+			TransactionType:      transactionType,
+			Quantity:             line.Quantity,
+			PricePerUnit:         line.PricePerUnit,
+			TotalValue:           line.TotalValue,
+			Department:           document.Department,
+			TransactionTimestamp: document.DocumentDate,
+			Notes:                line.Notes,
+			DocumentID:           &document.ID,
+			SerialNumbers:        line.SerialNumbers,
+		}
+		entries, _, err := PostAllocated(tx, entry, allocations)
+		if err != nil {
+			return postingFailure(err, "Line %d: failed to record transaction", i+1)
+		}
+		for _, e := range entries {
+			lot := *line
+			lot.TransactionID = e.ID
+			lot.Quantity = e.Quantity
+			lot.TotalValue = e.TotalValue
+			lot.LotNumber = e.LotNumber
+			lot.ExpiryDate = e.ExpiryDate
+			lot.SerialNumbers = e.SerialNumbers
+			posted = append(posted, lot)
+		}
+		document.TotalValue += line.TotalValue
+	}
+	document.Lines = posted
+	return nil
+}
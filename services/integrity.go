@@ -0,0 +1,217 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	integrityMu     sync.RWMutex
+	latestIntegrity *models.IntegrityReport
+)
+
+// CheckIntegrity compares every inventory_summary row with the aggregate of the ledger and
+// reports drift, negative ending stock, orphaned summaries and products without a summary.
+func CheckIntegrity(db *sql.DB) (*models.IntegrityReport, error) {
+	report := &models.IntegrityReport{
+		CheckedAt:         time.Now(),
+		SummaryDrift:      []models.SummaryRebuildResult{},
+		NegativeStock:     []models.IntegrityIssue{},
+		OrphanedSummaries: []models.IntegrityIssue{},
+		MissingSummaries:  []models.IntegrityIssue{},
+	}
+
+	// A read-only transaction gives the checks a consistent view of the database
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results, err := ReplayLedger(tx, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		switch {
+		case r.Stored == nil:
+			report.MissingSummaries = append(report.MissingSummaries, models.IntegrityIssue{
+				ProductID: r.ProductID, Code: r.Code, Name: r.Name,
+				Detail: "product has no inventory_summary row",
+			})
+		case r.Changed:
+			report.SummaryDrift = append(report.SummaryDrift, r)
+		}
+	}
+
+	rows, err := tx.Query(`
+		SELECT i.product_id, p.id IS NOT NULL, COALESCE(p.code, ''), COALESCE(p.name, ''), i.ending_stock
+		FROM inventory_summary i
+		LEFT JOIN products p ON p.id = i.product_id
+		WHERE p.id IS NULL OR i.ending_stock < 0
+		ORDER BY i.product_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var issue models.IntegrityIssue
+		var productExists bool
+		var endingStock float64
+		if err := rows.Scan(&issue.ProductID, &productExists, &issue.Code, &issue.Name, &endingStock); err != nil {
+			return nil, err
+		}
+		if !productExists {
+			issue.Detail = "inventory_summary row references a deleted product"
+			report.OrphanedSummaries = append(report.OrphanedSummaries, issue)
+			continue
+		}
+		issue.Detail = fmt.Sprintf("ending stock is negative (%g)", endingStock)
+		report.NegativeStock = append(report.NegativeStock, issue)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report.Healthy = len(report.SummaryDrift) == 0 && len(report.NegativeStock) == 0 &&
+		len(report.OrphanedSummaries) == 0 && len(report.MissingSummaries) == 0
+
+	return report, nil
+}
+
+// RunIntegrityCheck runs CheckIntegrity and keeps the result as the latest report.
+func RunIntegrityCheck(db *sql.DB) (*models.IntegrityReport, error) {
+	report, err := CheckIntegrity(db)
+	if err != nil {
+		return nil, err
+	}
+
+	integrityMu.Lock()
+	latestIntegrity = report
+	integrityMu.Unlock()
+
+	if !report.Healthy {
+		log.Printf("Integrity check found issues: %d drifted, %d negative, %d orphaned, %d missing summaries",
+			len(report.SummaryDrift), len(report.NegativeStock), len(report.OrphanedSummaries), len(report.MissingSummaries))
+	}
+	return report, nil
+}
+
+// LatestIntegrityReport returns the result of the most recent check, or nil if none has run yet.
+func LatestIntegrityReport() *models.IntegrityReport {
+	integrityMu.RLock()
+	defer integrityMu.RUnlock()
+	return latestIntegrity
+}
+
+// StartIntegrityChecker runs the integrity check immediately and then once every interval in the background.
+func StartIntegrityChecker(db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := RunIntegrityCheck(db); err != nil {
+				log.Printf("Integrity check failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// optionalReferences are the foreign key columns that may simply be cleared when the record
+// they point at is gone
+var optionalReferences = map[string]bool{
+	"products.category_id": true,
+	"categories.parent_id": true,
+}
+
+// RepairOrphans finds the rows that reference a missing record, as reported by SQLite's
+// foreign key check, plus stock checkpoints of deleted products. Optional references are
+// cleared and every other orphan is deleted (with the rows that cascade from it). With dryRun
+// the orphans are only counted.
+func RepairOrphans(db *sql.DB, dryRun bool) ([]models.OrphanRepair, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT c."table", f."from", c.parent, c.rowid
+		FROM pragma_foreign_key_check c
+		JOIN pragma_foreign_key_list(c."table") f ON f.id = c.fkid
+		ORDER BY c."table", f."from", c.rowid
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	type reference struct{ table, column, parent string }
+	var order []reference
+	orphans := map[reference][]int64{}
+	for rows.Next() {
+		var ref reference
+		var rowID int64
+		if err := rows.Scan(&ref.table, &ref.column, &ref.parent, &rowID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if _, seen := orphans[ref]; !seen {
+			order = append(order, ref)
+		}
+		orphans[ref] = append(orphans[ref], rowID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	repairs := []models.OrphanRepair{}
+	for _, ref := range order {
+		repair := models.OrphanRepair{Table: ref.table, Column: ref.column, Parent: ref.parent, Rows: len(orphans[ref]), Action: "deleted"}
+		statement := "DELETE FROM " + ref.table + " WHERE rowid = ?"
+		if optionalReferences[ref.table+"."+ref.column] {
+			repair.Action = "cleared"
+			statement = "UPDATE " + ref.table + " SET " + ref.column + " = NULL WHERE rowid = ?"
+		}
+		if !dryRun {
+			for _, rowID := range orphans[ref] {
+				if _, err := tx.Exec(statement, rowID); err != nil {
+					return nil, err
+				}
+			}
+		}
+		repairs = append(repairs, repair)
+	}
+
+	// Checkpoints are a cache without a foreign key of their own
+	var checkpoints int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM stock_checkpoints WHERE product_id NOT IN (SELECT id FROM products)
+	`).Scan(&checkpoints)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoints > 0 {
+		if !dryRun {
+			if _, err := tx.Exec(`DELETE FROM stock_checkpoints WHERE product_id NOT IN (SELECT id FROM products)`); err != nil {
+				return nil, err
+			}
+		}
+		repairs = append(repairs, models.OrphanRepair{
+			Table: "stock_checkpoints", Column: "product_id", Parent: "products", Rows: checkpoints, Action: "deleted",
+		})
+	}
+
+	if dryRun {
+		return repairs, nil
+	}
+	return repairs, tx.Commit()
+}
@@ -0,0 +1,376 @@
+package services
+
+import (
+	"database/sql"
+	"inventory-app/models"
+	"math"
+	"time"
+)
+
+// Apply updates the totals with a single stock movement booked at unitCost (see costing.cost).
+// It is the one place the running summary is computed, shared by PostTransaction and the
+// ledger rebuild. Reversals of voided transactions carry a negative quantity, which takes the
+// movement back out of the totals. Transfers move stock between locations and leave the
+// company-wide totals unchanged; see ApplyLocation.
+func Apply(totals *models.InventoryTotals, transactionType string, quantity, unitCost float64) {
+	switch transactionType {
+	case "in":
+		totals.TotalIn += quantity
+	case "out":
+		totals.TotalOut += quantity
+	case "adjustment":
+		// Adjustments carry the signed difference from a physical count
+		totals.TotalAdjustment += quantity
+	default:
+		return
+	}
+	revalue(totals, stockDelta(transactionType, quantity), unitCost)
+}
+
+// ApplyLocation updates the stock of a single location with a movement. It is Apply, except
+// that a transfer leaving the location counts as a stock-out and a transfer arriving counts as
+// a stock-in.
+func ApplyLocation(totals *models.InventoryTotals, transactionType string, quantity, unitCost float64) {
+	switch transactionType {
+	case "transfer_out":
+		totals.TotalOut += quantity
+	case "transfer_in":
+		totals.TotalIn += quantity
+	default:
+		Apply(totals, transactionType, quantity, unitCost)
+		return
+	}
+	revalue(totals, locationDelta(transactionType, quantity), unitCost)
+}
+
+// revalue adds delta units at unitCost to the stock and recomputes the average price as the
+// value of the stock on hand over its quantity. Once the stock is gone the last average
+// price is kept for the next unpriced movement.
+func revalue(totals *models.InventoryTotals, delta, unitCost float64) {
+	totals.EndingStock += delta
+	totals.StockValue += delta * unitCost
+	if totals.EndingStock > stockEpsilon {
+		totals.AveragePrice = totals.StockValue / totals.EndingStock
+	} else {
+		totals.StockValue = 0
+	}
+}
+
+// totalsEqual compares two summaries, ignoring floating point noise
+func totalsEqual(a, b models.InventoryTotals) bool {
+	const epsilon = 1e-6
+	return math.Abs(a.TotalIn-b.TotalIn) < epsilon &&
+		math.Abs(a.TotalOut-b.TotalOut) < epsilon &&
+		math.Abs(a.TotalAdjustment-b.TotalAdjustment) < epsilon &&
+		math.Abs(a.EndingStock-b.EndingStock) < epsilon &&
+		math.Abs(a.AveragePrice-b.AveragePrice) < epsilon &&
+		math.Abs(a.StockValue-b.StockValue) < epsilon
+}
+
+// locationKey identifies the stock of one product at one location
+type locationKey struct {
+	productID, locationID int
+}
+
+// ReplayLedger recomputes the summary totals of every product (or only productID when it is
+// non-zero) by replaying stock_transactions in timestamp order, and compares them with the
+// stored inventory_summary and location_stock rows. Every entry is costed afresh in that
+// order; a reversal takes the cost of the entry it reverses.
+func ReplayLedger(tx *sql.Tx, productID int) ([]models.SummaryRebuildResult, error) {
+	rows, err := tx.Query(`
+		SELECT
+			p.id, p.code, p.name,
+			i.product_id IS NOT NULL,
+			COALESCE(i.total_in, 0), COALESCE(i.total_out, 0), COALESCE(i.total_adjustment, 0),
+			COALESCE(i.ending_stock, 0), COALESCE(i.average_price, 0), COALESCE(i.stock_value, 0),
+			COALESCE(p.costing_method, '')
+		FROM
+			products p
+		LEFT JOIN
+			inventory_summary i ON i.product_id = p.id
+		WHERE
+			? = 0 OR p.id = ?
+		ORDER BY
+			p.id
+	`, productID, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []models.SummaryRebuildResult{}
+	index := map[int]int{}
+	costings := []*costing{}
+	for rows.Next() {
+		var r models.SummaryRebuildResult
+		var hasSummary bool
+		var stored models.InventoryTotals
+		c := &costing{}
+		if err := rows.Scan(&r.ProductID, &r.Code, &r.Name, &hasSummary,
+			&stored.TotalIn, &stored.TotalOut, &stored.TotalAdjustment, &stored.EndingStock, &stored.AveragePrice, &stored.StockValue,
+			&c.method); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if hasSummary {
+			r.Stored = &stored
+		}
+		if c.method == "" {
+			c.method = DefaultCostingMethod
+		}
+		index[r.ProductID] = len(results)
+		results = append(results, r)
+		costings = append(costings, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Stored per-location stock, compared against the replay below
+	locations := map[locationKey]*models.LocationRebuildResult{}
+	var locationOrder []locationKey
+	rows, err = tx.Query(`
+		SELECT product_id, location_id, total_in, total_out, total_adjustment, ending_stock, average_price, stock_value
+		FROM location_stock
+		WHERE ? = 0 OR product_id = ?
+	`, productID, productID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key locationKey
+		var stored models.InventoryTotals
+		if err := rows.Scan(&key.productID, &key.locationID,
+			&stored.TotalIn, &stored.TotalOut, &stored.TotalAdjustment, &stored.EndingStock, &stored.AveragePrice, &stored.StockValue); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		locations[key] = &models.LocationRebuildResult{LocationID: key.locationID, Stored: &stored}
+		locationOrder = append(locationOrder, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ledger, err := tx.Query(`
+		SELECT id, product_id, location_id, transaction_type, quantity, COALESCE(price_per_unit, 0),
+			unit_cost, reversal_of, transfer_id
+		FROM stock_transactions
+		WHERE ? = 0 OR product_id = ?
+		ORDER BY transaction_timestamp, id
+	`, productID, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer ledger.Close()
+
+	costs := map[int]float64{}                    // replayed unit cost by ledger id, for reversals
+	transferred := map[int]*models.StockBalance{} // replayed quantity and cost dispatched by transfer id
+	for ledger.Next() {
+		var t models.StockTransaction
+		var storedCost sql.NullFloat64
+		var reversalOf, transferID sql.NullInt64
+		if err := ledger.Scan(&t.ID, &t.ProductID, &t.LocationID, &t.TransactionType, &t.Quantity, &t.PricePerUnit,
+			&storedCost, &reversalOf, &transferID); err != nil {
+			return nil, err
+		}
+		if reversalOf.Valid {
+			id := int(reversalOf.Int64)
+			t.ReversalOf = &id
+			// A reversal whose original is not replayed before it keeps its recorded cost
+			t.UnitCost = storedCost.Float64
+			if cost, ok := costs[id]; ok {
+				t.UnitCost = cost
+			}
+		}
+		// A transfer arrives at the cost its dispatch was replayed at
+		if transferID.Valid && t.TransactionType == "transfer_in" {
+			if out, ok := transferred[int(transferID.Int64)]; ok && out.Quantity > 0 {
+				t.UnitCost = out.Value / out.Quantity
+			}
+		}
+		key := locationKey{t.ProductID, t.LocationID}
+		i, ok := index[key.productID]
+		if !ok {
+			continue // ledger rows of deleted products have no summary to rebuild
+		}
+		location, ok := locations[key]
+		if !ok {
+			location = &models.LocationRebuildResult{LocationID: key.locationID}
+			locations[key] = location
+			locationOrder = append(locationOrder, key)
+		}
+
+		costings[i].cost(results[i].Rebuilt, location.Rebuilt, &t)
+		costs[t.ID] = t.UnitCost
+		if transferID.Valid && t.TransactionType == "transfer_out" {
+			out, ok := transferred[int(transferID.Int64)]
+			if !ok {
+				out = &models.StockBalance{}
+				transferred[int(transferID.Int64)] = out
+			}
+			out.Quantity += t.Quantity
+			out.Value += t.CostTotal
+		}
+		if locationDelta(t.TransactionType, t.Quantity) != 0 && (!storedCost.Valid || math.Abs(storedCost.Float64-t.UnitCost) > 1e-9) {
+			results[i].Costs = append(results[i].Costs, models.TransactionCost{
+				TransactionID: t.ID, UnitCost: t.UnitCost, CostTotal: t.CostTotal,
+			})
+		}
+		Apply(&results[i].Rebuilt, t.TransactionType, t.Quantity, t.UnitCost)
+		ApplyLocation(&location.Rebuilt, t.TransactionType, t.Quantity, locationUnitCost(costings[i].method, location.Rebuilt, t))
+	}
+	if err := ledger.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, key := range locationOrder {
+		location := locations[key]
+		i, ok := index[key.productID]
+		if !ok || (location.Stored != nil && totalsEqual(*location.Stored, location.Rebuilt)) {
+			continue
+		}
+		results[i].Locations = append(results[i].Locations, *location)
+	}
+
+	for i := range results {
+		if costings[i].method == FIFO {
+			results[i].CostLayers = costings[i].layers
+		}
+		results[i].Changed = results[i].Stored == nil || !totalsEqual(*results[i].Stored, results[i].Rebuilt) ||
+			len(results[i].Locations) > 0
+	}
+
+	return results, nil
+}
+
+// RebuildInventorySummary replays the ledger and, unless dryRun is set, writes the rebuilt
+// totals back to inventory_summary and location_stock. Only the products whose stored
+// values differed are returned.
+func RebuildInventorySummary(db *sql.DB, productID int, dryRun bool) ([]models.SummaryRebuildResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results, err := ReplayLedger(tx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []models.SummaryRebuildResult{}
+	for _, r := range results {
+		if r.Changed {
+			changed = append(changed, r)
+		}
+		if dryRun {
+			continue
+		}
+		if err := saveReplayed(tx, r); err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		return changed, nil
+	}
+	return changed, tx.Commit()
+}
+
+// BackfillCosts rebuilds the inventory summary when stock movements of existing products have
+// no recorded cost, as the ones posted before costing was added (or transfers before transfer
+// costing) do, so reports valuing them see the cost they replay at. It returns how many
+// movements were uncosted, and is a no-op once every movement is costed.
+func BackfillCosts(db *sql.DB) (int, error) {
+	var uncosted int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM stock_transactions st
+		JOIN products p ON p.id = st.product_id
+		WHERE st.unit_cost IS NULL AND st.quantity <> 0
+			AND st.transaction_type IN ('in', 'out', 'adjustment', 'transfer_in', 'transfer_out')
+	`).Scan(&uncosted)
+	if err != nil || uncosted == 0 {
+		return 0, err
+	}
+
+	if _, err := RebuildInventorySummary(db, 0, false); err != nil {
+		return 0, err
+	}
+	return uncosted, nil
+}
+
+// repostProduct replays the ledger of one product and writes the result, so the running
+// balances and costs of every entry follow the ledger's timestamp order
+func repostProduct(tx *sql.Tx, productID int) error {
+	results, err := ReplayLedger(tx, productID)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if err := saveReplayed(tx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveReplayed writes the replayed costs and FIFO layers of a product and, when they differ
+// from the stored ones, its summary and location stock. Checkpoints replayed with the old
+// costs are discarded.
+func saveReplayed(tx *sql.Tx, r models.SummaryRebuildResult) error {
+	if len(r.Costs) > 0 {
+		// Costs are listed in ledger order, so the first one changes the earliest balance
+		var timestamp time.Time
+		err := tx.QueryRow(`SELECT transaction_timestamp FROM stock_transactions WHERE id = ?`, r.Costs[0].TransactionID).Scan(&timestamp)
+		if err != nil {
+			return err
+		}
+		if err := invalidateCheckpoints(tx, timestamp); err != nil {
+			return err
+		}
+	}
+	for _, cost := range r.Costs {
+		_, err := tx.Exec(`UPDATE stock_transactions SET unit_cost = ?, cost_total = ? WHERE id = ?`,
+			cost.UnitCost, cost.CostTotal, cost.TransactionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// FIFO layers are not compared, so they are rewritten for every product
+	if r.CostLayers != nil {
+		if err := saveCostLayers(tx, r.ProductID, r.CostLayers); err != nil {
+			return err
+		}
+	}
+	if !r.Changed {
+		return nil
+	}
+
+	// Opening stock and the low stock threshold are not derived from the ledger and are kept
+	_, err := tx.Exec(`
+		INSERT INTO inventory_summary (product_id, opening_stock, total_in, total_out, total_adjustment, ending_stock, average_price, stock_value)
+		VALUES (?, 0, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(product_id) DO UPDATE SET
+			total_in = excluded.total_in,
+			total_out = excluded.total_out,
+			total_adjustment = excluded.total_adjustment,
+			ending_stock = excluded.ending_stock,
+			average_price = excluded.average_price,
+			stock_value = excluded.stock_value
+	`, r.ProductID, r.Rebuilt.TotalIn, r.Rebuilt.TotalOut, r.Rebuilt.TotalAdjustment, r.Rebuilt.EndingStock, r.Rebuilt.AveragePrice,
+		r.Rebuilt.StockValue)
+	if err != nil {
+		return err
+	}
+
+	for _, location := range r.Locations {
+		if err := saveLocationStock(tx, r.ProductID, location.LocationID, location.Rebuilt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"math"
+)
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// lotEpsilon is the balance below which a lot is considered used up
+const lotEpsilon = 1e-9
+
+// LotBalances derives the on-hand balance of every lot of a product at a location from the
+// ledger, in FEFO order: earliest expiry first, lots without an expiry date last. Lots that
+// have been used up are left out. A zero productID or locationID matches every product or
+// location.
+func LotBalances(q queryer, productID, locationID int) ([]models.LotBalance, error) {
+	rows, err := q.Query(`
+		SELECT * FROM (
+			SELECT
+				st.product_id, COALESCE(p.code, '') AS code, COALESCE(p.name, '') AS name, st.location_id, st.lot_number,
+				COALESCE(MAX(NULLIF(st.expiry_date, '')), '') AS expiry,
+				SUM(CASE WHEN st.transaction_type IN ('out', 'transfer_out') THEN -st.quantity ELSE st.quantity END) AS balance
+			FROM
+				stock_transactions st
+			LEFT JOIN
+				products p ON p.id = st.product_id
+			WHERE
+				(? = 0 OR st.product_id = ?) AND (? = 0 OR st.location_id = ?) AND COALESCE(st.lot_number, '') <> ''
+			GROUP BY
+				st.product_id, st.location_id, st.lot_number, p.code, p.name
+		) lots
+		WHERE
+			balance > ?
+		ORDER BY
+			expiry = '', expiry, lot_number
+	`, productID, productID, locationID, locationID, lotEpsilon)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lots := []models.LotBalance{}
+	for rows.Next() {
+		var l models.LotBalance
+		if err := rows.Scan(&l.ProductID, &l.Code, &l.Name, &l.LocationID, &l.LotNumber, &l.ExpiryDate, &l.Quantity); err != nil {
+			return nil, err
+		}
+		lots = append(lots, l)
+	}
+	return lots, rows.Err()
+}
+
+// AllocateLots picks the stock a movement of quantity out of a location takes. With a lot
+// number only that lot is used and it must hold enough; otherwise lots are consumed FEFO and
+// any remainder comes from stock that was received without a lot. Stock without any lots at
+// the location needs no allocation, and gets none (nil). The caller checks the location has
+// enough stock overall.
+func AllocateLots(q queryer, productID, locationID int, lotNumber string, quantity float64) ([]models.LotAllocation, error) {
+	lots, err := LotBalances(q, productID, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if lotNumber != "" {
+		for _, l := range lots {
+			if l.LotNumber == lotNumber {
+				if l.Quantity+lotEpsilon < quantity {
+					return nil, fmt.Errorf("lot %s holds only %g", lotNumber, l.Quantity)
+				}
+				return []models.LotAllocation{{LotNumber: l.LotNumber, ExpiryDate: l.ExpiryDate, Quantity: quantity}}, nil
+			}
+		}
+		return nil, fmt.Errorf("lot %s has no stock at this location", lotNumber)
+	}
+	if len(lots) == 0 {
+		return nil, nil
+	}
+
+	allocations := []models.LotAllocation{}
+	remaining := quantity
+	for _, l := range lots {
+		if remaining <= lotEpsilon {
+			break
+		}
+		take := math.Min(l.Quantity, remaining)
+		allocations = append(allocations, models.LotAllocation{LotNumber: l.LotNumber, ExpiryDate: l.ExpiryDate, Quantity: take})
+		remaining -= take
+	}
+	if remaining > lotEpsilon {
+		allocations = append(allocations, models.LotAllocation{Quantity: remaining})
+	}
+	return allocations, nil
+}
+
+// PostAllocated posts t once per lot allocation, each entry carrying its lot and its share of
+// the quantity and value, or as a single entry without allocations. The result spans all
+// entries: Before is the stock before the first and After the stock after the last.
+func PostAllocated(tx *sql.Tx, t models.StockTransaction, allocations []models.LotAllocation) ([]models.StockTransaction, PostingResult, error) {
+	if allocations == nil {
+		posting, err := PostTransaction(tx, &t)
+		if err != nil {
+			return nil, posting, err
+		}
+		return []models.StockTransaction{t}, posting, nil
+	}
+
+	var result PostingResult
+	entries := []models.StockTransaction{}
+	for i, a := range allocations {
+		entry := t
+		entry.LotNumber = a.LotNumber
+		entry.ExpiryDate = a.ExpiryDate
+		entry.Quantity = a.Quantity
+		if t.Quantity != 0 {
+			entry.TotalValue = t.TotalValue * a.Quantity / t.Quantity
+		}
+
+		posting, err := PostTransaction(tx, &entry)
+		if err != nil {
+			return nil, result, err
+		}
+		if i == 0 {
+			result.Before, result.LocationBefore = posting.Before, posting.LocationBefore
+		}
+		result.After, result.LocationAfter = posting.After, posting.LocationAfter
+		entries = append(entries, entry)
+	}
+	return entries, result, nil
+}
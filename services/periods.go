@@ -0,0 +1,161 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"inventory-app/store"
+	"time"
+)
+
+// PeriodClosed reports whether the month containing t (in UTC, as the ledger stores it) is
+// locked. Periods are closed in order, so every month up to and including the latest closed
+// period is locked.
+func PeriodClosed(q queryer, t time.Time) (bool, error) {
+	latest, err := latestClosedPeriod(q)
+	if err != nil {
+		return false, err
+	}
+	return latest != "" && t.UTC().Format("2006-01") <= latest, nil
+}
+
+// latestClosedPeriod returns the most recent closed period, or "" when nothing has been closed yet
+func latestClosedPeriod(q queryer) (string, error) {
+	var latest sql.NullString
+	err := q.QueryRow(`SELECT MAX(period) FROM periods WHERE status = 'closed'`).Scan(&latest)
+	return latest.String, err
+}
+
+// ClosePeriod closes the month starting at monthStart (period, as YYYY-MM) inside tx: it
+// snapshots each product's balances for the month, carries the ending stock forward as the
+// opening stock and locks the month against new transactions. The close is written to the
+// audit log.
+func ClosePeriod(tx *sql.Tx, period string, monthStart time.Time, performedBy, reason string) ([]models.PeriodBalance, error) {
+	if monthStart.AddDate(0, 1, 0).After(time.Now()) {
+		return nil, store.Errorf(store.Invalid, "Cannot close a period that has not ended yet")
+	}
+
+	// Every product is locked first, so postings still under way finish before the snapshot
+	// and later ones find the period closed
+	if _, err := tx.Exec(`UPDATE inventory_summary SET product_id = product_id`); err != nil {
+		return nil, fmt.Errorf("failed to lock inventory: %w", err)
+	}
+
+	// Periods are closed in order so every carried-forward balance is final
+	latest, err := latestClosedPeriod(tx)
+	if err != nil {
+		return nil, err
+	}
+	if latest != "" {
+		if latest >= period {
+			return nil, store.Errorf(store.Conflict, "Period %s is already closed", latest)
+		}
+		latestStart, _ := time.Parse("2006-01", latest)
+		if expected := latestStart.AddDate(0, 1, 0).Format("2006-01"); expected != period {
+			return nil, store.Errorf(store.Conflict, "Period %s must be closed first", expected)
+		}
+	}
+
+	report, err := MonthlyReport(tx, monthStart)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO periods (period, status, closed_at) VALUES (?, 'closed', CURRENT_TIMESTAMP)
+		ON CONFLICT(period) DO UPDATE SET status = 'closed', closed_at = CURRENT_TIMESTAMP
+	`, period)
+	if err != nil {
+		return nil, fmt.Errorf("failed to close period: %w", err)
+	}
+
+	balances := []models.PeriodBalance{}
+	for _, item := range report {
+		_, err = tx.Exec(`
+			INSERT INTO period_balances
+			(period, product_id, opening_stock, total_in, total_out, total_adjustment, ending_stock, average_price, total_value)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, period, item.ProductID, item.OpeningStock, item.StockIn, item.StockOut, item.Adjustment, item.EndingStock, item.AveragePrice, item.TotalValue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store period balance: %w", err)
+		}
+
+		// The ending stock of the closed period is the opening stock of the next one
+		_, err = tx.Exec(`UPDATE inventory_summary SET opening_stock = ? WHERE product_id = ?`, item.EndingStock, item.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to carry forward opening stock: %w", err)
+		}
+
+		balances = append(balances, models.PeriodBalance{
+			Period:       period,
+			ProductID:    item.ProductID,
+			Code:         item.Code,
+			Name:         item.Name,
+			OpeningStock: item.OpeningStock,
+			TotalIn:      item.StockIn,
+			TotalOut:     item.StockOut,
+			Adjustment:   item.Adjustment,
+			EndingStock:  item.EndingStock,
+			AveragePrice: item.AveragePrice,
+			TotalValue:   item.TotalValue,
+		})
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO period_audit_log (period, action, performed_by, reason, performed_at)
+		VALUES (?, 'close', ?, ?, CURRENT_TIMESTAMP)
+	`, period, performedBy, reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return balances, nil
+}
+
+// ReopenPeriod reopens the most recently closed period (YYYY-MM) inside tx and audits it.
+// Opening stock falls back to the balances of the previous closed period, if any.
+func ReopenPeriod(tx *sql.Tx, period, performedBy, reason string) error {
+	latest, err := latestClosedPeriod(tx)
+	if err != nil {
+		return err
+	}
+	if latest != period {
+		if latest == "" || latest < period {
+			return store.Errorf(store.Conflict, "Period %s is not closed", period)
+		}
+		return store.Errorf(store.Conflict, "Only the latest closed period (%s) can be reopened", latest)
+	}
+
+	_, err = tx.Exec(`UPDATE periods SET status = 'open', closed_at = NULL WHERE period = ?`, period)
+	if err != nil {
+		return fmt.Errorf("failed to reopen period: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM period_balances WHERE period = ?`, period)
+	if err != nil {
+		return fmt.Errorf("failed to remove period balances: %w", err)
+	}
+
+	previous, err := latestClosedPeriod(tx)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE inventory_summary
+		SET opening_stock = COALESCE((
+			SELECT pb.ending_stock FROM period_balances pb
+			WHERE pb.period = ? AND pb.product_id = inventory_summary.product_id
+		), 0)
+	`, previous)
+	if err != nil {
+		return fmt.Errorf("failed to restore opening stock: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO period_audit_log (period, action, performed_by, reason, performed_at)
+		VALUES (?, 'reopen', ?, ?, CURRENT_TIMESTAMP)
+	`, period, performedBy, reason)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
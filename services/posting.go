@@ -0,0 +1,233 @@
+package services
+
+import (
+	"database/sql"
+	"inventory-app/models"
+	"inventory-app/store"
+	"math"
+	"time"
+)
+
+// ErrProductArchived is returned when posting a new movement of an archived product
+var ErrProductArchived = store.Errorf(store.Conflict, "Product is archived")
+
+// PostingResult holds the stock of the posted product before and after the movement, both
+// company-wide (inventory_summary) and at the transaction's location (location_stock).
+type PostingResult struct {
+	Before, After                 models.InventoryTotals
+	LocationBefore, LocationAfter models.InventoryTotals
+}
+
+// ledgerTime converts t to UTC in models.TimestampLayout. Every timestamp written to the ledger, and
+// every value a stored timestamp is compared with, goes through it, so entries sent with
+// different offsets sort in the order they happened and scan back on either database.
+func ledgerTime(t time.Time) string {
+	return t.UTC().Format(models.TimestampLayout)
+}
+
+// rowQueryer is satisfied by both *sql.DB and *sql.Tx
+type rowQueryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// LocationStock returns the stock of a product at a location; a product that has never been
+// stocked there has zero totals.
+func LocationStock(q rowQueryer, productID, locationID int) (models.InventoryTotals, error) {
+	var totals models.InventoryTotals
+	err := q.QueryRow(`
+		SELECT total_in, total_out, total_adjustment, ending_stock, average_price, stock_value
+		FROM location_stock WHERE product_id = ? AND location_id = ?
+	`, productID, locationID).Scan(&totals.TotalIn, &totals.TotalOut, &totals.TotalAdjustment, &totals.EndingStock, &totals.AveragePrice,
+		&totals.StockValue)
+	if err == sql.ErrNoRows {
+		return totals, nil
+	}
+	return totals, err
+}
+
+// saveLocationStock writes the stock of a product at a location
+func saveLocationStock(tx *sql.Tx, productID, locationID int, totals models.InventoryTotals) error {
+	_, err := tx.Exec(`
+		INSERT INTO location_stock (product_id, location_id, total_in, total_out, total_adjustment, ending_stock, average_price, stock_value)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(product_id, location_id) DO UPDATE SET
+			total_in = excluded.total_in,
+			total_out = excluded.total_out,
+			total_adjustment = excluded.total_adjustment,
+			ending_stock = excluded.ending_stock,
+			average_price = excluded.average_price,
+			stock_value = excluded.stock_value
+	`, productID, locationID, totals.TotalIn, totals.TotalOut, totals.TotalAdjustment, totals.EndingStock, totals.AveragePrice, totals.StockValue)
+	return err
+}
+
+// lockProduct takes the product's summary row for the rest of tx, so concurrent postings
+// against a shared database apply one after the other instead of overwriting each other's
+// balances. ClosePeriod takes every row, so a posting that checks the period once it holds the
+// lock cannot slip into a period being closed. Taking the lock again in the same tx is a no-op.
+func lockProduct(tx *sql.Tx, productID int) error {
+	_, err := tx.Exec(`UPDATE inventory_summary SET product_id = product_id WHERE product_id = ?`, productID)
+	return err
+}
+
+// PostTransaction inserts t into the stock_transactions ledger, costs it with the product's
+// costing method and applies it to the product's inventory_summary and location_stock rows,
+// all inside tx. On success t.ID, t.UnitCost and t.CostTotal are set. A zero
+// t.LocationID is recorded at the default location. Validation is left to the caller, except
+// for serial numbers, which are checked against the units on hand (see applySerials).
+func PostTransaction(tx *sql.Tx, t *models.StockTransaction) (PostingResult, error) {
+	var r PostingResult
+	if t.LocationID == 0 {
+		t.LocationID = models.DefaultLocationID
+	}
+
+	// Archived products only take entries that settle earlier movements: reversals and the
+	// arrival of transfers already under way
+	if t.ReversalOf == nil && t.TransactionType != "transfer_in" {
+		var archived bool
+		if err := tx.QueryRow(`SELECT archived_at IS NOT NULL FROM products WHERE id = ?`, t.ProductID).Scan(&archived); err != nil {
+			return r, err
+		}
+		if archived {
+			return r, ErrProductArchived
+		}
+	}
+
+	if err := lockProduct(tx, t.ProductID); err != nil {
+		return r, err
+	}
+
+	err := tx.QueryRow(`
+		SELECT total_in, total_out, total_adjustment, ending_stock, average_price, stock_value
+		FROM inventory_summary WHERE product_id = ?
+	`, t.ProductID).Scan(&r.Before.TotalIn, &r.Before.TotalOut, &r.Before.TotalAdjustment, &r.Before.EndingStock, &r.Before.AveragePrice,
+		&r.Before.StockValue)
+	if err != nil {
+		return r, err
+	}
+
+	costing, err := loadCosting(tx, t.ProductID)
+	if err != nil {
+		return r, err
+	}
+
+	r.LocationBefore, err = LocationStock(tx, t.ProductID, t.LocationID)
+	if err != nil {
+		return r, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO stock_transactions
+		(product_id, location_id, transaction_type, quantity, price_per_unit, total_value, department, transaction_timestamp, notes,
+		reversal_of, reason_code, counted_quantity, transfer_id, document_id, lot_number, expiry_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, t.ProductID, t.LocationID, t.TransactionType, t.Quantity, t.PricePerUnit, t.TotalValue, t.Department, ledgerTime(t.TransactionTimestamp), t.Notes,
+		t.ReversalOf, t.ReasonCode, t.CountedQuantity, t.TransferID, t.DocumentID, t.LotNumber, t.ExpiryDate).Scan(&t.ID)
+	if err != nil {
+		return r, err
+	}
+
+	if err := invalidateCheckpoints(tx, t.TransactionTimestamp); err != nil {
+		return r, err
+	}
+	if err := applySerials(tx, t); err != nil {
+		return r, err
+	}
+
+	// FIFO layers are keyed by the receipt's ledger id, so the entry is costed once inserted
+	costing.cost(r.Before, r.LocationBefore, t)
+	_, err = tx.Exec(`UPDATE stock_transactions SET unit_cost = ?, cost_total = ? WHERE id = ?`, t.UnitCost, t.CostTotal, t.ID)
+	if err != nil {
+		return r, err
+	}
+	if costing.method == FIFO {
+		if err := saveCostLayers(tx, t.ProductID, costing.layers); err != nil {
+			return r, err
+		}
+	}
+
+	r.After = r.Before
+	Apply(&r.After, t.TransactionType, t.Quantity, t.UnitCost)
+
+	_, err = tx.Exec(`
+		UPDATE inventory_summary
+		SET total_in = ?, total_out = ?, total_adjustment = ?, ending_stock = ?, average_price = ?, stock_value = ?
+		WHERE product_id = ?
+	`, r.After.TotalIn, r.After.TotalOut, r.After.TotalAdjustment, r.After.EndingStock, r.After.AveragePrice, r.After.StockValue, t.ProductID)
+	if err != nil {
+		return r, err
+	}
+
+	r.LocationAfter = r.LocationBefore
+	ApplyLocation(&r.LocationAfter, t.TransactionType, t.Quantity, locationUnitCost(costing.method, r.LocationBefore, *t))
+	if err := saveLocationStock(tx, t.ProductID, t.LocationID, r.LocationAfter); err != nil {
+		return r, err
+	}
+
+	// A backdated entry changes the running balance and cost of every entry after it, so the
+	// product's ledger is replayed in timestamp order
+	var backdated bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM stock_transactions WHERE product_id = ? AND transaction_timestamp > ?)
+	`, t.ProductID, ledgerTime(t.TransactionTimestamp)).Scan(&backdated)
+	if err != nil || !backdated {
+		return r, err
+	}
+	if err := repostProduct(tx, t.ProductID); err != nil {
+		return r, err
+	}
+
+	err = tx.QueryRow(`
+		SELECT total_in, total_out, total_adjustment, ending_stock, average_price, stock_value
+		FROM inventory_summary WHERE product_id = ?
+	`, t.ProductID).Scan(&r.After.TotalIn, &r.After.TotalOut, &r.After.TotalAdjustment, &r.After.EndingStock, &r.After.AveragePrice,
+		&r.After.StockValue)
+	if err != nil {
+		return r, err
+	}
+	err = tx.QueryRow(`SELECT unit_cost, cost_total FROM stock_transactions WHERE id = ?`, t.ID).Scan(&t.UnitCost, &t.CostTotal)
+	if err != nil {
+		return r, err
+	}
+	r.LocationAfter, err = LocationStock(tx, t.ProductID, t.LocationID)
+	return r, err
+}
+
+// LocationStockAt returns the stock of a product at a location once every ledger entry up to
+// and including at has been posted, and the lowest stock the location holds from then on. A
+// backdated movement taking stock out must fit within the lowest stock, or some later balance
+// would go negative.
+func LocationStockAt(q queryer, productID, locationID int, at time.Time) (stock, lowest float64, err error) {
+	rows, err := q.Query(`
+		SELECT transaction_timestamp > ?, transaction_type, quantity
+		FROM stock_transactions
+		WHERE product_id = ? AND location_id = ?
+		ORDER BY transaction_timestamp, id
+	`, ledgerTime(at), productID, locationID)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	balance, lowest, later := 0.0, 0.0, false
+	for rows.Next() {
+		var after bool
+		var transactionType string
+		var quantity float64
+		if err := rows.Scan(&after, &transactionType, &quantity); err != nil {
+			return 0, 0, err
+		}
+		if after && !later {
+			stock, lowest, later = balance, balance, true
+		}
+		balance += locationDelta(transactionType, quantity)
+		if later {
+			lowest = math.Min(lowest, balance)
+		}
+	}
+	if !later {
+		stock, lowest = balance, balance
+	}
+	return stock, lowest, rows.Err()
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"inventory-app/models"
+	"time"
+)
+
+// MonthlyReport computes the monthly inventory report for the month starting at monthStart:
+// opening stock from all ledger rows before the month, stock in/out during the month, ending
+// stock, and its average cost and value at month end as posted by each product's costing method.
+func MonthlyReport(q queryer, monthStart time.Time) ([]models.MonthlyInventoryReport, error) {
+	// The month covers [startDate, endDate): endDate is the first day of the next month
+	startDate := monthStart.Format("2006-01-02")
+	endDate := monthStart.AddDate(0, 1, 0).Format("2006-01-02")
+
+	// The stock is valued at the costs it was posted at, replayed to the end of the month
+	stock, err := StockAsOf(q, monthStart.AddDate(0, 1, -1), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	values := map[int]models.StockOnHand{}
+	for _, s := range stock {
+		values[s.ProductID] = s
+	}
+
+	rows, err := q.Query(`
+		SELECT 
+			p.id, p.code, p.name, p.unit, COALESCE(p.category, ''),
+			COALESCE(SUM(CASE WHEN st.transaction_timestamp < ? THEN
+				CASE st.transaction_type WHEN 'out' THEN -st.quantity WHEN 'in' THEN st.quantity WHEN 'adjustment' THEN st.quantity ELSE 0 END
+			ELSE 0 END), 0) AS opening_stock, -- transfers do not change the company total
+			COALESCE(SUM(CASE WHEN st.transaction_timestamp >= ? AND st.transaction_type = 'in' THEN st.quantity ELSE 0 END), 0) AS stock_in,
+			COALESCE(SUM(CASE WHEN st.transaction_timestamp >= ? AND st.transaction_type = 'out' THEN st.quantity ELSE 0 END), 0) AS stock_out,
+			COALESCE(SUM(CASE WHEN st.transaction_timestamp >= ? AND st.transaction_type = 'adjustment' THEN st.quantity ELSE 0 END), 0) AS adjustment
+		FROM 
+			products p
+		LEFT JOIN 
+			stock_transactions st ON p.id = st.product_id AND st.transaction_timestamp < ?
+		GROUP BY 
+			p.id
+		ORDER BY 
+			p.code
+	`, startDate, startDate, startDate, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.MonthlyInventoryReport{}
+	for rows.Next() {
+		var item models.MonthlyInventoryReport
+		err := rows.Scan(&item.ProductID, &item.Code, &item.Name, &item.Unit, &item.Category,
+			&item.OpeningStock, &item.StockIn, &item.StockOut, &item.Adjustment)
+		if err != nil {
+			return nil, err
+		}
+
+		item.EndingStock = item.OpeningStock + item.StockIn - item.StockOut + item.Adjustment
+		value := values[item.ProductID]
+		item.AveragePrice, item.TotalValue = value.AveragePrice, value.StockValue
+		results = append(results, item)
+	}
+
+	return results, rows.Err()
+}
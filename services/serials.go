@@ -0,0 +1,102 @@
+package services
+
+import (
+	"database/sql"
+	"inventory-app/models"
+	"inventory-app/store"
+	"math"
+)
+
+// applySerials checks the serial numbers of a posted ledger entry against the units on hand
+// and moves them: units arriving are put in stock at the location, units leaving are taken
+// out (or put in transit, for a transfer). Serialized products must name exactly one serial
+// per unit; other products must not name any. Serial numbers that do not fit the stock are
+// reported as Invalid store errors. Serialized products are never adjusted, as an
+// adjustment's quantity is worked out by the server and cannot name the units it moves.
+func applySerials(tx *sql.Tx, t *models.StockTransaction) error {
+	var serialized bool
+	if err := tx.QueryRow(`SELECT serialized FROM products WHERE id = ?`, t.ProductID).Scan(&serialized); err != nil {
+		return err
+	}
+	if !serialized {
+		if len(t.SerialNumbers) > 0 {
+			return store.Errorf(store.Invalid, "Product %d is not serialized", t.ProductID)
+		}
+		return nil
+	}
+
+	if t.LotNumber != "" {
+		return store.Errorf(store.Invalid, "Serialized products are tracked by serial number, not by lot")
+	}
+	if t.TransactionType == "adjustment" {
+		return store.Errorf(store.Invalid, "Serialized products cannot be adjusted; record missing or found units as out or in movements with their serial numbers")
+	}
+	units := math.Abs(t.Quantity)
+	if units != math.Trunc(units) || int(units) != len(t.SerialNumbers) {
+		return store.Errorf(store.Invalid, "Expected %g serial numbers, got %d", units, len(t.SerialNumbers))
+	}
+
+	// Reversals carry a negative quantity and move the units the other way
+	arriving := t.TransactionType != "out" && t.TransactionType != "transfer_out"
+	if t.Quantity < 0 {
+		arriving = !arriving
+	}
+
+	seen := map[string]bool{}
+	for _, serial := range t.SerialNumbers {
+		if serial == "" {
+			return store.Errorf(store.Invalid, "Serial numbers cannot be empty")
+		}
+		if seen[serial] {
+			return store.Errorf(store.Invalid, "Serial %s is listed twice", serial)
+		}
+		seen[serial] = true
+
+		var status string
+		var locationID sql.NullInt64
+		err := tx.QueryRow(`
+			SELECT status, location_id FROM serial_numbers WHERE product_id = ? AND serial_number = ?
+		`, t.ProductID, serial).Scan(&status, &locationID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		switch {
+		case arriving && t.TransactionType == "transfer_in":
+			if status != "in_transit" {
+				return store.Errorf(store.Invalid, "Serial %s is not in transit", serial)
+			}
+		case arriving:
+			if status == "in_stock" || status == "in_transit" {
+				return store.Errorf(store.Invalid, "Serial %s is already in stock", serial)
+			}
+		default:
+			if status != "in_stock" || int(locationID.Int64) != t.LocationID {
+				return store.Errorf(store.Invalid, "Serial %s is not in stock at location %d", serial, t.LocationID)
+			}
+		}
+
+		newStatus, newLocation := "in_stock", sql.NullInt64{Int64: int64(t.LocationID), Valid: true}
+		if !arriving {
+			newStatus, newLocation = "out", sql.NullInt64{}
+			if t.TransactionType == "transfer_out" {
+				newStatus = "in_transit"
+			}
+		}
+		_, err = tx.Exec(`
+			INSERT INTO serial_numbers (product_id, serial_number, status, location_id) VALUES (?, ?, ?, ?)
+			ON CONFLICT(product_id, serial_number) DO UPDATE SET status = excluded.status, location_id = excluded.location_id
+		`, t.ProductID, serial, newStatus, newLocation)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO transaction_serials (transaction_id, product_id, serial_number) VALUES (?, ?, ?)
+		`, t.ID, t.ProductID, serial)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"database/sql"
+	"inventory-app/models"
+	"time"
+)
+
+// The posting and ledger reports of this package are offered to handlers behind the interfaces
+// below, so they can run against the database or against fakes in tests. Every posting runs in
+// a database transaction of its own.
+
+// TransactionPosting records and voids single ledger entries
+type TransactionPosting interface {
+	// RecordTransaction posts a stock movement (see the RecordTransaction function)
+	RecordTransaction(t models.StockTransaction) (RecordedTransaction, error)
+	// VoidTransaction posts the reversal of a ledger entry and marks it voided
+	VoidTransaction(id int, reason string) (VoidedTransaction, error)
+}
+
+// TransferPosting moves stock between locations
+type TransferPosting interface {
+	CreateTransfer(request TransferRequest) (models.Transfer, error)
+	ReceiveTransfer(id int) (models.Transfer, error)
+	CancelTransfer(id int) (models.Transfer, error)
+}
+
+// DocumentPosting records goods receipts and issue slips, all lines or none
+type DocumentPosting interface {
+	CreateStockDocument(document *models.StockDocument) error
+}
+
+// CountPosting posts the variances of approved count sessions
+type CountPosting interface {
+	ApproveCountSession(id int, approvedBy, reasonCode string) ([]models.StockTransaction, error)
+}
+
+// PeriodPosting closes and reopens accounting periods
+type PeriodPosting interface {
+	ClosePeriod(period string, monthStart time.Time, performedBy, reason string) ([]models.PeriodBalance, error)
+	ReopenPeriod(period, performedBy, reason string) error
+}
+
+// LedgerReports replays the ledger into balances and reports
+type LedgerReports interface {
+	LotBalances(productID, locationID int) ([]models.LotBalance, error)
+	StockAsOf(date time.Time, productID, locationID int) ([]models.StockOnHand, error)
+	MonthlyReport(monthStart time.Time) ([]models.MonthlyInventoryReport, error)
+	StockCard(productID, locationID int, from, to string) (models.StockBalance, []models.StockCardLine, error)
+	RebuildInventorySummary(productID int, dryRun bool) ([]models.SummaryRebuildResult, error)
+	RunIntegrityCheck() (*models.IntegrityReport, error)
+}
+
+// Ledger is all of the posting and reports, as Database provides them
+type Ledger interface {
+	TransactionPosting
+	TransferPosting
+	DocumentPosting
+	CountPosting
+	PeriodPosting
+	LedgerReports
+}
+
+// Database posts to and replays the ledger of a SQLite or PostgreSQL database
+type Database struct {
+	db *sql.DB
+}
+
+// NewDatabase returns the ledger kept in db, which must already be migrated
+func NewDatabase(db *sql.DB) *Database {
+	return &Database{db: db}
+}
+
+var _ Ledger = (*Database)(nil)
+
+// inTransaction runs fn inside a database transaction and commits it if fn succeeds
+func (d *Database) inTransaction(fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *Database) RecordTransaction(t models.StockTransaction) (recorded RecordedTransaction, err error) {
+	err = d.inTransaction(func(tx *sql.Tx) error {
+		recorded, err = RecordTransaction(tx, t)
+		return err
+	})
+	return recorded, err
+}
+
+func (d *Database) VoidTransaction(id int, reason string) (voided VoidedTransaction, err error) {
+	err = d.inTransaction(func(tx *sql.Tx) error {
+		voided, err = VoidTransaction(tx, id, reason)
+		return err
+	})
+	return voided, err
+}
+
+func (d *Database) CreateTransfer(request TransferRequest) (transfer models.Transfer, err error) {
+	err = d.inTransaction(func(tx *sql.Tx) error {
+		transfer, err = CreateTransfer(tx, request)
+		return err
+	})
+	return transfer, err
+}
+
+func (d *Database) ReceiveTransfer(id int) (transfer models.Transfer, err error) {
+	err = d.inTransaction(func(tx *sql.Tx) error {
+		transfer, err = ReceiveTransfer(tx, id)
+		return err
+	})
+	return transfer, err
+}
+
+func (d *Database) CancelTransfer(id int) (transfer models.Transfer, err error) {
+	err = d.inTransaction(func(tx *sql.Tx) error {
+		transfer, err = CancelTransfer(tx, id)
+		return err
+	})
+	return transfer, err
+}
+
+func (d *Database) CreateStockDocument(document *models.StockDocument) error {
+	return d.inTransaction(func(tx *sql.Tx) error {
+		return CreateStockDocument(tx, document)
+	})
+}
+
+func (d *Database) ApproveCountSession(id int, approvedBy, reasonCode string) (adjustments []models.StockTransaction, err error) {
+	err = d.inTransaction(func(tx *sql.Tx) error {
+		adjustments, err = ApproveCountSession(tx, id, approvedBy, reasonCode)
+		return err
+	})
+	return adjustments, err
+}
+
+func (d *Database) ClosePeriod(period string, monthStart time.Time, performedBy, reason string) (balances []models.PeriodBalance, err error) {
+	err = d.inTransaction(func(tx *sql.Tx) error {
+		balances, err = ClosePeriod(tx, period, monthStart, performedBy, reason)
+		return err
+	})
+	return balances, err
+}
+
+func (d *Database) ReopenPeriod(period, performedBy, reason string) error {
+	return d.inTransaction(func(tx *sql.Tx) error {
+		return ReopenPeriod(tx, period, performedBy, reason)
+	})
+}
+
+func (d *Database) LotBalances(productID, locationID int) ([]models.LotBalance, error) {
+	return LotBalances(d.db, productID, locationID)
+}
+
+func (d *Database) StockAsOf(date time.Time, productID, locationID int) ([]models.StockOnHand, error) {
+	return StockAsOf(d.db, date, productID, locationID)
+}
+
+func (d *Database) MonthlyReport(monthStart time.Time) ([]models.MonthlyInventoryReport, error) {
+	return MonthlyReport(d.db, monthStart)
+}
+
+func (d *Database) StockCard(productID, locationID int, from, to string) (models.StockBalance, []models.StockCardLine, error) {
+	return StockCard(d.db, productID, locationID, from, to)
+}
+
+func (d *Database) RebuildInventorySummary(productID int, dryRun bool) ([]models.SummaryRebuildResult, error) {
+	return RebuildInventorySummary(d.db, productID, dryRun)
+}
+
+func (d *Database) RunIntegrityCheck() (*models.IntegrityReport, error) {
+	return RunIntegrityCheck(d.db)
+}
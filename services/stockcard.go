@@ -0,0 +1,107 @@
+package services
+
+import (
+	"database/sql"
+	"inventory-app/models"
+)
+
+// StockCard lists the ledger entries of a product timestamped in [from, to) in ledger order,
+// each with the running balance after it, company-wide or at locationID when it is non-zero.
+// Empty bounds are open. The opening balance is the stock before from, replayed from the
+// latest checkpoint. Transfers are left off the company-wide card as they do not change it.
+func StockCard(q queryer, productID, locationID int, from, to string) (models.StockBalance, []models.StockCardLine, error) {
+	var opening models.StockBalance
+	key := locationKey{productID, locationID}
+
+	checkpoint, b, err := loadCheckpoint(q, from, productID)
+	if err != nil {
+		return opening, nil, err
+	}
+	if from != "" {
+		if err := replayRange(q, b, checkpoint, from, productID); err != nil {
+			return opening, nil, err
+		}
+	}
+	opening = stockBalance(b.get(key))
+
+	method, err := costingMethod(q, productID)
+	if err != nil {
+		return opening, nil, err
+	}
+
+	if to == "" {
+		to = "9999-12-31"
+	}
+	rows, err := q.Query(`
+		SELECT id, location_id, transaction_type, quantity, COALESCE(price_per_unit, 0), unit_cost, reversal_of,
+			COALESCE(department, ''), transaction_timestamp, COALESCE(notes, ''), document_id, transfer_id, COALESCE(lot_number, '')
+		FROM stock_transactions
+		WHERE product_id = ? AND transaction_timestamp >= ? AND transaction_timestamp < ?
+		ORDER BY transaction_timestamp, id
+	`, productID, from, to)
+	if err != nil {
+		return opening, nil, err
+	}
+	defer rows.Close()
+
+	lines := []models.StockCardLine{}
+	for rows.Next() {
+		t := models.StockTransaction{ProductID: productID}
+		var unitCost sql.NullFloat64
+		var reversalOf, documentID, transferID sql.NullInt64
+		err := rows.Scan(&t.ID, &t.LocationID, &t.TransactionType, &t.Quantity, &t.PricePerUnit, &unitCost, &reversalOf,
+			&t.Department, &t.TransactionTimestamp, &t.Notes, &documentID, &transferID, &t.LotNumber)
+		if err != nil {
+			return opening, nil, err
+		}
+		t.ReversalOf = nullableID(reversalOf)
+		locationCost := b.apply(&t, method, unitCost)
+
+		delta, cost := stockDelta(t.TransactionType, t.Quantity), t.UnitCost
+		if locationID != companyLocation {
+			if t.LocationID != locationID {
+				continue
+			}
+			delta, cost = locationDelta(t.TransactionType, t.Quantity), locationCost
+		} else if delta == 0 && (t.TransactionType == "transfer_out" || t.TransactionType == "transfer_in") {
+			continue
+		}
+
+		line := models.StockCardLine{
+			TransactionID:        t.ID,
+			TransactionTimestamp: t.TransactionTimestamp,
+			TransactionType:      t.TransactionType,
+			LocationID:           t.LocationID,
+			Department:           t.Department,
+			Notes:                t.Notes,
+			LotNumber:            t.LotNumber,
+			ReversalOf:           t.ReversalOf,
+			DocumentID:           nullableID(documentID),
+			TransferID:           nullableID(transferID),
+			UnitCost:             cost,
+			Value:                delta * cost,
+			Balance:              stockBalance(b.get(key)),
+		}
+		if delta >= 0 {
+			line.QuantityIn = delta
+		} else {
+			line.QuantityOut = -delta
+		}
+		lines = append(lines, line)
+	}
+	return opening, lines, rows.Err()
+}
+
+// stockBalance is the quantity and value of replayed totals
+func stockBalance(totals *models.InventoryTotals) models.StockBalance {
+	return models.StockBalance{Quantity: totals.EndingStock, AverageCost: totals.AveragePrice, Value: totals.StockValue}
+}
+
+// nullableID converts an optional id column
+func nullableID(id sql.NullInt64) *int {
+	if !id.Valid {
+		return nil
+	}
+	value := int(id.Int64)
+	return &value
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"inventory-app/store"
+	"time"
+)
+
+// RecordedTransaction is the outcome of RecordTransaction
+type RecordedTransaction struct {
+	Entries     []models.StockTransaction // one per lot when a stock-out spans several lots
+	Allocations []models.LotAllocation    // set when a stock-out was allocated to lots
+	Posting     PostingResult             // spans all entries
+	LowStock    bool                      // the product is at or below its low-stock threshold
+}
+
+// VoidedTransaction is the outcome of VoidTransaction
+type VoidedTransaction struct {
+	Original models.StockTransaction
+	Reversal models.StockTransaction
+	Posting  PostingResult
+}
+
+// productExists reports whether a product with the given id exists
+func productExists(q rowQueryer, id int) (bool, error) {
+	var found bool
+	err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM products WHERE id = ?)`, id).Scan(&found)
+	return found, err
+}
+
+// locationExists reports whether a location with the given id exists
+func locationExists(q rowQueryer, id int) (bool, error) {
+	var found bool
+	err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM locations WHERE id = ?)`, id).Scan(&found)
+	return found, err
+}
+
+// postingFailure describes an error from posting to the ledger, keeping the kind of an error
+// caused by the request (such as invalid serial numbers or an archived product)
+func postingFailure(err error, format string, args ...any) error {
+	message := fmt.Sprintf(format, args...)
+	if kind := store.KindOf(err); kind != 0 {
+		return store.Errorf(kind, "%s: %s", message, err)
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
+
+// RecordTransaction posts a stock movement inside tx. Transactions without a location are
+// recorded at the main warehouse and those without a timestamp now. Stock is checked as of the
+// transaction's timestamp, so backdated entries see the stock they would have found at the time,
+// and must not leave any later balance negative. For adjustments the quantity is worked out as
+// the signed difference between t.CountedQuantity and the stock at the location. The product is
+// locked before anything is checked, so the checks still hold when the movement is posted.
+func RecordTransaction(tx *sql.Tx, t models.StockTransaction) (RecordedTransaction, error) {
+	var recorded RecordedTransaction
+
+	if err := lockProduct(tx, t.ProductID); err != nil {
+		return recorded, err
+	}
+	found, err := productExists(tx, t.ProductID)
+	if err != nil {
+		return recorded, err
+	}
+	if !found {
+		return recorded, store.Errorf(store.Unprocessable, "Unknown product")
+	}
+	if t.LocationID == 0 {
+		t.LocationID = models.DefaultLocationID
+	}
+	found, err = locationExists(tx, t.LocationID)
+	if err != nil {
+		return recorded, err
+	}
+	if !found {
+		return recorded, store.Errorf(store.Invalid, "Unknown location")
+	}
+	if t.TransactionTimestamp.IsZero() {
+		t.TransactionTimestamp = time.Now()
+	}
+
+	stockAt, lowestLater, err := LocationStockAt(tx, t.ProductID, t.LocationID, t.TransactionTimestamp)
+	if err != nil {
+		return recorded, fmt.Errorf("failed to check current stock: %w", err)
+	}
+
+	// For stock-out, verify there's enough stock at the location
+	if t.TransactionType == "out" {
+		if stockAt < t.Quantity {
+			return recorded, store.Errorf(store.Invalid, "Insufficient stock for this transaction")
+		}
+		if lowestLater < t.Quantity {
+			return recorded, store.Errorf(store.Invalid, "Insufficient stock: a later transaction would leave the stock negative")
+		}
+	}
+
+	// Adjustments are valued at the current average price
+	if t.TransactionType == "adjustment" {
+		stock, err := LocationStock(tx, t.ProductID, t.LocationID)
+		if err != nil {
+			return recorded, fmt.Errorf("failed to check current stock: %w", err)
+		}
+
+		t.Quantity = *t.CountedQuantity - stockAt
+		if t.Quantity == 0 {
+			return recorded, store.Errorf(store.Invalid, "Counted quantity matches current stock; nothing to adjust")
+		}
+		if lowestLater+t.Quantity < 0 {
+			return recorded, store.Errorf(store.Invalid, "Adjustment would leave a later stock balance negative")
+		}
+		t.PricePerUnit = stock.AveragePrice
+		t.TotalValue = 0
+	}
+
+	// Only stock-ins set the expiry date of a lot
+	if t.TransactionType != "in" {
+		t.ExpiryDate = ""
+	}
+
+	// Closed periods are locked against new ledger entries
+	closed, err := PeriodClosed(tx, t.TransactionTimestamp)
+	if err != nil {
+		return recorded, fmt.Errorf("failed to check period status: %w", err)
+	}
+	if closed {
+		return recorded, store.Errorf(store.Conflict, "Transaction date falls inside a closed period")
+	}
+
+	if t.TotalValue == 0 && t.PricePerUnit > 0 {
+		t.TotalValue = t.PricePerUnit * t.Quantity
+	}
+
+	// Stock leaving a location is taken from the named lot, or from its lots first-expired-first-out
+	if t.TransactionType == "out" {
+		recorded.Allocations, err = AllocateLots(tx, t.ProductID, t.LocationID, t.LotNumber, t.Quantity)
+	} else if t.TransactionType == "adjustment" && t.LotNumber != "" && t.Quantity < 0 {
+		// A write-down against a lot cannot take more than the lot holds
+		_, err = AllocateLots(tx, t.ProductID, t.LocationID, t.LotNumber, -t.Quantity)
+	}
+	if err != nil {
+		return recorded, store.Errorf(store.Invalid, "Invalid lot: %s", err)
+	}
+
+	if recorded.Allocations != nil {
+		recorded.Entries, recorded.Posting, err = PostAllocated(tx, t, recorded.Allocations)
+	} else {
+		recorded.Posting, err = PostTransaction(tx, &t)
+		recorded.Entries = []models.StockTransaction{t}
+	}
+	if err != nil {
+		return recorded, err
+	}
+
+	var lowStockThreshold float64
+	err = tx.QueryRow(`SELECT low_stock_threshold FROM inventory_summary WHERE product_id = ?`, t.ProductID).Scan(&lowStockThreshold)
+	if err != nil {
+		return recorded, fmt.Errorf("failed to check low stock threshold: %w", err)
+	}
+	recorded.LowStock = recorded.Posting.After.EndingStock <= lowStockThreshold
+
+	return recorded, nil
+}
+
+// VoidTransaction corrects a transaction without editing the ledger: inside tx it posts a
+// compensating entry (same type, negated quantity) linked to the original, marks the original
+// as voided and takes the movement back out of the inventory balances.
+func VoidTransaction(tx *sql.Tx, id int, reason string) (VoidedTransaction, error) {
+	var voided VoidedTransaction
+
+	// The entry is locked before it is read, so it cannot be voided twice
+	if _, err := tx.Exec(`UPDATE stock_transactions SET voided_at = voided_at WHERE id = ?`, id); err != nil {
+		return voided, err
+	}
+	original, err := store.ScanStockTransaction(tx.QueryRow(`
+		SELECT `+store.StockTransactionColumns+`
+		FROM stock_transactions st WHERE st.id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return voided, store.Errorf(store.NotFound, "Transaction not found")
+	}
+	if err != nil {
+		return voided, err
+	}
+	if original.ReversalOf != nil {
+		return voided, store.Errorf(store.Invalid, "A reversal entry cannot be voided")
+	}
+	if original.VoidedAt != nil {
+		return voided, store.Errorf(store.Conflict, "Transaction has already been voided")
+	}
+	if original.TransferID != nil {
+		return voided, store.Errorf(store.Invalid, "Transfer entries cannot be voided; cancel the transfer instead")
+	}
+
+	if err := lockProduct(tx, original.ProductID); err != nil {
+		return voided, err
+	}
+	stock, err := LocationStock(tx, original.ProductID, original.LocationID)
+	if err != nil {
+		return voided, fmt.Errorf("failed to get current inventory state: %w", err)
+	}
+
+	// Taking a receipt (or a positive adjustment) back out must not leave the location, or its lot, with negative stock
+	if original.TransactionType != "out" && stock.EndingStock < original.Quantity {
+		return voided, store.Errorf(store.Invalid, "Insufficient stock to void this transaction")
+	}
+	if original.TransactionType != "out" && original.LotNumber != "" && original.Quantity > 0 {
+		if _, err := AllocateLots(tx, original.ProductID, original.LocationID, original.LotNumber, original.Quantity); err != nil {
+			return voided, store.Errorf(store.Invalid, "Insufficient stock in the lot to void this transaction: %s", err)
+		}
+	}
+
+	// The reversal moves the same serialized units back
+	serials, err := store.TransactionSerials(tx, original.ID)
+	if err != nil {
+		return voided, err
+	}
+	original.SerialNumbers = serials
+
+	now := time.Now()
+	reversal := models.StockTransaction{
+		ProductID:            original.ProductID,
+		LocationID:           original.LocationID,
+		TransactionType:      original.TransactionType,
+		Quantity:             -original.Quantity,
+		PricePerUnit:         original.PricePerUnit,
+		TotalValue:           -original.TotalValue,
+		Department:           original.Department,
+		TransactionTimestamp: now,
+		Notes:                fmt.Sprintf("Void of transaction #%d: %s", original.ID, reason),
+		ReasonCode:           original.ReasonCode,
+		ReversalOf:           &original.ID,
+		DocumentID:           original.DocumentID,
+		LotNumber:            original.LotNumber,
+		ExpiryDate:           original.ExpiryDate,
+		SerialNumbers:        serials,
+		UnitCost:             original.UnitCost, // units go back at the cost they were booked at
+	}
+
+	posting, err := PostTransaction(tx, &reversal)
+	if err != nil {
+		return voided, err
+	}
+
+	if _, err := tx.Exec(`UPDATE stock_transactions SET voided_at = ? WHERE id = ?`, ledgerTime(now), original.ID); err != nil {
+		return voided, fmt.Errorf("failed to mark transaction as voided: %w", err)
+	}
+	original.VoidedAt = &now
+
+	return VoidedTransaction{Original: original, Reversal: reversal, Posting: posting}, nil
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"inventory-app/store"
+	"time"
+)
+
+// TransferRequest dispatches stock of a product from one location to another
+type TransferRequest struct {
+	ProductID            int       `json:"product_id"`
+	FromLocationID       int       `json:"from_location_id"`
+	ToLocationID         int       `json:"to_location_id"`
+	Quantity             float64   `json:"quantity"`
+	Notes                string    `json:"notes"`
+	LotNumber            string    `json:"lot_number"` // transfer only this lot instead of picking FEFO
+	SerialNumbers        []string  `json:"serial_numbers"`
+	InTransit            bool      `json:"in_transit"` // leave the stock in transit until it is received
+	TransactionTimestamp time.Time `json:"transaction_timestamp"`
+}
+
+// postTransferIn records the arrival of a transfer at location and marks it with status. The
+// lots and serialized units dispatched from the source arrive unchanged, one transfer_in entry
+// per transfer_out, at the cost they left the source at.
+func postTransferIn(tx *sql.Tx, transfer *models.Transfer, locationID int, status string, at time.Time, notes string) error {
+	rows, err := tx.Query(`
+		SELECT id, COALESCE(lot_number, ''), COALESCE(expiry_date, ''), quantity,
+			COALESCE(cost_total, quantity * COALESCE(price_per_unit, 0))
+		FROM stock_transactions
+		WHERE transfer_id = ? AND transaction_type = 'transfer_out'
+		ORDER BY id
+	`, transfer.ID)
+	if err != nil {
+		return err
+	}
+	var outIDs []int
+	var costTotal float64
+	allocations := []models.LotAllocation{}
+	for rows.Next() {
+		var id int
+		var a models.LotAllocation
+		var cost float64
+		if err := rows.Scan(&id, &a.LotNumber, &a.ExpiryDate, &a.Quantity, &cost); err != nil {
+			rows.Close()
+			return err
+		}
+		outIDs = append(outIDs, id)
+		allocations = append(allocations, a)
+		costTotal += cost
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var serials []string
+	for _, id := range outIDs {
+		s, err := store.TransactionSerials(tx, id)
+		if err != nil {
+			return err
+		}
+		serials = append(serials, s...)
+	}
+
+	entry := models.StockTransaction{
+		ProductID:            transfer.ProductID,
+		LocationID:           locationID,
+		TransactionType:      "transfer_in",
+		Quantity:             transfer.Quantity,
+		PricePerUnit:         transfer.AveragePrice,
+		TotalValue:           transfer.Quantity * transfer.AveragePrice,
+		TransactionTimestamp: at,
+		Notes:                notes,
+		TransferID:           &transfer.ID,
+		SerialNumbers:        serials,
+	}
+	if transfer.Quantity > 0 {
+		entry.UnitCost = costTotal / transfer.Quantity
+	}
+	entries, _, err := PostAllocated(tx, entry, allocations)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE transfers SET status = ?, received_at = ?, in_transaction_id = ? WHERE id = ?
+	`, status, ledgerTime(at), entries[0].ID, transfer.ID)
+	if err != nil {
+		return err
+	}
+	transfer.Status = status
+	transfer.ReceivedAt = &at
+	transfer.InTransactionID = &entries[0].ID
+	return nil
+}
+
+// CreateTransfer dispatches stock from one location to another inside tx. The transfer_out
+// entry at the source (and, unless the stock is sent in transit, the transfer_in entry at the
+// destination) are posted together. The quantity and the locations must already have been
+// validated.
+func CreateTransfer(tx *sql.Tx, request TransferRequest) (models.Transfer, error) {
+	var transfer models.Transfer
+
+	// The product is locked before anything is checked, so the checks still hold at dispatch
+	if err := lockProduct(tx, request.ProductID); err != nil {
+		return transfer, err
+	}
+	found, err := productExists(tx, request.ProductID)
+	if err != nil {
+		return transfer, err
+	}
+	if !found {
+		return transfer, store.Errorf(store.Unprocessable, "Unknown product")
+	}
+	for _, id := range []int{request.FromLocationID, request.ToLocationID} {
+		found, err := locationExists(tx, id)
+		if err != nil {
+			return transfer, err
+		}
+		if !found {
+			return transfer, store.Errorf(store.Invalid, "Unknown location")
+		}
+	}
+
+	if request.TransactionTimestamp.IsZero() {
+		request.TransactionTimestamp = time.Now()
+	}
+	closed, err := PeriodClosed(tx, request.TransactionTimestamp)
+	if err != nil {
+		return transfer, fmt.Errorf("failed to check period status: %w", err)
+	}
+	if closed {
+		return transfer, store.Errorf(store.Conflict, "Transaction date falls inside a closed period")
+	}
+
+	// A backdated transfer must find the stock at the source at the time, and leave every later
+	// balance there non-negative
+	stockAt, lowestLater, err := LocationStockAt(tx, request.ProductID, request.FromLocationID, request.TransactionTimestamp)
+	if err != nil {
+		return transfer, fmt.Errorf("failed to check current stock: %w", err)
+	}
+	if stockAt < request.Quantity {
+		return transfer, store.Errorf(store.Invalid, "Insufficient stock at the source location")
+	}
+	if lowestLater < request.Quantity {
+		return transfer, store.Errorf(store.Invalid, "Insufficient stock at the source location: a later transaction would leave the stock negative")
+	}
+	stock, err := LocationStock(tx, request.ProductID, request.FromLocationID)
+	if err != nil {
+		return transfer, fmt.Errorf("failed to check current stock: %w", err)
+	}
+
+	transfer = models.Transfer{
+		ProductID:      request.ProductID,
+		FromLocationID: request.FromLocationID,
+		ToLocationID:   request.ToLocationID,
+		Quantity:       request.Quantity,
+		AveragePrice:   stock.AveragePrice,
+		Status:         "in_transit",
+		Notes:          request.Notes,
+		DispatchedAt:   request.TransactionTimestamp,
+	}
+	err = tx.QueryRow(`
+		INSERT INTO transfers (product_id, from_location_id, to_location_id, quantity, average_price, status, notes, dispatched_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, transfer.ProductID, transfer.FromLocationID, transfer.ToLocationID, transfer.Quantity, transfer.AveragePrice,
+		transfer.Status, transfer.Notes, ledgerTime(transfer.DispatchedAt)).Scan(&transfer.ID)
+	if err != nil {
+		return transfer, fmt.Errorf("failed to create transfer: %w", err)
+	}
+
+	// Lotted stock leaves the source first-expired-first-out, or from the requested lot
+	allocations, err := AllocateLots(tx, transfer.ProductID, transfer.FromLocationID, request.LotNumber, transfer.Quantity)
+	if err != nil {
+		return transfer, store.Errorf(store.Invalid, "Invalid lot: %s", err)
+	}
+
+	out := models.StockTransaction{
+		ProductID:            transfer.ProductID,
+		LocationID:           transfer.FromLocationID,
+		TransactionType:      "transfer_out",
+		Quantity:             transfer.Quantity,
+		PricePerUnit:         transfer.AveragePrice,
+		TotalValue:           transfer.Quantity * transfer.AveragePrice,
+		TransactionTimestamp: transfer.DispatchedAt,
+		Notes:                fmt.Sprintf("Transfer #%d dispatched", transfer.ID),
+		TransferID:           &transfer.ID,
+		SerialNumbers:        request.SerialNumbers,
+	}
+	entries, _, err := PostAllocated(tx, out, allocations)
+	if err != nil {
+		return transfer, postingFailure(err, "Failed to record transfer")
+	}
+	if _, err := tx.Exec(`UPDATE transfers SET out_transaction_id = ? WHERE id = ?`, entries[0].ID, transfer.ID); err != nil {
+		return transfer, err
+	}
+	transfer.OutTransactionID = &entries[0].ID
+
+	if !request.InTransit {
+		notes := fmt.Sprintf("Transfer #%d received", transfer.ID)
+		if err := postTransferIn(tx, &transfer, transfer.ToLocationID, "received", transfer.DispatchedAt, notes); err != nil {
+			return transfer, err
+		}
+	}
+	return transfer, nil
+}
+
+// loadTransitTransfer locks and loads a transfer inside tx, checks it is still in transit and
+// locks its product, checking the transfer can still be settled at time at. The transfer is
+// locked before it is read, so it cannot be received or cancelled twice.
+func loadTransitTransfer(tx *sql.Tx, id int, at time.Time) (models.Transfer, error) {
+	if _, err := tx.Exec(`UPDATE transfers SET status = status WHERE id = ?`, id); err != nil {
+		return models.Transfer{}, err
+	}
+	transfer, err := store.ScanTransfer(tx.QueryRow(`SELECT `+store.TransferColumns+` FROM transfers WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return transfer, store.Errorf(store.NotFound, "Transfer not found")
+	}
+	if err != nil {
+		return transfer, err
+	}
+	if transfer.Status != "in_transit" {
+		return transfer, store.Errorf(store.Conflict, "Transfer is not in transit (status: %s)", transfer.Status)
+	}
+
+	if err := lockProduct(tx, transfer.ProductID); err != nil {
+		return transfer, err
+	}
+	closed, err := PeriodClosed(tx, at)
+	if err != nil {
+		return transfer, fmt.Errorf("failed to check period status: %w", err)
+	}
+	if closed {
+		return transfer, store.Errorf(store.Conflict, "Transaction date falls inside a closed period")
+	}
+	return transfer, nil
+}
+
+// ReceiveTransfer books an in-transit transfer into its destination location inside tx
+func ReceiveTransfer(tx *sql.Tx, id int) (models.Transfer, error) {
+	now := time.Now()
+	transfer, err := loadTransitTransfer(tx, id, now)
+	if err != nil {
+		return transfer, err
+	}
+
+	notes := fmt.Sprintf("Transfer #%d received", transfer.ID)
+	if err := postTransferIn(tx, &transfer, transfer.ToLocationID, "received", now, notes); err != nil {
+		return transfer, err
+	}
+	return transfer, nil
+}
+
+// CancelTransfer returns the stock of an in-transit transfer to its source location inside tx
+func CancelTransfer(tx *sql.Tx, id int) (models.Transfer, error) {
+	now := time.Now()
+	transfer, err := loadTransitTransfer(tx, id, now)
+	if err != nil {
+		return transfer, err
+	}
+
+	notes := fmt.Sprintf("Transfer #%d cancelled, returned to source", transfer.ID)
+	if err := postTransferIn(tx, &transfer, transfer.FromLocationID, "cancelled", now, notes); err != nil {
+		return transfer, err
+	}
+	return transfer, nil
+}
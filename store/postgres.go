@@ -0,0 +1,40 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Postgres implements every store on a PostgreSQL
+// database, which several instances of the application can share
+type Postgres struct {
+	sqlStore
+}
+
+// NewPostgres returns the stores backed by db, which must already be migrated
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{sqlStore{db: db, search: postgresSearch}}
+}
+
+var _ Store = (*Postgres)(nil)
+
+// postgresSearchDocument is the text a product is searched by: its code, name and description.
+// It is the expression of the idx_products_search index, which a search only uses if it matches.
+const postgresSearchDocument = `to_tsvector('simple', p.code || ' ' || p.name || ' ' || COALESCE(p.description, ''))`
+
+// postgresSearch matches products through the GIN index over their search document
+var postgresSearch = productSearch{
+	query:     postgresSearchQuery,
+	join:      " JOIN to_tsquery('simple', ?) search ON " + postgresSearchDocument + " @@ search",
+	relevance: "-ts_rank(" + postgresSearchDocument + ", search)",
+}
+
+// postgresSearchQuery turns free text into a tsquery matching every word as a prefix
+func postgresSearchQuery(text string) string {
+	terms := []string{}
+	for _, word := range strings.Fields(text) {
+		word = strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(word)
+		terms = append(terms, `'`+word+`':*`)
+	}
+	return strings.Join(terms, " & ")
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"database/sql"
+	"inventory-app/models"
+)
+
+// sqlStore implements the stores in SQL that SQLite and PostgreSQL both run. Where the
+// databases differ, as in full-text search, the SQLite and Postgres stores configure it.
+type sqlStore struct {
+	db     *sql.DB
+	search productSearch
+}
+
+// productSearch is how a database finds the products matching a search
+type productSearch struct {
+	query     func(text string) string // turns free text into the search argument, empty for no search
+	join      string                   // joined to the products (aliased p) to keep the matches of the argument
+	relevance string                   // orders the matches, best first
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// RowScanner is satisfied by both *sql.Row and *sql.Rows
+type RowScanner interface {
+	Scan(dest ...any) error
+}
+
+// exists reports whether a row of table has the given id
+func exists(q queryer, table string, id int) (bool, error) {
+	var found bool
+	err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM `+table+` WHERE id = ?)`, id).Scan(&found)
+	return found, err
+}
+
+// checkFilters reports a location or category filter that names a record that does not
+// exist. Zero ids are no filter.
+func checkFilters(q queryer, locationID, categoryID int) error {
+	if locationID != 0 {
+		found, err := exists(q, "locations", locationID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return Errorf(NotFound, "Location not found")
+		}
+	}
+	if categoryID != 0 {
+		found, err := exists(q, "categories", categoryID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return Errorf(NotFound, "Category not found")
+		}
+	}
+	return nil
+}
+
+// inCategorySubtree matches products (aliased p) in a category or any of its subcategories
+const inCategorySubtree = `p.category_id IN (
+	WITH RECURSIVE subtree(id) AS (
+		SELECT CAST(? AS INTEGER) UNION ALL SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+	)
+	SELECT id FROM subtree
+)`
+
+// productColumns are the columns scanned by scanProduct, with the products table aliased p
+const productColumns = `p.id, p.code, p.name, COALESCE(p.description, ''), p.unit, COALESCE(p.category, ''), p.category_id,
+	p.serialized, COALESCE(p.costing_method, ''), p.archived_at`
+
+// scanProduct scans the productColumns of a row, followed by any extra columns, into a Product
+func scanProduct(row RowScanner, extra ...any) (models.Product, error) {
+	var p models.Product
+	var categoryID sql.NullInt64
+	var archivedAt sql.NullTime
+	dest := []any{&p.ID, &p.Code, &p.Name, &p.Description, &p.Unit, &p.Category, &categoryID, &p.Serialized, &p.CostingMethod, &archivedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if categoryID.Valid {
+		id := int(categoryID.Int64)
+		p.CategoryID = &id
+	}
+	if archivedAt.Valid {
+		p.ArchivedAt = &archivedAt.Time
+	}
+	return p, err
+}
+
+// StockTransactionColumns are the columns of a stock_transactions row aliased st, as scanned by ScanStockTransaction
+const StockTransactionColumns = `
+	st.id, st.product_id, st.location_id, st.transaction_type, st.quantity, st.price_per_unit, st.total_value,
+	st.department, st.transaction_timestamp, st.notes,
+	st.reversal_of, st.voided_at, st.reason_code, st.counted_quantity, st.transfer_id, st.document_id,
+	COALESCE(st.lot_number, ''), COALESCE(st.expiry_date, ''), COALESCE(st.unit_cost, 0), COALESCE(st.cost_total, 0)
+`
+
+// ScanStockTransaction scans the StockTransactionColumns of a row into a StockTransaction
+func ScanStockTransaction(row RowScanner) (models.StockTransaction, error) {
+	var t models.StockTransaction
+	var reversalOf sql.NullInt64
+	var voidedAt sql.NullTime
+	var reasonCode sql.NullString
+	var countedQuantity sql.NullFloat64
+	var transferID, documentID sql.NullInt64
+	err := row.Scan(
+		&t.ID, &t.ProductID, &t.LocationID, &t.TransactionType, &t.Quantity,
+		&t.PricePerUnit, &t.TotalValue, &t.Department,
+		&t.TransactionTimestamp, &t.Notes,
+		&reversalOf, &voidedAt, &reasonCode, &countedQuantity, &transferID, &documentID,
+		&t.LotNumber, &t.ExpiryDate, &t.UnitCost, &t.CostTotal,
+	)
+	t.ReasonCode = reasonCode.String
+	if countedQuantity.Valid {
+		t.CountedQuantity = &countedQuantity.Float64
+	}
+	if reversalOf.Valid {
+		id := int(reversalOf.Int64)
+		t.ReversalOf = &id
+	}
+	if voidedAt.Valid {
+		t.VoidedAt = &voidedAt.Time
+	}
+	if transferID.Valid {
+		id := int(transferID.Int64)
+		t.TransferID = &id
+	}
+	if documentID.Valid {
+		id := int(documentID.Int64)
+		t.DocumentID = &id
+	}
+	return t, err
+}
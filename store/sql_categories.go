@@ -0,0 +1,167 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"inventory-app/models"
+	"sort"
+	"strings"
+)
+
+// loadCategories returns every category with its path, ordered by path
+func loadCategories(q queryer) ([]models.Category, error) {
+	rows, err := q.Query(`SELECT id, name, parent_id, created_at FROM categories`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		var category models.Category
+		var parentID sql.NullInt64
+		var createdAt sql.NullTime
+		if err := rows.Scan(&category.ID, &category.Name, &parentID, &createdAt); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			category.ParentID = &id
+		}
+		category.CreatedAt = createdAt.Time
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	byID := map[int]*models.Category{}
+	for i := range categories {
+		byID[categories[i].ID] = &categories[i]
+	}
+	for i := range categories {
+		names := []string{}
+		for category, depth := &categories[i], 0; category != nil && depth <= len(categories); depth++ {
+			names = append([]string{category.Name}, names...)
+			if category.ParentID == nil {
+				break
+			}
+			category = byID[*category.ParentID]
+		}
+		categories[i].Path = strings.Join(names, " / ")
+	}
+
+	// Ordered by path, every category follows its parent
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Path < categories[j].Path })
+	return categories, nil
+}
+
+// ListCategories returns every category with its path from the root, parents before children
+func (s *sqlStore) ListCategories() ([]models.Category, error) {
+	return loadCategories(s.db)
+}
+
+// CreateCategory adds a category, at the root or under its parent, and sets its ID and path
+func (s *sqlStore) CreateCategory(category *models.Category) error {
+	if category.ParentID != nil {
+		found, err := exists(s.db, "categories", *category.ParentID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return Errorf(Invalid, "Unknown parent category")
+		}
+	}
+
+	err := s.db.QueryRow(`INSERT INTO categories (name, parent_id, created_at) VALUES (?, ?, CURRENT_TIMESTAMP) RETURNING id`,
+		category.Name, category.ParentID).Scan(&category.ID)
+	if err != nil {
+		return Errorf(Conflict, "Failed to create category: %s", err)
+	}
+
+	categories, err := loadCategories(s.db)
+	if err != nil {
+		return err
+	}
+	for _, created := range categories {
+		if created.ID == category.ID {
+			*category = created
+		}
+	}
+	return nil
+}
+
+// UpdateCategory renames a category and moves it under another parent (or to the root). A
+// category cannot be moved under itself or one of its subcategories. The products of the
+// category are renamed with it.
+func (s *sqlStore) UpdateCategory(id int, category models.Category) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if category.ParentID != nil {
+		// Every category is locked first, so two moves cannot each pass the check below and
+		// together make a cycle
+		if _, err := tx.Exec(`UPDATE categories SET parent_id = parent_id`); err != nil {
+			return fmt.Errorf("failed to lock categories: %w", err)
+		}
+		var found, parentFound, underItself bool
+		err := tx.QueryRow(`
+			WITH RECURSIVE subtree(id) AS (
+				SELECT CAST(? AS INTEGER) UNION SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT
+				EXISTS(SELECT 1 FROM categories WHERE id = ?),
+				EXISTS(SELECT 1 FROM categories WHERE id = ?),
+				EXISTS(SELECT 1 FROM subtree WHERE id = ?)
+		`, id, id, *category.ParentID, *category.ParentID).Scan(&found, &parentFound, &underItself)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !found:
+			return Errorf(NotFound, "Category not found")
+		case !parentFound:
+			return Errorf(Invalid, "Unknown parent category")
+		case underItself:
+			return Errorf(Invalid, "A category cannot be moved under itself or its subcategories")
+		}
+	}
+
+	result, err := tx.Exec(`UPDATE categories SET name = ?, parent_id = ? WHERE id = ?`, category.Name, category.ParentID, id)
+	if err != nil {
+		return Errorf(Conflict, "Failed to update category: %s", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return Errorf(NotFound, "Category not found")
+	}
+	// Products carry the name of their category
+	if _, err := tx.Exec(`UPDATE products SET category = ? WHERE category_id = ?`, category.Name, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteCategory removes a category that has no subcategories and no products
+func (s *sqlStore) DeleteCategory(id int) error {
+	var found, inUse bool
+	err := s.db.QueryRow(`
+		SELECT
+			EXISTS(SELECT 1 FROM categories WHERE id = ?),
+			EXISTS(SELECT 1 FROM categories WHERE parent_id = ?) OR EXISTS(SELECT 1 FROM products WHERE category_id = ?)
+	`, id, id, id).Scan(&found, &inUse)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return Errorf(NotFound, "Category not found")
+	}
+	if inUse {
+		return Errorf(Conflict, "Category still has subcategories or products")
+	}
+
+	_, err = s.db.Exec(`DELETE FROM categories WHERE id = ?`, id)
+	return err
+}
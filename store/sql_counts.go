@@ -0,0 +1,337 @@
+package store
+
+import (
+	"database/sql"
+	"inventory-app/models"
+)
+
+// loadCountSession fetches a count session with its (blind) lines
+func loadCountSession(q queryer, id int) (models.CountSession, error) {
+	var session models.CountSession
+	var category, approvedBy sql.NullString
+	var approvedAt sql.NullTime
+	err := q.QueryRow(`
+		SELECT id, name, category, location_id, status, created_at, approved_at, approved_by
+		FROM count_sessions WHERE id = ?
+	`, id).Scan(&session.ID, &session.Name, &category, &session.LocationID, &session.Status, &session.CreatedAt, &approvedAt, &approvedBy)
+	if err == sql.ErrNoRows {
+		return session, Errorf(NotFound, "Count session not found")
+	}
+	if err != nil {
+		return session, err
+	}
+	session.Category = category.String
+	session.ApprovedBy = approvedBy.String
+	if approvedAt.Valid {
+		session.ApprovedAt = &approvedAt.Time
+	}
+
+	rows, err := q.Query(`
+		SELECT p.id, p.code, p.name, p.unit, cl.counted_quantity, cl.counted_by, cl.counted_at
+		FROM count_lines cl
+		JOIN products p ON p.id = cl.product_id
+		WHERE cl.session_id = ?
+		ORDER BY p.code
+	`, session.ID)
+	if err != nil {
+		return session, err
+	}
+	defer rows.Close()
+
+	session.Lines = []models.CountLine{}
+	for rows.Next() {
+		var line models.CountLine
+		var counted sql.NullFloat64
+		var countedBy sql.NullString
+		var countedAt sql.NullTime
+		if err := rows.Scan(&line.ProductID, &line.Code, &line.Name, &line.Unit, &counted, &countedBy, &countedAt); err != nil {
+			return session, err
+		}
+		if counted.Valid {
+			line.CountedQuantity = &counted.Float64
+		}
+		line.CountedBy = countedBy.String
+		if countedAt.Valid {
+			line.CountedAt = &countedAt.Time
+		}
+		session.Lines = append(session.Lines, line)
+	}
+
+	return session, rows.Err()
+}
+
+// CountSessionStatus returns the status of a count session and the location it counts
+func CountSessionStatus(q queryer, id int) (status string, locationID int, err error) {
+	err = q.QueryRow(`SELECT status, location_id FROM count_sessions WHERE id = ?`, id).Scan(&status, &locationID)
+	if err == sql.ErrNoRows {
+		err = Errorf(NotFound, "Count session not found")
+	}
+	return status, locationID, err
+}
+
+// CreateCountSession starts a cycle count at a location (the main warehouse by default) for a
+// list of products or for every active product in a category. Serialized products are not
+// counted: their units are tracked one by one, so missing or found units are recorded as out
+// or in movements naming their serial numbers.
+func (s *sqlStore) CreateCountSession(request NewCountSession) (models.CountSession, error) {
+	if request.LocationID == 0 {
+		request.LocationID = models.DefaultLocationID
+	}
+	found, err := exists(s.db, "locations", request.LocationID)
+	if err != nil {
+		return models.CountSession{}, err
+	}
+	if !found {
+		return models.CountSession{}, Errorf(Invalid, "Unknown location")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.CountSession{}, err
+	}
+	defer tx.Rollback()
+
+	var sessionID int
+	err = tx.QueryRow(`
+		INSERT INTO count_sessions (name, category, location_id, status, created_at) VALUES (?, ?, ?, 'open', CURRENT_TIMESTAMP)
+		RETURNING id
+	`, request.Name, request.Category, request.LocationID).Scan(&sessionID)
+	if err != nil {
+		return models.CountSession{}, err
+	}
+
+	if request.Category != "" {
+		result, err := tx.Exec(`
+			INSERT INTO count_lines (session_id, product_id) SELECT CAST(? AS INTEGER), id FROM products
+			WHERE category = ? AND archived_at IS NULL AND NOT serialized
+		`, sessionID, request.Category)
+		if err != nil {
+			return models.CountSession{}, err
+		}
+		if added, _ := result.RowsAffected(); added == 0 {
+			return models.CountSession{}, Errorf(Invalid, "No products found in category %s", request.Category)
+		}
+	}
+
+	for _, productID := range request.ProductIDs {
+		var serialized bool
+		err := tx.QueryRow(`SELECT serialized FROM products WHERE id = ?`, productID).Scan(&serialized)
+		if err == sql.ErrNoRows {
+			return models.CountSession{}, Errorf(Unprocessable, "Product %d not found", productID)
+		}
+		if err != nil {
+			return models.CountSession{}, err
+		}
+		if serialized {
+			return models.CountSession{}, Errorf(Invalid, "Product %d is serialized and cannot be counted; record missing or found units as out or in movements with their serial numbers", productID)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO count_lines (session_id, product_id) VALUES (?, ?)
+			ON CONFLICT DO NOTHING
+		`, sessionID, productID)
+		if err != nil {
+			return models.CountSession{}, err
+		}
+	}
+
+	session, err := loadCountSession(tx, sessionID)
+	if err != nil {
+		return session, err
+	}
+	return session, tx.Commit()
+}
+
+// ListCountSessions returns every count session without its lines, newest first
+func (s *sqlStore) ListCountSessions() ([]models.CountSession, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, COALESCE(category, ''), location_id, status, created_at, approved_at, COALESCE(approved_by, '')
+		FROM count_sessions ORDER BY id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.CountSession{}
+	for rows.Next() {
+		var session models.CountSession
+		var approvedAt sql.NullTime
+		if err := rows.Scan(&session.ID, &session.Name, &session.Category, &session.LocationID, &session.Status, &session.CreatedAt,
+			&approvedAt, &session.ApprovedBy); err != nil {
+			return nil, err
+		}
+		if approvedAt.Valid {
+			session.ApprovedAt = &approvedAt.Time
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// GetCountSession returns a count session and its lines. System quantities are never included.
+func (s *sqlStore) GetCountSession(id int) (models.CountSession, error) {
+	return loadCountSession(s.db, id)
+}
+
+// RecordCounts stores counted quantities for products of an open count session and returns
+// the session
+func (s *sqlStore) RecordCounts(id int, countedBy string, counts []CountEntry) (models.CountSession, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.CountSession{}, err
+	}
+	defer tx.Rollback()
+
+	status, _, err := CountSessionStatus(tx, id)
+	if err != nil {
+		return models.CountSession{}, err
+	}
+	if status != "open" {
+		return models.CountSession{}, Errorf(Conflict, "Counts can only be recorded on an open session")
+	}
+
+	for _, entry := range counts {
+		if entry.CountedQuantity == nil || *entry.CountedQuantity < 0 {
+			return models.CountSession{}, Errorf(Invalid, "Product %d: counted_quantity must be 0 or more", entry.ProductID)
+		}
+
+		result, err := tx.Exec(`
+			UPDATE count_lines SET counted_quantity = ?, counted_by = ?, counted_at = CURRENT_TIMESTAMP
+			WHERE session_id = ? AND product_id = ?
+		`, *entry.CountedQuantity, countedBy, id, entry.ProductID)
+		if err != nil {
+			return models.CountSession{}, err
+		}
+		if updated, _ := result.RowsAffected(); updated == 0 {
+			return models.CountSession{}, Errorf(Invalid, "Product %d is not part of this count session", entry.ProductID)
+		}
+	}
+
+	session, err := loadCountSession(tx, id)
+	if err != nil {
+		return session, err
+	}
+	return session, tx.Commit()
+}
+
+// SubmitCountSession closes counting once every product has been counted, revealing the
+// variances. The stock and average price at the session's location are stored with each line,
+// so the variances approved are the ones the counts were submitted against.
+func (s *sqlStore) SubmitCountSession(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var uncounted int
+	err = tx.QueryRow(`
+		SELECT s.status, (SELECT COUNT(*) FROM count_lines WHERE session_id = s.id AND counted_quantity IS NULL)
+		FROM count_sessions s WHERE s.id = ?
+	`, id).Scan(&status, &uncounted)
+	if err == sql.ErrNoRows {
+		return Errorf(NotFound, "Count session not found")
+	}
+	if err != nil {
+		return err
+	}
+	if status != "open" {
+		return Errorf(Conflict, "Only an open session can be submitted")
+	}
+	if uncounted > 0 {
+		return Errorf(Invalid, "%d product(s) have not been counted yet", uncounted)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE count_lines SET
+			system_quantity = COALESCE((
+				SELECT i.ending_stock FROM location_stock i JOIN count_sessions s ON s.location_id = i.location_id
+				WHERE s.id = count_lines.session_id AND i.product_id = count_lines.product_id
+			), 0),
+			average_price = COALESCE((
+				SELECT i.average_price FROM location_stock i JOIN count_sessions s ON s.location_id = i.location_id
+				WHERE s.id = count_lines.session_id AND i.product_id = count_lines.product_id
+			), 0)
+		WHERE session_id = ?
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE count_sessions SET status = 'submitted' WHERE id = ? AND status = 'open'`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SessionVariances computes the variance of every line of a session against the system quantity
+// and average price stored when it was submitted. Lines without them (an open session, or one
+// submitted before they were stored) use the current stock at the session's location.
+func SessionVariances(q queryer, id int) ([]models.CountVariance, error) {
+	rows, err := q.Query(`
+		SELECT
+			p.id, p.code, p.name, p.unit,
+			COALESCE(cl.system_quantity, i.ending_stock, 0),
+			COALESCE(cl.counted_quantity, 0),
+			COALESCE(cl.average_price, i.average_price, 0)
+		FROM count_lines cl
+		JOIN count_sessions s ON s.id = cl.session_id
+		JOIN products p ON p.id = cl.product_id
+		LEFT JOIN location_stock i ON i.product_id = cl.product_id AND i.location_id = s.location_id
+		WHERE cl.session_id = ?
+		ORDER BY p.code
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variances := []models.CountVariance{}
+	for rows.Next() {
+		var v models.CountVariance
+		if err := rows.Scan(&v.ProductID, &v.Code, &v.Name, &v.Unit, &v.SystemQuantity, &v.CountedQuantity, &v.AveragePrice); err != nil {
+			return nil, err
+		}
+		v.Variance = v.CountedQuantity - v.SystemQuantity
+		v.VarianceValue = v.Variance * v.AveragePrice
+		variances = append(variances, v)
+	}
+
+	return variances, rows.Err()
+}
+
+// CountVariances returns the status of a session and, once it has been submitted, its variances.
+// Counting is blind: system quantities stay hidden until then.
+func (s *sqlStore) CountVariances(id int) (string, []models.CountVariance, error) {
+	status, _, err := CountSessionStatus(s.db, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if status != "submitted" && status != "approved" {
+		return status, nil, Errorf(Conflict, "Variances are available once the session has been submitted")
+	}
+
+	variances, err := SessionVariances(s.db, id)
+	return status, variances, err
+}
+
+// CancelCountSession abandons a count session that has not been approved. The status is
+// checked by the update itself, so a session approved meanwhile stays approved.
+func (s *sqlStore) CancelCountSession(id int) error {
+	result, err := s.db.Exec(`UPDATE count_sessions SET status = 'cancelled' WHERE id = ? AND status IN ('open', 'submitted')`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	// Nothing was cancelled: either there is no such session or it is past cancelling
+	if _, _, err := CountSessionStatus(s.db, id); err != nil {
+		return err
+	}
+	return Errorf(Conflict, "Only an open or submitted session can be cancelled")
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"database/sql"
+	"inventory-app/models"
+)
+
+// ListDocuments returns the document headers, optionally only those of one type, newest first
+func (s *sqlStore) ListDocuments(documentType string) ([]models.StockDocument, error) {
+	rows, err := s.db.Query(`
+		SELECT
+			d.id, d.document_number, d.document_type, d.document_date, d.location_id,
+			COALESCE(d.department, ''), COALESCE(d.supplier, ''), COALESCE(d.notes, ''), d.created_at,
+			COALESCE(SUM(st.total_value), 0)
+		FROM
+			stock_documents d
+		LEFT JOIN
+			stock_transactions st ON st.document_id = d.id
+		WHERE
+			? = '' OR d.document_type = ?
+		GROUP BY
+			d.id
+		ORDER BY
+			d.document_date DESC, d.id DESC
+	`, documentType, documentType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []models.StockDocument{}
+	for rows.Next() {
+		var d models.StockDocument
+		if err := rows.Scan(&d.ID, &d.DocumentNumber, &d.DocumentType, &d.DocumentDate, &d.LocationID,
+			&d.Department, &d.Supplier, &d.Notes, &d.CreatedAt, &d.TotalValue); err != nil {
+			return nil, err
+		}
+		documents = append(documents, d)
+	}
+	return documents, rows.Err()
+}
+
+// GetDocument returns a document header with its lines
+func (s *sqlStore) GetDocument(id int) (models.StockDocument, error) {
+	var d models.StockDocument
+	err := s.db.QueryRow(`
+		SELECT id, document_number, document_type, document_date, location_id,
+			COALESCE(department, ''), COALESCE(supplier, ''), COALESCE(notes, ''), created_at
+		FROM stock_documents WHERE id = ?
+	`, id).Scan(&d.ID, &d.DocumentNumber, &d.DocumentType, &d.DocumentDate, &d.LocationID,
+		&d.Department, &d.Supplier, &d.Notes, &d.CreatedAt)
+	if err == sql.ErrNoRows {
+		return d, Errorf(NotFound, "Document not found")
+	}
+	if err != nil {
+		return d, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT
+			st.id, st.product_id, COALESCE(p.code, ''), COALESCE(p.name, ''), COALESCE(p.unit, ''),
+			st.quantity, COALESCE(st.price_per_unit, 0), COALESCE(st.total_value, 0), COALESCE(st.notes, ''),
+			COALESCE(st.lot_number, ''), COALESCE(st.expiry_date, '')
+		FROM
+			stock_transactions st
+		LEFT JOIN
+			products p ON p.id = st.product_id
+		WHERE
+			st.document_id = ?
+		ORDER BY
+			st.id
+	`, d.ID)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+
+	d.Lines = []models.DocumentLine{}
+	for rows.Next() {
+		var l models.DocumentLine
+		if err := rows.Scan(&l.TransactionID, &l.ProductID, &l.Code, &l.Name, &l.Unit,
+			&l.Quantity, &l.PricePerUnit, &l.TotalValue, &l.Notes, &l.LotNumber, &l.ExpiryDate); err != nil {
+			return d, err
+		}
+		d.TotalValue += l.TotalValue
+		d.Lines = append(d.Lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	for i := range d.Lines {
+		serials, err := TransactionSerials(s.db, d.Lines[i].TransactionID)
+		if err != nil {
+			return d, err
+		}
+		if len(serials) > 0 {
+			d.Lines[i].SerialNumbers = serials
+		}
+	}
+	return d, nil
+}
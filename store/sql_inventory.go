@@ -0,0 +1,243 @@
+package store
+
+import (
+	"database/sql"
+	"inventory-app/models"
+)
+
+// InventorySummary returns the current stock of every product, company-wide or at one location,
+// optionally only for the products in a category and its subcategories
+func (s *sqlStore) InventorySummary(locationID, categoryID int) ([]models.InventorySummaryLine, error) {
+	if err := checkFilters(s.db, locationID, categoryID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT
+			p.id, p.code, p.name, i.opening_stock, i.total_in, i.total_out, i.total_adjustment, i.ending_stock, i.average_price,
+			i.stock_value
+		FROM
+			inventory_summary i
+		JOIN
+			products p ON p.id = i.product_id
+		WHERE
+			1 = 1
+	`
+	args := []any{}
+	if locationID != 0 {
+		// Opening balances are only carried forward company-wide
+		query = `
+			SELECT
+				p.id, p.code, p.name, 0, l.total_in, l.total_out, l.total_adjustment, l.ending_stock, l.average_price,
+				l.stock_value
+			FROM
+				location_stock l
+			JOIN
+				products p ON p.id = l.product_id
+			WHERE
+				l.location_id = ?
+		`
+		args = append(args, locationID)
+	}
+	if categoryID != 0 {
+		query += " AND " + inCategorySubtree
+		args = append(args, categoryID)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []models.InventorySummaryLine
+	for rows.Next() {
+		var l models.InventorySummaryLine
+		err := rows.Scan(&l.ID, &l.Code, &l.Name, &l.OpeningStock, &l.TotalIn, &l.TotalOut, &l.TotalAdjustment, &l.EndingStock,
+			&l.AveragePrice, &l.StockValue)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, l)
+	}
+	return summaries, rows.Err()
+}
+
+// CategoryRollup returns the stock of every category, each including the products of all its
+// subcategories, company-wide or at one location
+func (s *sqlStore) CategoryRollup(locationID int) ([]models.CategoryRollup, error) {
+	if err := checkFilters(s.db, locationID, 0); err != nil {
+		return nil, err
+	}
+
+	categories, err := loadCategories(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	stock := `inventory_summary s ON s.product_id = p.id`
+	args := []any{}
+	if locationID != 0 {
+		stock = `location_stock s ON s.product_id = p.id AND s.location_id = ?`
+		args = append(args, locationID)
+	}
+
+	// tree pairs every category with itself and each of its subcategories
+	rows, err := s.db.Query(`
+		WITH RECURSIVE tree(root, id) AS (
+			SELECT id, id FROM categories
+			UNION ALL
+			SELECT t.root, c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+		)
+		SELECT
+			t.root, COUNT(p.id), COALESCE(SUM(s.ending_stock), 0), COALESCE(SUM(s.stock_value), 0)
+		FROM
+			tree t
+		JOIN
+			products p ON p.category_id = t.id
+		LEFT JOIN
+			`+stock+`
+		GROUP BY
+			t.root
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := map[int]models.CategoryRollup{}
+	for rows.Next() {
+		var r models.CategoryRollup
+		if err := rows.Scan(&r.CategoryID, &r.ProductCount, &r.EndingStock, &r.StockValue); err != nil {
+			return nil, err
+		}
+		totals[r.CategoryID] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rollup := []models.CategoryRollup{}
+	for _, category := range categories {
+		r := totals[category.ID]
+		r.CategoryID, r.Name, r.ParentID, r.Path = category.ID, category.Name, category.ParentID, category.Path
+		rollup = append(rollup, r)
+	}
+	return rollup, nil
+}
+
+// LowStockAlerts returns the products below their low-stock threshold, company-wide or at one
+// location. At a location, products stocked there are compared with the product's threshold.
+// Archived products are left out.
+func (s *sqlStore) LowStockAlerts(locationID int) ([]models.LowStockAlert, error) {
+	if err := checkFilters(s.db, locationID, 0); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT
+			p.id, p.code, p.name, i.ending_stock, i.low_stock_threshold
+		FROM
+			inventory_summary i
+		JOIN
+			products p ON p.id = i.product_id
+		WHERE
+			i.ending_stock < i.low_stock_threshold AND p.archived_at IS NULL
+	`
+	args := []any{}
+	if locationID != 0 {
+		query = `
+			SELECT
+				p.id, p.code, p.name, l.ending_stock, i.low_stock_threshold
+			FROM
+				location_stock l
+			JOIN
+				inventory_summary i ON i.product_id = l.product_id
+			JOIN
+				products p ON p.id = l.product_id
+			WHERE
+				l.location_id = ? AND l.ending_stock < i.low_stock_threshold AND p.archived_at IS NULL
+		`
+		args = append(args, locationID)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []models.LowStockAlert
+	for rows.Next() {
+		var a models.LowStockAlert
+		if err := rows.Scan(&a.ID, &a.Code, &a.Name, &a.EndingStock, &a.LowStockThreshold); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// SetLowStockThreshold changes the stock level below which a product is reported as low
+func (s *sqlStore) SetLowStockThreshold(productID int, threshold float64) error {
+	result, err := s.db.Exec(`UPDATE inventory_summary SET low_stock_threshold = ? WHERE product_id = ?`, threshold, productID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return Errorf(NotFound, "Product not found")
+	}
+	return nil
+}
+
+// StockByLocation returns the company-wide stock of every product with its breakdown per
+// location, by product code
+func (s *sqlStore) StockByLocation() ([]models.ProductLocations, error) {
+	rows, err := s.db.Query(`
+		SELECT
+			p.id, p.code, p.name, i.ending_stock, i.average_price,
+			l.id, l.code, l.name, ls.ending_stock, ls.average_price
+		FROM
+			inventory_summary i
+		JOIN
+			products p ON p.id = i.product_id
+		LEFT JOIN
+			location_stock ls ON ls.product_id = p.id
+		LEFT JOIN
+			locations l ON l.id = ls.location_id
+		ORDER BY
+			p.code, l.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stock := []models.ProductLocations{}
+	for rows.Next() {
+		var p models.ProductLocations
+		var locationID sql.NullInt64
+		var locationCode, locationName sql.NullString
+		var locationEnding, locationAvg sql.NullFloat64
+		if err := rows.Scan(&p.ProductID, &p.Code, &p.Name, &p.EndingStock, &p.AveragePrice,
+			&locationID, &locationCode, &locationName, &locationEnding, &locationAvg); err != nil {
+			return nil, err
+		}
+
+		if len(stock) == 0 || stock[len(stock)-1].ProductID != p.ProductID {
+			p.Locations = []models.LocationBalance{}
+			stock = append(stock, p)
+		}
+		if locationID.Valid {
+			last := &stock[len(stock)-1]
+			last.Locations = append(last.Locations, models.LocationBalance{
+				LocationID:   int(locationID.Int64),
+				Code:         locationCode.String,
+				Name:         locationName.String,
+				EndingStock:  locationEnding.Float64,
+				AveragePrice: locationAvg.Float64,
+			})
+		}
+	}
+	return stock, rows.Err()
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"database/sql"
+	"inventory-app/models"
+	"time"
+)
+
+// CreateLocation adds a stock location and sets its ID
+func (s *sqlStore) CreateLocation(location *models.Location) error {
+	err := s.db.QueryRow(`
+		INSERT INTO locations (code, name, created_at) VALUES (?, ?, CURRENT_TIMESTAMP) RETURNING id
+	`, location.Code, location.Name).Scan(&location.ID)
+	if err != nil {
+		return err
+	}
+	location.CreatedAt = time.Now()
+	return nil
+}
+
+// ListLocations returns every location by id
+func (s *sqlStore) ListLocations() ([]models.Location, error) {
+	rows, err := s.db.Query(`SELECT id, code, name, created_at FROM locations ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []models.Location{}
+	for rows.Next() {
+		var l models.Location
+		if err := rows.Scan(&l.ID, &l.Code, &l.Name, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+	return locations, rows.Err()
+}
+
+// GetLocation returns the location with the given id
+func (s *sqlStore) GetLocation(id int) (models.Location, error) {
+	var l models.Location
+	err := s.db.QueryRow(`SELECT id, code, name, created_at FROM locations WHERE id = ?`, id).
+		Scan(&l.ID, &l.Code, &l.Name, &l.CreatedAt)
+	if err == sql.ErrNoRows {
+		return l, Errorf(NotFound, "Location not found")
+	}
+	return l, err
+}
+
+// UpdateLocation renames a location
+func (s *sqlStore) UpdateLocation(id int, location models.Location) error {
+	result, err := s.db.Exec(`UPDATE locations SET code = ?, name = ? WHERE id = ?`, location.Code, location.Name, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return Errorf(NotFound, "Location not found")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"database/sql"
+	"inventory-app/models"
+)
+
+// ListPeriods returns every period that has been closed at least once, latest first
+func (s *sqlStore) ListPeriods() ([]models.Period, error) {
+	rows, err := s.db.Query(`SELECT period, status, closed_at FROM periods ORDER BY period DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	periods := []models.Period{}
+	for rows.Next() {
+		var p models.Period
+		var closedAt sql.NullTime
+		if err := rows.Scan(&p.Period, &p.Status, &closedAt); err != nil {
+			return nil, err
+		}
+		if closedAt.Valid {
+			p.ClosedAt = &closedAt.Time
+		}
+		periods = append(periods, p)
+	}
+	return periods, rows.Err()
+}
+
+// PeriodBalances returns the balances snapshotted when a period was closed, by product code
+func (s *sqlStore) PeriodBalances(period string) ([]models.PeriodBalance, error) {
+	rows, err := s.db.Query(`
+		SELECT
+			pb.period, pb.product_id, p.code, p.name, pb.opening_stock, pb.total_in, pb.total_out,
+			pb.total_adjustment, pb.ending_stock, pb.average_price, pb.total_value
+		FROM
+			period_balances pb
+		JOIN
+			products p ON p.id = pb.product_id
+		WHERE
+			pb.period = ?
+		ORDER BY
+			p.code
+	`, period)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := []models.PeriodBalance{}
+	for rows.Next() {
+		var b models.PeriodBalance
+		if err := rows.Scan(&b.Period, &b.ProductID, &b.Code, &b.Name, &b.OpeningStock, &b.TotalIn, &b.TotalOut,
+			&b.Adjustment, &b.EndingStock, &b.AveragePrice, &b.TotalValue); err != nil {
+			return nil, err
+		}
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
+
+// PeriodAuditLog returns every close and reopen recorded for a period, oldest first
+func (s *sqlStore) PeriodAuditLog(period string) ([]models.PeriodAuditEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT id, period, action, COALESCE(performed_by, ''), COALESCE(reason, ''), performed_at
+		FROM period_audit_log WHERE period = ? ORDER BY id
+	`, period)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.PeriodAuditEntry{}
+	for rows.Next() {
+		var e models.PeriodAuditEntry
+		if err := rows.Scan(&e.ID, &e.Period, &e.Action, &e.PerformedBy, &e.Reason, &e.PerformedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,329 @@
+package store
+
+import (
+	"database/sql"
+	"inventory-app/models"
+	"strings"
+)
+
+// resolveCategory fills in the category of a product from its category id or, for clients
+// that only send a category name, from the root category of that name, which is created if
+// needed
+func resolveCategory(tx *sql.Tx, p *models.Product) error {
+	if p.CategoryID != nil {
+		err := tx.QueryRow(`SELECT name FROM categories WHERE id = ?`, *p.CategoryID).Scan(&p.Category)
+		if err == sql.ErrNoRows {
+			return Errorf(Invalid, "Unknown category")
+		}
+		return err
+	}
+	if p.Category == "" {
+		return nil
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO categories (name, created_at) SELECT CAST(? AS TEXT), CURRENT_TIMESTAMP
+		WHERE NOT EXISTS (SELECT 1 FROM categories WHERE parent_id IS NULL AND name = ?)
+		ON CONFLICT DO NOTHING
+	`, p.Category, p.Category)
+	if err != nil {
+		return err
+	}
+	var id int
+	err = tx.QueryRow(`SELECT id FROM categories WHERE parent_id IS NULL AND name = ?`, p.Category).Scan(&id)
+	p.CategoryID = &id
+	return err
+}
+
+// CreateProduct adds a product with an empty inventory summary and sets its ID
+func (s *sqlStore) CreateProduct(p *models.Product, lowStockThreshold float64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := resolveCategory(tx, p); err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO products (code, name, description, unit, category, category_id, serialized, costing_method, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), CURRENT_TIMESTAMP)
+		RETURNING id
+	`, p.Code, p.Name, p.Description, p.Unit, p.Category, p.CategoryID, p.Serialized, p.CostingMethod).Scan(&p.ID)
+	if err != nil {
+		return err
+	}
+
+	// Initialize inventory summary with the product's threshold
+	_, err = tx.Exec(`
+		INSERT INTO inventory_summary (product_id, opening_stock, total_in, total_out, total_adjustment, ending_stock, average_price, stock_value, low_stock_threshold)
+		VALUES (?, 0, 0, 0, 0, 0, 0, 0, ?)
+	`, p.ID, lowStockThreshold)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// productSorts maps the sort options of ListProducts to the column they order by. Searches can
+// also be sorted by relevance, which each database ranks in its own way.
+var productSorts = map[string]string{
+	"id":         "p.id",
+	"code":       "p.code",
+	"name":       "p.name",
+	"created_at": "p.created_at",
+}
+
+// ListProducts returns a page of the products matching f and how many match in total.
+// Searches default to relevance order, everything else to id order.
+func (s *sqlStore) ListProducts(f ProductFilter) ([]models.Product, int, error) {
+	if err := checkFilters(s.db, 0, f.CategoryID); err != nil {
+		return nil, 0, err
+	}
+
+	from := "products p LEFT JOIN inventory_summary i ON i.product_id = p.id"
+	where := []string{"1 = 1"}
+	args := []any{}
+	if !f.IncludeArchived {
+		where = append(where, "p.archived_at IS NULL")
+	}
+
+	search := s.search.query(f.Search)
+	if search != "" {
+		from, args = from+s.search.join, append(args, search)
+	}
+	if f.Category != "" {
+		where, args = append(where, "p.category = ?"), append(args, f.Category)
+	}
+	if f.CategoryID != 0 {
+		where, args = append(where, inCategorySubtree), append(args, f.CategoryID)
+	}
+	if f.Unit != "" {
+		where, args = append(where, "p.unit = ?"), append(args, f.Unit)
+	}
+
+	sort := f.Sort
+	if sort == "" {
+		sort = "id"
+		if search != "" {
+			sort = "relevance"
+		}
+	}
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+	}
+	sortColumn, ok := productSorts[strings.TrimPrefix(sort, "-")]
+	if strings.TrimPrefix(sort, "-") == "relevance" {
+		sortColumn, ok = s.search.relevance, search != ""
+	}
+	if !ok {
+		return nil, 0, Errorf(Invalid, "Invalid sort (expected id, code, name, created_at or, with q, relevance, optionally prefixed with -)")
+	}
+
+	condition := strings.Join(where, " AND ")
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM "+from+" WHERE "+condition, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+productColumns+`,
+			i.product_id IS NOT NULL, COALESCE(i.total_in, 0), COALESCE(i.total_out, 0), COALESCE(i.total_adjustment, 0),
+			COALESCE(i.ending_stock, 0), COALESCE(i.average_price, 0), COALESCE(i.stock_value, 0)
+		FROM `+from+`
+		WHERE `+condition+`
+		ORDER BY `+sortColumn+` `+direction+`, p.id `+direction+`
+		LIMIT ? OFFSET ?
+	`, append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	products := []models.Product{}
+	for rows.Next() {
+		var hasStock bool
+		var stock models.InventoryTotals
+		p, err := scanProduct(rows,
+			&hasStock, &stock.TotalIn, &stock.TotalOut, &stock.TotalAdjustment, &stock.EndingStock, &stock.AveragePrice, &stock.StockValue)
+		if err != nil {
+			return nil, 0, err
+		}
+		if f.IncludeStock && hasStock {
+			p.Stock = &stock
+		}
+		products = append(products, p)
+	}
+	return products, total, rows.Err()
+}
+
+// GetProduct returns the product with the given id
+func (s *sqlStore) GetProduct(id int) (models.Product, error) {
+	p, err := scanProduct(s.db.QueryRow("SELECT "+productColumns+" FROM products p WHERE p.id = ?", id))
+	if err == sql.ErrNoRows {
+		return p, Errorf(NotFound, "Product not found")
+	}
+	return p, err
+}
+
+// UpdateProduct replaces the details of a product. Serial tracking and costing can only be
+// switched while the product has no stock, so every unit on hand has a serial and a cost under
+// the product's method. An empty costing method or a nil Serialized keeps the product's
+// current setting.
+func (s *sqlStore) UpdateProduct(id int, update ProductUpdate) error {
+	p := &update.Product
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := resolveCategory(tx, p); err != nil {
+		return err
+	}
+
+	var serialized bool
+	var costingMethod string
+	var endingStock float64
+	err = tx.QueryRow(`
+		SELECT p.serialized, COALESCE(p.costing_method, ''), COALESCE(i.ending_stock, 0)
+		FROM products p LEFT JOIN inventory_summary i ON i.product_id = p.id
+		WHERE p.id = ?
+	`, id).Scan(&serialized, &costingMethod, &endingStock)
+	if err == sql.ErrNoRows {
+		return Errorf(NotFound, "Product not found")
+	}
+	if err != nil {
+		return err
+	}
+	p.Serialized = serialized
+	if update.Serialized != nil {
+		p.Serialized = *update.Serialized
+	}
+	if serialized != p.Serialized && endingStock != 0 {
+		return Errorf(Conflict, "Serial tracking can only be changed while the product has no stock")
+	}
+	if p.CostingMethod == "" {
+		p.CostingMethod = costingMethod
+	}
+	if costingMethod != p.CostingMethod && endingStock != 0 {
+		return Errorf(Conflict, "The costing method can only be changed while the product has no stock")
+	}
+
+	_, err = tx.Exec(`
+		UPDATE products SET code = ?, name = ?, description = ?, unit = ?, category = ?, category_id = ?, serialized = ?,
+			costing_method = NULLIF(?, '')
+		WHERE id = ?`, p.Code, p.Name, p.Description, p.Unit, p.Category, p.CategoryID, p.Serialized, p.CostingMethod, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteProduct permanently deletes a product that has never had a transaction, with its
+// summary rows. Products with history must be archived instead so their ledger is kept.
+func (s *sqlStore) DeleteProduct(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var found, hasTransactions bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM products WHERE id = ?), EXISTS(SELECT 1 FROM stock_transactions WHERE product_id = ?)
+	`, id, id).Scan(&found, &hasTransactions)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return Errorf(NotFound, "Product not found")
+	}
+	if hasTransactions {
+		return Errorf(Conflict, "Product has transactions and cannot be deleted; archive it instead")
+	}
+
+	// Summary, location stock and cost layers cascade; checkpoints have no foreign key
+	if _, err := tx.Exec("DELETE FROM stock_checkpoints WHERE product_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM products WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ArchiveProduct hides a product and blocks new transactions for it, keeping its ledger and
+// reports. Only products without stock on hand (including stock in transit) can be archived.
+func (s *sqlStore) ArchiveProduct(id int) error {
+	var archived bool
+	var endingStock float64
+	err := s.db.QueryRow(`
+		SELECT p.archived_at IS NOT NULL, COALESCE(i.ending_stock, 0)
+		FROM products p LEFT JOIN inventory_summary i ON i.product_id = p.id
+		WHERE p.id = ?
+	`, id).Scan(&archived, &endingStock)
+	if err == sql.ErrNoRows {
+		return Errorf(NotFound, "Product not found")
+	}
+	if err != nil {
+		return err
+	}
+	if archived {
+		return Errorf(Conflict, "Product is already archived")
+	}
+	if endingStock != 0 {
+		return Errorf(Conflict, "Only products without stock on hand can be archived")
+	}
+
+	_, err = s.db.Exec(`UPDATE products SET archived_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
+	return err
+}
+
+// RestoreProduct brings an archived product back into use
+func (s *sqlStore) RestoreProduct(id int) error {
+	result, err := s.db.Exec(`UPDATE products SET archived_at = NULL WHERE id = ? AND archived_at IS NOT NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return Errorf(NotFound, "Archived product not found")
+	}
+	return nil
+}
+
+// ProductsInCategory returns the products in a category and all of its subcategories, by code
+func (s *sqlStore) ProductsInCategory(categoryID int) ([]models.Product, error) {
+	found, err := exists(s.db, "categories", categoryID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, Errorf(NotFound, "Category not found")
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+productColumns+`
+		FROM products p
+		WHERE `+inCategorySubtree+`
+		ORDER BY p.code
+	`, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []models.Product{}
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
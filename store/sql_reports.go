@@ -0,0 +1,62 @@
+package store
+
+import (
+	"inventory-app/models"
+	"time"
+)
+
+// DepartmentConsumption reports the stock issued to each department between two days, both
+// inclusive, per product, valued at the cost of goods issued recorded on each stock-out.
+// Voided issues net out through their reversals. A department narrows the report to it.
+func (s *sqlStore) DepartmentConsumption(from, to time.Time, department string) (models.DepartmentConsumptionReport, error) {
+	report := models.DepartmentConsumptionReport{
+		From:        from.Format("2006-01-02"),
+		To:          to.Format("2006-01-02"),
+		Lines:       []models.DepartmentConsumption{},
+		Departments: []models.DepartmentTotal{},
+	}
+
+	// The range covers [from, the day after to)
+	rows, err := s.db.Query(`
+		SELECT
+			COALESCE(st.department, ''), p.id, p.code, p.name, COALESCE(p.category, ''), p.unit,
+			SUM(st.quantity),
+			COALESCE(SUM(st.cost_total), 0),
+			COALESCE(SUM(CASE WHEN st.cost_total IS NULL THEN st.quantity ELSE 0 END), 0)
+		FROM
+			stock_transactions st
+		JOIN
+			products p ON p.id = st.product_id
+		WHERE
+			st.transaction_type = 'out' AND st.transaction_timestamp >= ? AND st.transaction_timestamp < ?
+			AND (? = '' OR st.department = ?)
+		GROUP BY
+			COALESCE(st.department, ''), p.id
+		ORDER BY
+			COALESCE(st.department, ''), COALESCE(p.category, ''), p.code
+	`, report.From, to.AddDate(0, 0, 1).Format("2006-01-02"), department, department)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.DepartmentConsumption
+		err := rows.Scan(&l.Department, &l.ProductID, &l.Code, &l.Name, &l.Category, &l.Unit,
+			&l.Quantity, &l.Value, &l.UncostedQuantity)
+		if err != nil {
+			return report, err
+		}
+		report.Lines = append(report.Lines, l)
+
+		// Lines arrive grouped by department
+		if n := len(report.Departments); n == 0 || report.Departments[n-1].Department != l.Department {
+			report.Departments = append(report.Departments, models.DepartmentTotal{Department: l.Department})
+		}
+		total := &report.Departments[len(report.Departments)-1]
+		total.Quantity += l.Quantity
+		total.Value += l.Value
+		report.TotalValue += l.Value
+	}
+	return report, rows.Err()
+}
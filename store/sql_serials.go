@@ -0,0 +1,142 @@
+package store
+
+import (
+	"database/sql"
+	"inventory-app/models"
+)
+
+// serialColumns are the columns scanned by scanSerialNumber
+const serialColumns = `s.product_id, p.code, p.name, s.serial_number, s.status, s.location_id`
+
+// scanSerialNumber scans the serialColumns of a row into a SerialNumber
+func scanSerialNumber(row RowScanner) (models.SerialNumber, error) {
+	var s models.SerialNumber
+	var locationID sql.NullInt64
+	err := row.Scan(&s.ProductID, &s.Code, &s.Name, &s.SerialNumber, &s.Status, &locationID)
+	if locationID.Valid {
+		id := int(locationID.Int64)
+		s.LocationID = &id
+	}
+	return s, err
+}
+
+// TransactionSerials returns the serial numbers recorded on a ledger entry
+func TransactionSerials(q queryer, transactionID int) ([]string, error) {
+	rows, err := q.Query(`SELECT serial_number FROM transaction_serials WHERE transaction_id = ? ORDER BY serial_number`, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	serials := []string{}
+	for rows.Next() {
+		var serial string
+		if err := rows.Scan(&serial); err != nil {
+			return nil, err
+		}
+		serials = append(serials, serial)
+	}
+	return serials, rows.Err()
+}
+
+// ProductSerials returns the units of a product, optionally only those with a status or at a
+// location (0 for any), by serial number
+func (s *sqlStore) ProductSerials(productID int, status string, locationID int) ([]models.SerialNumber, error) {
+	found, err := exists(s.db, "products", productID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, Errorf(NotFound, "Product not found")
+	}
+	if err := checkFilters(s.db, locationID, 0); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+serialColumns+`
+		FROM serial_numbers s
+		JOIN products p ON p.id = s.product_id
+		WHERE s.product_id = ? AND (? = '' OR s.status = ?) AND (? = 0 OR s.location_id = ?)
+		ORDER BY s.serial_number
+	`, productID, status, status, locationID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	serials := []models.SerialNumber{}
+	for rows.Next() {
+		unit, err := scanSerialNumber(rows)
+		if err != nil {
+			return nil, err
+		}
+		serials = append(serials, unit)
+	}
+	return serials, rows.Err()
+}
+
+// SerialHistory returns the units with a serial number, of one product or of all of them (0),
+// each with every ledger entry that moved it, oldest first
+func (s *sqlStore) SerialHistory(serial string, productID int) ([]models.SerialNumber, error) {
+	rows, err := s.db.Query(`
+		SELECT `+serialColumns+`
+		FROM serial_numbers s
+		JOIN products p ON p.id = s.product_id
+		WHERE s.serial_number = ? AND (? = 0 OR s.product_id = ?)
+		ORDER BY s.product_id
+	`, serial, productID, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	units := []models.SerialNumber{}
+	for rows.Next() {
+		unit, err := scanSerialNumber(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		units = append(units, unit)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(units) == 0 {
+		return nil, Errorf(NotFound, "Serial number not found")
+	}
+
+	for i := range units {
+		units[i].Movements, err = s.serialMovements(units[i].ProductID, serial)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return units, nil
+}
+
+// serialMovements returns the ledger entries that moved a unit, oldest first
+func (s *sqlStore) serialMovements(productID int, serial string) ([]models.StockTransaction, error) {
+	rows, err := s.db.Query(`
+		SELECT `+StockTransactionColumns+`
+		FROM transaction_serials ts
+		JOIN stock_transactions st ON st.id = ts.transaction_id
+		WHERE ts.product_id = ? AND ts.serial_number = ?
+		ORDER BY st.transaction_timestamp, st.id
+	`, productID, serial)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := []models.StockTransaction{}
+	for rows.Next() {
+		t, err := ScanStockTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, t)
+	}
+	return movements, rows.Err()
+}
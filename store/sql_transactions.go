@@ -0,0 +1,174 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"inventory-app/models"
+	"strings"
+	"time"
+)
+
+// transactionSort is a sort option of ListTransactions: the column it orders by, which the
+// indexes cover, and the expression its cursor key is read from. Ties are broken by id in the
+// same direction.
+type transactionSort struct {
+	column, key string
+}
+
+var transactionSorts = map[string]transactionSort{
+	"timestamp": {"st.transaction_timestamp", "CAST(st.transaction_timestamp AS TEXT)"}, // read as stored, as the driver would parse it
+	"quantity":  {"st.quantity", "st.quantity"},
+	"id":        {"st.id", "st.id"},
+}
+
+// transactionCursor marks the last row of a page: its sort key and id
+type transactionCursor struct {
+	Key any `json:"k"`
+	ID  int `json:"id"`
+}
+
+// sortKeyScanner scans the sort key selected after the StockTransactionColumns
+type sortKeyScanner struct {
+	rows *sql.Rows
+	key  *any
+}
+
+func (s sortKeyScanner) Scan(dest ...any) error {
+	return s.rows.Scan(append(dest, s.key)...)
+}
+
+// ListTransactions returns a page of the ledger entries matching f, newest first unless f
+// sorts otherwise, and the cursor that continues after it
+func (s *sqlStore) ListTransactions(f TransactionFilter) ([]models.StockTransaction, *string, error) {
+	if err := checkFilters(s.db, f.LocationID, 0); err != nil {
+		return nil, nil, err
+	}
+
+	where := []string{"(? OR (st.voided_at IS NULL AND st.reversal_of IS NULL))"}
+	args := []any{f.IncludeVoided}
+	if f.ProductID != 0 {
+		where, args = append(where, "st.product_id = ?"), append(args, f.ProductID)
+	}
+	if f.LocationID != 0 {
+		where, args = append(where, "st.location_id = ?"), append(args, f.LocationID)
+	}
+	if f.Type != "" {
+		where, args = append(where, "st.transaction_type = ?"), append(args, f.Type)
+	}
+	if f.Department != "" {
+		where, args = append(where, "st.department = ?"), append(args, f.Department)
+	}
+	if !f.From.IsZero() {
+		where, args = append(where, "st.transaction_timestamp >= ?"), append(args, f.From.Format("2006-01-02"))
+	}
+	if !f.To.IsZero() {
+		where, args = append(where, "st.transaction_timestamp < ?"), append(args, f.To.AddDate(0, 0, 1).Format("2006-01-02"))
+	}
+	if f.MinQuantity != nil {
+		where, args = append(where, "st.quantity >= ?"), append(args, *f.MinQuantity)
+	}
+	if f.MaxQuantity != nil {
+		where, args = append(where, "st.quantity <= ?"), append(args, *f.MaxQuantity)
+	}
+	if f.Notes != "" {
+		where, args = append(where, "LOWER(st.notes) LIKE '%' || LOWER(CAST(? AS TEXT)) || '%'"), append(args, f.Notes)
+	}
+
+	sort := f.Sort
+	if sort == "" {
+		sort = "-timestamp"
+	}
+	sortBy, ok := transactionSorts[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return nil, nil, Errorf(Invalid, "Invalid sort (expected timestamp, quantity or id, optionally prefixed with -)")
+	}
+	direction, comparison := "ASC", ">"
+	if strings.HasPrefix(sort, "-") {
+		direction, comparison = "DESC", "<"
+	}
+
+	// The cursor continues after the last row of the previous page in the same sort order
+	if f.Cursor != "" {
+		var cursor transactionCursor
+		raw, err := base64.RawURLEncoding.DecodeString(f.Cursor)
+		if err == nil {
+			err = json.Unmarshal(raw, &cursor)
+		}
+		if err != nil || cursor.Key == nil {
+			return nil, nil, Errorf(Invalid, "Invalid cursor")
+		}
+		where = append(where, fmt.Sprintf("(%s, st.id) %s (?, ?)", sortBy.column, comparison))
+		args = append(args, cursor.Key, cursor.ID)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+StockTransactionColumns+`, `+sortBy.key+`
+		FROM stock_transactions st
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY `+sortBy.column+` `+direction+`, st.id `+direction+`
+		LIMIT ?
+	`, append(args, f.Limit+1)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	transactions := []models.StockTransaction{}
+	var nextCursor *string
+	var pageKey any
+	for rows.Next() {
+		var key any
+		t, err := ScanStockTransaction(sortKeyScanner{rows, &key})
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(transactions) == f.Limit {
+			// There is at least one more row: the page ends at the previous one
+			last := transactions[f.Limit-1]
+			lastKey, _ := json.Marshal(transactionCursor{Key: pageKey, ID: last.ID})
+			encoded := base64.RawURLEncoding.EncodeToString(lastKey)
+			nextCursor = &encoded
+			break
+		}
+		transactions = append(transactions, t)
+		pageKey = key
+	}
+	return transactions, nextCursor, rows.Err()
+}
+
+// TransactionsOn returns the ledger entries of one day (YYYY-MM-DD), newest first
+func (s *sqlStore) TransactionsOn(date string) ([]models.DailyTransaction, error) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil, Errorf(Invalid, "Invalid date format. Use YYYY-MM-DD")
+	}
+
+	rows, err := s.db.Query(`
+		SELECT
+			st.id, p.name, st.transaction_type, st.quantity, st.transaction_timestamp
+		FROM
+			stock_transactions st
+		JOIN
+			products p ON p.id = st.product_id
+		WHERE
+			st.transaction_timestamp >= ? AND st.transaction_timestamp < ?
+		ORDER BY
+			st.transaction_timestamp DESC
+	`, date, day.AddDate(0, 0, 1).Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.DailyTransaction
+	for rows.Next() {
+		var t models.DailyTransaction
+		if err := rows.Scan(&t.ID, &t.Product, &t.Type, &t.Quantity, &t.Timestamp); err != nil {
+			return nil, err
+		}
+		results = append(results, t)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"database/sql"
+	"inventory-app/models"
+)
+
+// TransferColumns are the columns of the transfers table, as scanned by ScanTransfer
+const TransferColumns = `
+	id, product_id, from_location_id, to_location_id, quantity, average_price, status, COALESCE(notes, ''),
+	dispatched_at, received_at, out_transaction_id, in_transaction_id
+`
+
+// ScanTransfer scans the TransferColumns of a row into a Transfer
+func ScanTransfer(row RowScanner) (models.Transfer, error) {
+	var t models.Transfer
+	var receivedAt sql.NullTime
+	var outID, inID sql.NullInt64
+	err := row.Scan(&t.ID, &t.ProductID, &t.FromLocationID, &t.ToLocationID, &t.Quantity, &t.AveragePrice, &t.Status, &t.Notes,
+		&t.DispatchedAt, &receivedAt, &outID, &inID)
+	if receivedAt.Valid {
+		t.ReceivedAt = &receivedAt.Time
+	}
+	if outID.Valid {
+		id := int(outID.Int64)
+		t.OutTransactionID = &id
+	}
+	if inID.Valid {
+		id := int(inID.Int64)
+		t.InTransactionID = &id
+	}
+	return t, err
+}
+
+// ListTransfers returns the transfers, optionally only those with a status, newest first
+func (s *sqlStore) ListTransfers(status string) ([]models.Transfer, error) {
+	rows, err := s.db.Query(`
+		SELECT `+TransferColumns+` FROM transfers
+		WHERE ? = '' OR status = ?
+		ORDER BY id DESC
+	`, status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []models.Transfer{}
+	for rows.Next() {
+		t, err := ScanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	return transfers, rows.Err()
+}
+
+// GetTransfer returns the transfer with the given id
+func (s *sqlStore) GetTransfer(id int) (models.Transfer, error) {
+	t, err := ScanTransfer(s.db.QueryRow(`SELECT `+TransferColumns+` FROM transfers WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return t, Errorf(NotFound, "Transfer not found")
+	}
+	return t, err
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// SQLite implements every store on a SQLite database
+type SQLite struct {
+	sqlStore
+}
+
+// NewSQLite returns the stores backed by db, which must already be migrated
+func NewSQLite(db *sql.DB) *SQLite {
+	return &SQLite{sqlStore{db: db, search: sqliteSearch}}
+}
+
+var _ Store = (*SQLite)(nil)
+
+// sqliteSearch matches products through the products_fts full-text index
+var sqliteSearch = productSearch{
+	query:     sqliteSearchQuery,
+	join:      " JOIN products_fts ON products_fts.rowid = p.id AND products_fts MATCH ?",
+	relevance: "bm25(products_fts)",
+}
+
+// sqliteSearchQuery turns free text into an FTS5 query matching every word as a prefix
+func sqliteSearchQuery(text string) string {
+	terms := []string{}
+	for _, word := range strings.Fields(text) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,223 @@
+// Package store keeps the records of the application behind interfaces, so handlers can run
+// against the SQLite or PostgreSQL implementation or against fakes in tests. Posting to the
+// ledger is left to package services, which works on a *sql.Tx.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"inventory-app/models"
+	"time"
+)
+
+// ProductFilter selects, orders and pages the products returned by ListProducts
+type ProductFilter struct {
+	Search          string // free text matched against the code, name and description
+	Category        string // category name
+	CategoryID      int    // a category and all of its subcategories
+	Unit            string
+	Sort            string // id, code, name, created_at or relevance, prefixed with "-" for descending
+	Limit           int
+	Offset          int
+	IncludeStock    bool // fill in Product.Stock
+	IncludeArchived bool
+}
+
+// ProductUpdate is the new details of a product, as sent to UpdateProduct. Serialized is
+// optional: left out (nil), the product keeps its serial tracking.
+type ProductUpdate struct {
+	models.Product
+	Serialized *bool `json:"serialized"`
+}
+
+// ProductStore keeps the product catalogue
+type ProductStore interface {
+	// CreateProduct adds a product with an empty inventory summary and sets its ID
+	CreateProduct(p *models.Product, lowStockThreshold float64) error
+	// ListProducts returns a page of the products matching f and how many match in total
+	ListProducts(f ProductFilter) ([]models.Product, int, error)
+	GetProduct(id int) (models.Product, error)
+	UpdateProduct(id int, update ProductUpdate) error
+	// DeleteProduct removes a product that has never had a transaction
+	DeleteProduct(id int) error
+	// ArchiveProduct hides a product without stock and blocks new transactions for it
+	ArchiveProduct(id int) error
+	RestoreProduct(id int) error
+	// ProductsInCategory returns the products of a category and all of its subcategories
+	ProductsInCategory(categoryID int) ([]models.Product, error)
+}
+
+// TransactionFilter selects, orders and pages the ledger entries returned by ListTransactions
+type TransactionFilter struct {
+	ProductID     int
+	LocationID    int
+	Type          string
+	Department    string
+	From          time.Time // zero for no lower bound
+	To            time.Time // inclusive day; zero for no upper bound
+	MinQuantity   *float64
+	MaxQuantity   *float64
+	Notes         string // substring of the notes
+	IncludeVoided bool   // include voided entries and their reversals
+	Sort          string // timestamp, quantity or id, prefixed with "-" for descending
+	Limit         int
+	Cursor        string // next cursor of the previous page
+}
+
+// TransactionStore reads the stock ledger. Entries are recorded and voided by package services.
+type TransactionStore interface {
+	// ListTransactions returns a page of the entries matching f and the cursor of the next
+	// page, nil on the last one
+	ListTransactions(f TransactionFilter) ([]models.StockTransaction, *string, error)
+	// TransactionsOn returns the entries of one day (YYYY-MM-DD), newest first
+	TransactionsOn(date string) ([]models.DailyTransaction, error)
+}
+
+// InventoryStore reports and maintains the stock balances derived from the ledger. A zero
+// locationID means company-wide.
+type InventoryStore interface {
+	InventorySummary(locationID, categoryID int) ([]models.InventorySummaryLine, error)
+	CategoryRollup(locationID int) ([]models.CategoryRollup, error)
+	LowStockAlerts(locationID int) ([]models.LowStockAlert, error)
+	SetLowStockThreshold(productID int, threshold float64) error
+	// StockByLocation returns the company-wide stock of every product with its breakdown per location
+	StockByLocation() ([]models.ProductLocations, error)
+}
+
+// CategoryStore keeps the tree of product categories
+type CategoryStore interface {
+	// ListCategories returns every category with its path, parents before children
+	ListCategories() ([]models.Category, error)
+	// CreateCategory adds a category and sets its ID
+	CreateCategory(category *models.Category) error
+	// UpdateCategory renames and moves a category, renaming it on its products too. It is never
+	// moved under itself or one of its subcategories.
+	UpdateCategory(id int, category models.Category) error
+	// DeleteCategory removes a category without subcategories or products
+	DeleteCategory(id int) error
+}
+
+// LocationStore keeps the locations that hold stock
+type LocationStore interface {
+	CreateLocation(location *models.Location) error
+	ListLocations() ([]models.Location, error)
+	GetLocation(id int) (models.Location, error)
+	UpdateLocation(id int, location models.Location) error
+}
+
+// SerialStore tracks the units of serialized products
+type SerialStore interface {
+	// ProductSerials returns the units of a product, optionally only those with a status or at a location
+	ProductSerials(productID int, status string, locationID int) ([]models.SerialNumber, error)
+	// SerialHistory returns the units with a serial number, of one product or all of them,
+	// each with the ledger entries that moved it
+	SerialHistory(serial string, productID int) ([]models.SerialNumber, error)
+}
+
+// DocumentStore reads goods receipts and issue slips. They are posted by package services.
+type DocumentStore interface {
+	// ListDocuments returns the document headers, optionally of one type, newest first
+	ListDocuments(documentType string) ([]models.StockDocument, error)
+	// GetDocument returns a document with its lines
+	GetDocument(id int) (models.StockDocument, error)
+}
+
+// TransferStore reads transfers between locations. They are posted by package services.
+type TransferStore interface {
+	// ListTransfers returns the transfers, optionally with one status, newest first
+	ListTransfers(status string) ([]models.Transfer, error)
+	GetTransfer(id int) (models.Transfer, error)
+}
+
+// PeriodStore reads closed periods. They are closed and reopened by package services.
+type PeriodStore interface {
+	ListPeriods() ([]models.Period, error)
+	// PeriodBalances returns the balances snapshotted when a period (YYYY-MM) was closed
+	PeriodBalances(period string) ([]models.PeriodBalance, error)
+	PeriodAuditLog(period string) ([]models.PeriodAuditEntry, error)
+}
+
+// NewCountSession is a cycle count to start: of a list of products or of every product in a category
+type NewCountSession struct {
+	Name       string
+	ProductIDs []int
+	Category   string
+	LocationID int
+}
+
+// CountEntry is the counted quantity of one product of a count session
+type CountEntry struct {
+	ProductID       int      `json:"product_id"`
+	CountedQuantity *float64 `json:"counted_quantity"`
+}
+
+// CountStore keeps cycle counts. Approved counts are posted by package services.
+type CountStore interface {
+	CreateCountSession(s NewCountSession) (models.CountSession, error)
+	ListCountSessions() ([]models.CountSession, error)
+	// GetCountSession returns a session with its lines, without system quantities
+	GetCountSession(id int) (models.CountSession, error)
+	// RecordCounts stores counted quantities on an open session and returns it
+	RecordCounts(id int, countedBy string, counts []CountEntry) (models.CountSession, error)
+	// SubmitCountSession closes counting on a session once every product has been counted
+	SubmitCountSession(id int) error
+	// CountVariances returns the status of a submitted or approved session and its variances
+	CountVariances(id int) (string, []models.CountVariance, error)
+	// CancelCountSession abandons a session that has not been approved
+	CancelCountSession(id int) error
+}
+
+// ReportStore runs the reports read straight from the ledger
+type ReportStore interface {
+	// DepartmentConsumption reports the stock issued to each department between two days,
+	// both inclusive, optionally for one department
+	DepartmentConsumption(from, to time.Time, department string) (models.DepartmentConsumptionReport, error)
+}
+
+// Store is every store, as the SQLite and PostgreSQL implementations provide them
+type Store interface {
+	ProductStore
+	TransactionStore
+	InventoryStore
+	CategoryStore
+	LocationStore
+	SerialStore
+	DocumentStore
+	TransferStore
+	PeriodStore
+	CountStore
+	ReportStore
+}
+
+// Kind classifies an Error
+type Kind int
+
+const (
+	Invalid       Kind = iota + 1 // the request does not fit the data, e.g. there is not enough stock
+	NotFound                      // the record addressed does not exist
+	Conflict                      // the state of the record does not allow the change
+	Unprocessable                 // the request names a record that does not exist
+)
+
+// Error is a failure caused by the request rather than by the database
+type Error struct {
+	Kind    Kind
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Errorf returns an Error of the given kind, for package services to report the failures
+// caused by a request
+func Errorf(kind Kind, format string, args ...any) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// KindOf returns the Kind of err, or 0 when it was not caused by the request
+func KindOf(err error) Kind {
+	var storeErr *Error
+	if errors.As(err, &storeErr) {
+		return storeErr.Kind
+	}
+	return 0
+}
@@ -0,0 +1,306 @@
+package store_test
+
+import (
+	"database/sql"
+	"inventory-app/config"
+	"inventory-app/internal/pgtest"
+	"inventory-app/models"
+	"inventory-app/services"
+	"inventory-app/store"
+	"strings"
+	"testing"
+	"time"
+)
+
+// forEachStore runs test against a fresh SQLite store and, when TEST_DATABASE_URL is set, a
+// fresh PostgreSQL store
+func forEachStore(t *testing.T, test func(t *testing.T, s store.Store, db *sql.DB)) {
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := config.Open(t.TempDir() + "/inventory.db")
+		if err != nil {
+			t.Fatalf("open database: %v", err)
+		}
+		defer db.Close()
+		test(t, store.NewSQLite(db), db)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		db := pgtest.Open(t, config.OpenPostgres)
+		test(t, store.NewPostgres(db), db)
+	})
+}
+
+// record posts t through package services, as the handlers do
+func record(t *testing.T, db *sql.DB, transaction models.StockTransaction) services.RecordedTransaction {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	recorded, err := services.RecordTransaction(tx, transaction)
+	if err != nil {
+		t.Fatalf("record %s of %v: %v", transaction.TransactionType, transaction.Quantity, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return recorded
+}
+
+func TestProducts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store, db *sql.DB) {
+		product := models.Product{Code: "P-1", Name: "Widget", Unit: "pcs", Category: "Parts"}
+		if err := s.CreateProduct(&product, 3); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if err := s.CreateProduct(&models.Product{Code: "P-1", Name: "Copy", Unit: "pcs"}, 3); err == nil {
+			t.Error("created a second product with the same code")
+		}
+
+		got, err := s.GetProduct(product.ID)
+		if err != nil || got.Code != "P-1" || got.Name != "Widget" {
+			t.Errorf("get = %+v, %v", got, err)
+		}
+		if _, err := s.GetProduct(product.ID + 100); store.KindOf(err) != store.NotFound {
+			t.Errorf("get unknown product: %v, want not found", err)
+		}
+
+		products, total, err := s.ListProducts(store.ProductFilter{Category: "Parts", Limit: 10})
+		if err != nil || total != 1 || len(products) != 1 {
+			t.Errorf("list by category = %d of %d, %v; want 1 of 1", len(products), total, err)
+		}
+
+		record(t, db, models.StockTransaction{ProductID: product.ID, TransactionType: "in", Quantity: 2, PricePerUnit: 5})
+		if err := s.DeleteProduct(product.ID); store.KindOf(err) != store.Conflict {
+			t.Errorf("delete product with transactions: %v, want conflict", err)
+		}
+	})
+}
+
+func TestUpdateProductCostingMethod(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store, db *sql.DB) {
+		product := models.Product{Code: "F-1", Name: "Flour", Unit: "kg", CostingMethod: services.FIFO}
+		if err := s.CreateProduct(&product, 0); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		record(t, db, models.StockTransaction{ProductID: product.ID, TransactionType: "in", Quantity: 2, PricePerUnit: 5})
+
+		// Leaving the method out keeps it
+		update := store.ProductUpdate{Product: models.Product{Code: "F-1", Name: "Wheat flour", Unit: "kg"}}
+		if err := s.UpdateProduct(product.ID, update); err != nil {
+			t.Fatalf("update without a costing method: %v", err)
+		}
+		got, err := s.GetProduct(product.ID)
+		if err != nil || got.Name != "Wheat flour" || got.CostingMethod != services.FIFO {
+			t.Errorf("after update = %+v, %v; want renamed and still fifo", got, err)
+		}
+
+		update.CostingMethod = services.MovingAverage
+		if err := s.UpdateProduct(product.ID, update); store.KindOf(err) != store.Conflict {
+			t.Errorf("change costing method with stock: %v, want conflict", err)
+		}
+	})
+}
+
+func TestUpdateProductSerialTracking(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store, db *sql.DB) {
+		product := models.Product{Code: "L-1", Name: "Laptop", Unit: "pcs", Serialized: true}
+		if err := s.CreateProduct(&product, 0); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		serialized := func() bool {
+			t.Helper()
+			got, err := s.GetProduct(product.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return got.Serialized
+		}
+
+		// Leaving serial tracking out keeps it
+		update := store.ProductUpdate{Product: models.Product{Code: "L-1", Name: "Work laptop", Unit: "pcs"}}
+		if err := s.UpdateProduct(product.ID, update); err != nil {
+			t.Fatalf("update without serialized: %v", err)
+		}
+		if !serialized() {
+			t.Error("serial tracking was switched off by an update that left it out")
+		}
+
+		off := false
+		update.Serialized = &off
+		if err := s.UpdateProduct(product.ID, update); err != nil {
+			t.Fatalf("switch serial tracking off: %v", err)
+		}
+		if serialized() {
+			t.Error("serial tracking is still on after switching it off")
+		}
+	})
+}
+
+func TestCategories(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store, db *sql.DB) {
+		parent := models.Category{Name: "Office"}
+		if err := s.CreateCategory(&parent); err != nil {
+			t.Fatalf("create parent: %v", err)
+		}
+		child := models.Category{Name: "Paper", ParentID: &parent.ID}
+		if err := s.CreateCategory(&child); err != nil {
+			t.Fatalf("create child: %v", err)
+		}
+		if child.Path != "Office / Paper" {
+			t.Errorf("path = %q, want %q", child.Path, "Office / Paper")
+		}
+
+		unknown := 999
+		if err := s.CreateCategory(&models.Category{Name: "Orphan", ParentID: &unknown}); store.KindOf(err) != store.Invalid {
+			t.Errorf("create with unknown parent: %v, want invalid", err)
+		}
+		if err := s.DeleteCategory(parent.ID); store.KindOf(err) != store.Conflict {
+			t.Errorf("delete category with children: %v, want conflict", err)
+		}
+
+		// A category never ends up under itself, however the move is made
+		grandchild := models.Category{Name: "A4", ParentID: &child.ID}
+		if err := s.CreateCategory(&grandchild); err != nil {
+			t.Fatalf("create grandchild: %v", err)
+		}
+		moves := []struct {
+			name     string
+			id       int
+			parentID int
+			want     store.Kind
+		}{
+			{"under itself", parent.ID, parent.ID, store.Invalid},
+			{"under its child", parent.ID, child.ID, store.Invalid},
+			{"under its grandchild", parent.ID, grandchild.ID, store.Invalid},
+			{"under an unknown parent", child.ID, unknown, store.Invalid},
+			{"an unknown category", unknown, parent.ID, store.NotFound},
+		}
+		for _, m := range moves {
+			parentID := m.parentID
+			if err := s.UpdateCategory(m.id, models.Category{Name: "Moved", ParentID: &parentID}); store.KindOf(err) != m.want {
+				t.Errorf("move %s: %v, want kind %v", m.name, err, m.want)
+			}
+		}
+		if err := s.UpdateCategory(grandchild.ID, models.Category{Name: "A4"}); err != nil {
+			t.Fatalf("move grandchild to the root: %v", err)
+		}
+		if err := s.UpdateCategory(parent.ID, models.Category{Name: "Office", ParentID: &grandchild.ID}); err != nil {
+			t.Errorf("move parent under a former grandchild: %v", err)
+		}
+		categories, err := s.ListCategories()
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths := []string{}
+		for _, c := range categories {
+			paths = append(paths, c.Path)
+		}
+		if got := strings.Join(paths, ", "); got != "A4, A4 / Office, A4 / Office / Paper" {
+			t.Errorf("paths = %s", got)
+		}
+	})
+}
+
+func TestLedgerListing(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store, db *sql.DB) {
+		product := models.Product{Code: "P-1", Name: "Widget", Unit: "pcs"}
+		if err := s.CreateProduct(&product, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		day := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+		east := time.FixedZone("+0700", 7*60*60)
+		record(t, db, models.StockTransaction{ProductID: product.ID, TransactionType: "in", Quantity: 10, PricePerUnit: 2,
+			TransactionTimestamp: day.Add(9 * time.Hour).In(east)})
+		record(t, db, models.StockTransaction{ProductID: product.ID, TransactionType: "out", Quantity: 4, Department: "Kitchen",
+			TransactionTimestamp: day.Add(10 * time.Hour)})
+
+		transactions, next, err := s.ListTransactions(store.TransactionFilter{Sort: "timestamp", Limit: 1})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if len(transactions) != 1 || transactions[0].TransactionType != "in" || next == nil {
+			t.Fatalf("first page = %+v (next %v), want the stock-in and a cursor", transactions, next)
+		}
+		transactions, next, err = s.ListTransactions(store.TransactionFilter{Sort: "timestamp", Limit: 1, Cursor: *next})
+		if err != nil {
+			t.Fatalf("list second page: %v", err)
+		}
+		if len(transactions) != 1 || transactions[0].TransactionType != "out" {
+			t.Errorf("second page = %+v, want the stock-out", transactions)
+		}
+
+		daily, err := s.TransactionsOn("2024-03-05")
+		if err != nil || len(daily) != 2 {
+			t.Errorf("transactions on the day = %d, %v; want 2", len(daily), err)
+		}
+
+		report, err := s.DepartmentConsumption(day, day, "")
+		if err != nil {
+			t.Fatalf("consumption: %v", err)
+		}
+		if len(report.Departments) != 1 || report.Departments[0].Department != "Kitchen" {
+			t.Errorf("consumption = %+v, want Kitchen only", report.Departments)
+		}
+
+		summary, err := s.InventorySummary(0, 0)
+		if err != nil || len(summary) != 1 || summary[0].EndingStock != 6 {
+			t.Errorf("summary = %+v, %v; want 6 in stock", summary, err)
+		}
+	})
+}
+
+func TestCountSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store.Store, db *sql.DB) {
+		product := models.Product{Code: "P-1", Name: "Widget", Unit: "pcs"}
+		if err := s.CreateProduct(&product, 0); err != nil {
+			t.Fatal(err)
+		}
+		record(t, db, models.StockTransaction{ProductID: product.ID, TransactionType: "in", Quantity: 10, PricePerUnit: 2})
+
+		session, err := s.CreateCountSession(store.NewCountSession{Name: "Shelf A", ProductIDs: []int{product.ID}})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if _, _, err := s.CountVariances(session.ID); store.KindOf(err) != store.Conflict {
+			t.Errorf("variances while counting: %v, want conflict", err)
+		}
+		if err := s.SubmitCountSession(session.ID); store.KindOf(err) != store.Invalid {
+			t.Errorf("submit with uncounted products: %v, want invalid", err)
+		}
+
+		counted := 7.0
+		if _, err := s.RecordCounts(session.ID, "ana", []store.CountEntry{{ProductID: product.ID, CountedQuantity: &counted}}); err != nil {
+			t.Fatalf("record counts: %v", err)
+		}
+		if err := s.SubmitCountSession(session.ID); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+		status, variances, err := s.CountVariances(session.ID)
+		if err != nil || status != "submitted" || len(variances) != 1 || variances[0].Variance != -3 {
+			t.Errorf("variances = %s %+v, %v; want one of -3", status, variances, err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := services.ApproveCountSession(tx, session.ID, "lead", ""); err != nil {
+			tx.Rollback()
+			t.Fatalf("approve: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CancelCountSession(session.ID); store.KindOf(err) != store.Conflict {
+			t.Errorf("cancel approved session: %v, want conflict", err)
+		}
+		if status, _, err := store.CountSessionStatus(db, session.ID); err != nil || status != "approved" {
+			t.Errorf("status after cancelling = %s, %v; want approved", status, err)
+		}
+		if err := s.CancelCountSession(session.ID + 100); store.KindOf(err) != store.NotFound {
+			t.Errorf("cancel unknown session: %v, want not found", err)
+		}
+	})
+}